@@ -0,0 +1,194 @@
+// Command logdump prints the records of a database log.
+//
+// Usage:
+//
+//	logdump [flags] <dbdir>
+//
+// The database is opened read-only, so it can be inspected while no writer
+// has it open. Every record is printed in append order with its LSN, the
+// block and offset where it ends, and its size. Records of the known recovery
+// types are decoded.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"database_design_and_implementation/internal/file"
+	"database_design_and_implementation/internal/log"
+	"database_design_and_implementation/internal/server"
+	"database_design_and_implementation/internal/tx/recovery"
+)
+
+// opNames are the names of the recovery record types.
+var opNames = map[int]string{
+	recovery.CHECKPOINT: "CHECKPOINT",
+	recovery.START:      "START",
+	recovery.COMMIT:     "COMMIT",
+	recovery.ROLLBACK:   "ROLLBACK",
+	recovery.SETINT:     "SETINT",
+	recovery.SETSTRING:  "SETSTRING",
+}
+
+// entry describes one log record. It is printed as a line of text or JSON.
+type entry struct {
+	LSN    int    `json:"lsn"`
+	File   string `json:"file"`
+	Block  int    `json:"block"`
+	Offset int    `json:"offset"`
+	Size   int    `json:"size"`
+	Op     string `json:"op,omitempty"`
+	Tx     *int   `json:"tx,omitempty"`
+	Text   string `json:"text,omitempty"`
+	// Data holds the bytes of a record that could not be decoded.
+	Data []byte `json:"data,omitempty"`
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "logdump:", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the command line and dumps the log it names to stdout.
+func run(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("logdump", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: logdump [flags] <dbdir>")
+		fs.PrintDefaults()
+	}
+	logfile := fs.String("log", server.LogFile, "name of the log")
+	blockSize := fs.Int("blocksize", 0, "block size, if the database has no superblock (default "+strconv.Itoa(server.BlockSize)+")")
+	checksums := fs.Bool("checksums", false, "whether blocks carry checksums, if the database has no superblock")
+	format := fs.String("format", "text", "output format: text or json")
+	var txFilter *int
+	fs.Func("tx", "only print the records of this transaction", func(s string) error {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		txFilter = &n
+		return nil
+	})
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown output format %q", *format)
+	}
+	dir := fs.Arg(0)
+
+	// The database must be opened with the settings it was created with.
+	sb, err := file.ReadSuperblock(dir, nil)
+	if err != nil {
+		return err
+	}
+	if sb != nil {
+		*blockSize, *checksums = sb.BlockSize, sb.Checksums
+	} else if *blockSize == 0 {
+		*blockSize = server.BlockSize
+	}
+	fm, err := file.NewFileMgrWithOptions(dir, *blockSize, file.Options{ReadOnly: true, Checksums: *checksums})
+	if err != nil {
+		return err
+	}
+	defer fm.Close()
+
+	lm, err := log.NewLogMgr(fm, *logfile)
+	if err != nil {
+		return err
+	}
+	if n := lm.DiscardedBytes(); n > 0 {
+		fmt.Fprintf(stderr, "logdump: %d bytes of torn or unfinished records at the tail are not shown\n", n)
+	}
+
+	first, err := lm.FirstLSN()
+	if err != nil {
+		return err
+	}
+	it, err := lm.SeekLSN(first)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(stdout)
+	for it.HasNext() {
+		rec, err := it.Next()
+		if err != nil {
+			return err
+		}
+		e, err := describe(lm, it.LSN(), rec)
+		if err != nil {
+			return err
+		}
+		if txFilter != nil && (e.Tx == nil || *e.Tx != *txFilter) {
+			continue
+		}
+		if *format == "json" {
+			err = enc.Encode(e)
+		} else {
+			_, err = fmt.Fprintln(stdout, e)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// describe decodes a log record into an entry.
+func describe(lm *log.LogMgr, lsn int, rec []byte) (entry, error) {
+	blk, offset, err := lm.Locate(lsn)
+	if err != nil {
+		return entry{}, err
+	}
+	e := entry{LSN: lsn, File: blk.Filename, Block: blk.Blknum, Offset: offset, Size: len(rec)}
+
+	lr, err := recovery.CreateLogRecord(rec)
+	if err != nil {
+		// Name the type of a record that recovery cannot decode if it can.
+		if op, err := file.NewPageFromBytes(rec).GetInt(0); err == nil {
+			e.Op = opNames[int(op)]
+		}
+		e.Data = rec
+		return e, nil
+	}
+	tx := lr.TxNumber()
+	e.Op, e.Tx = opNames[lr.Op()], &tx
+	if s, ok := lr.(fmt.Stringer); ok {
+		e.Text = s.String()
+	}
+	return e, nil
+}
+
+// String formats an entry as a line of text.
+func (e entry) String() string {
+	s := fmt.Sprintf("lsn=%d block=%s:%d offset=%d size=%d", e.LSN, e.File, e.Block, e.Offset, e.Size)
+	if e.Op != "" {
+		s += " op=" + e.Op
+	}
+	if e.Tx != nil {
+		s += " tx=" + strconv.Itoa(*e.Tx)
+	}
+	if e.Text != "" {
+		s += " " + e.Text
+	}
+	if e.Data != nil {
+		s += " data=" + hex.EncodeToString(e.Data)
+	}
+	return s
+}
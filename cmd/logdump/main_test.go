@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"database_design_and_implementation/internal/file"
+	"database_design_and_implementation/internal/log"
+	"database_design_and_implementation/internal/server"
+	"database_design_and_implementation/internal/tx/recovery"
+)
+
+// TestLogDump tests the text and JSON output of logdump and the transaction filter.
+func TestLogDump(t *testing.T) {
+	dir := t.TempDir()
+	fm, err := file.NewFileMgr(dir, server.BlockSize)
+	if err != nil {
+		t.Fatalf("Failed to create FileMgr: %v", err)
+	}
+	lm, err := log.NewLogMgr(fm, server.LogFile)
+	if err != nil {
+		t.Fatalf("Failed to create LogMgr: %v", err)
+	}
+	checkpoint, err := recovery.WriteCheckpointToLog(lm)
+	if err != nil {
+		t.Fatalf("Failed to write checkpoint: %v", err)
+	}
+	other, err := lm.Append([]byte("opaque record"))
+	if err != nil {
+		t.Fatalf("Failed to append log record: %v", err)
+	}
+	if err := lm.Close(); err != nil {
+		t.Fatalf("Failed to close LogMgr: %v", err)
+	}
+	if err := fm.Close(); err != nil {
+		t.Fatalf("Failed to close FileMgr: %v", err)
+	}
+
+	dump := func(args ...string) []string {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		if err := run(append(args, dir), &stdout, &stderr); err != nil {
+			t.Fatalf("logdump %v failed: %v\n%s", args, err, stderr.String())
+		}
+		return strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	}
+
+	lines := dump()
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 records, got %q", lines)
+	}
+	if !strings.HasPrefix(lines[0], "lsn=") || !strings.HasSuffix(lines[0], "op=CHECKPOINT tx=-1 <CHECKPOINT>") {
+		t.Fatalf("Expected a decoded checkpoint, got %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "size=13") || !strings.Contains(lines[1], "data=") {
+		t.Fatalf("Expected the raw bytes of an unknown record, got %q", lines[1])
+	}
+
+	lines = dump("-format", "json")
+	var entries []entry
+	for _, line := range lines {
+		var e entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("Failed to parse %q: %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 2 || entries[0].LSN != checkpoint || entries[1].LSN != other {
+		t.Fatalf("Expected records at LSNs %d and %d, got %+v", checkpoint, other, entries)
+	}
+	if entries[0].Op != "CHECKPOINT" || string(entries[1].Data) != "opaque record" {
+		t.Fatalf("Unexpected JSON records %+v", entries)
+	}
+
+	lines = dump("-tx", "-1")
+	if len(lines) != 1 || !strings.Contains(lines[0], "<CHECKPOINT>") {
+		t.Fatalf("Expected only the checkpoint for tx -1, got %q", lines)
+	}
+}
+
+// TestLogDumpRecoveryRecords tests that logdump decodes the records written
+// by the recovery manager and filters them by transaction.
+func TestLogDumpRecoveryRecords(t *testing.T) {
+	dir := t.TempDir()
+	fm, err := file.NewFileMgr(dir, server.BlockSize)
+	if err != nil {
+		t.Fatalf("Failed to create FileMgr: %v", err)
+	}
+	lm, err := log.NewLogMgr(fm, server.LogFile)
+	if err != nil {
+		t.Fatalf("Failed to create LogMgr: %v", err)
+	}
+	blk := file.NewBlockId("accounts.tbl", 3)
+	for _, write := range []func() (int, error){
+		func() (int, error) { return recovery.WriteStartToLog(lm, 7) },
+		func() (int, error) { return recovery.WriteStartToLog(lm, 300) },
+		func() (int, error) { return recovery.WriteSetIntToLog(lm, 7, blk, 8, 100, 150) },
+		func() (int, error) { return recovery.WriteSetStringToLog(lm, 300, blk, 40, "old", "new") },
+		func() (int, error) { return recovery.WriteCommitToLog(lm, 7) },
+		func() (int, error) { return recovery.WriteRollbackToLog(lm, 300) },
+	} {
+		if _, err := write(); err != nil {
+			t.Fatalf("Failed to write log record: %v", err)
+		}
+	}
+	if err := lm.Close(); err != nil {
+		t.Fatalf("Failed to close LogMgr: %v", err)
+	}
+	if err := fm.Close(); err != nil {
+		t.Fatalf("Failed to close FileMgr: %v", err)
+	}
+
+	dump := func(args ...string) []string {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		if err := run(append(args, dir), &stdout, &stderr); err != nil {
+			t.Fatalf("logdump %v failed: %v\n%s", args, err, stderr.String())
+		}
+		return strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	}
+
+	for tx, want := range map[string][]string{
+		"7": {
+			"op=START tx=7 <START 7>",
+			"op=SETINT tx=7 <SETINT 7 " + blk.String() + " 8 100 150>",
+			"op=COMMIT tx=7 <COMMIT 7>",
+		},
+		"300": {
+			"op=START tx=300 <START 300>",
+			"op=SETSTRING tx=300 <SETSTRING 300 " + blk.String() + ` 40 "old" "new">`,
+			"op=ROLLBACK tx=300 <ROLLBACK 300>",
+		},
+	} {
+		lines := dump("-tx", tx)
+		if len(lines) != len(want) {
+			t.Fatalf("Expected %d records of tx %s, got %q", len(want), tx, lines)
+		}
+		for i, line := range lines {
+			if !strings.HasSuffix(line, want[i]) {
+				t.Fatalf("Expected record %d of tx %s to end with %q, got %q", i, tx, want[i], line)
+			}
+		}
+	}
+	if lines := dump(); len(lines) != 6 {
+		t.Fatalf("Expected 6 records, got %q", lines)
+	}
+}
@@ -0,0 +1,244 @@
+// Command pageinspect shows what is stored in the blocks of a database file.
+//
+// Usage:
+//
+//	pageinspect [flags] <dbdir> <file>
+//
+// Without -blocks, every block of the file is summarized on one line. With
+// -blocks, each selected block is shown in full: its checksum, the fields
+// given by -fields, its log records if -log is set, and a hex dump. The
+// database is opened read-only.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"database_design_and_implementation/internal/file"
+	"database_design_and_implementation/internal/log"
+	"database_design_and_implementation/internal/server"
+)
+
+// field is a value to decode from a page: an int or a string at an offset.
+type field struct {
+	kind   string
+	offset int
+}
+
+// options are the settings of an inspection.
+type options struct {
+	filename  string
+	first     int
+	last      int
+	summary   bool
+	fields    []field
+	logLayout bool
+	hexDump   bool
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "pageinspect:", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the command line and inspects the file it names.
+func run(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("pageinspect", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: pageinspect [flags] <dbdir> <file>")
+		fs.PrintDefaults()
+	}
+	blocks := fs.String("blocks", "", "block `N` or range N-M to show in full; all blocks are summarized if empty")
+	fieldSpec := fs.String("fields", "", "comma-separated `list` of int:OFFSET and string:OFFSET fields to decode")
+	logLayout := fs.Bool("log", false, "decode blocks as log pages")
+	hexDump := fs.Bool("hex", true, "print a hex dump of each block shown in full")
+	blockSize := fs.Int("blocksize", 0, "block size, if the database has no superblock (default "+strconv.Itoa(server.BlockSize)+")")
+	checksums := fs.Bool("checksums", false, "whether blocks carry checksums, if the database has no superblock")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	dir := fs.Arg(0)
+	opts := options{filename: fs.Arg(1), logLayout: *logLayout, hexDump: *hexDump}
+
+	fields, err := parseFields(*fieldSpec)
+	if err != nil {
+		return err
+	}
+	opts.fields = fields
+
+	// The database must be opened with the settings it was created with.
+	sb, err := file.ReadSuperblock(dir, nil)
+	if err != nil {
+		return err
+	}
+	if sb != nil {
+		*blockSize, *checksums = sb.BlockSize, sb.Checksums
+		fmt.Fprintf(stdout, "database %s: superblock %s\n", dir, sb)
+	} else {
+		if *blockSize == 0 {
+			*blockSize = server.BlockSize
+		}
+		fmt.Fprintf(stdout, "database %s: no superblock, block size %d, checksums %t\n", dir, *blockSize, *checksums)
+	}
+	fm, err := file.NewFileMgrWithOptions(dir, *blockSize, file.Options{ReadOnly: true, Checksums: *checksums})
+	if err != nil {
+		return err
+	}
+	defer fm.Close()
+
+	length, err := fm.Length(opts.filename)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "file %s: %d blocks of %d bytes, page size %d\n", opts.filename, length, *blockSize, fm.BlockSize())
+
+	if *blocks == "" {
+		opts.first, opts.last, opts.summary = 0, length-1, true
+	} else if opts.first, opts.last, err = parseRange(*blocks, length); err != nil {
+		return err
+	}
+	return inspect(stdout, fm, opts)
+}
+
+// inspect prints the blocks selected by opts.
+func inspect(w io.Writer, fm *file.FileMgr, opts options) error {
+	page := file.NewPage(fm.BlockSize())
+	for blknum := opts.first; blknum <= opts.last; blknum++ {
+		blk := file.NewBlockId(opts.filename, blknum)
+		checksum := "no checksum"
+		var cerr *file.ChecksumError
+		switch err := fm.Read(blk, page.Contents()); {
+		case errors.As(err, &cerr):
+			checksum = fmt.Sprintf("checksum mismatch: stored %08x, computed %08x", cerr.Stored, cerr.Computed)
+		case err != nil:
+			return err
+		case fm.Superblock().Checksums:
+			checksum = "checksum ok"
+		}
+
+		if opts.summary {
+			fmt.Fprintln(w, summarize(blk, page, checksum, opts.logLayout))
+			continue
+		}
+		fmt.Fprintf(w, "\nblock %d\n  %s\n", blknum, checksum)
+		for _, f := range opts.fields {
+			fmt.Fprintf(w, "  %s\n", decodeField(page, f))
+		}
+		if opts.logLayout {
+			printLogPage(w, blk, page)
+		}
+		if opts.hexDump {
+			for _, line := range strings.SplitAfter(hex.Dump(page.Contents()), "\n") {
+				if line != "" {
+					fmt.Fprint(w, "  ", line)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// summarize describes a block in one line.
+func summarize(blk file.BlockId, page *file.Page, checksum string, logLayout bool) string {
+	used := 0
+	for _, b := range page.Contents() {
+		if b != 0 {
+			used++
+		}
+	}
+	s := fmt.Sprintf("block %d: %s, %d non-zero bytes", blk.Blknum, checksum, used)
+	if logLayout {
+		boundary, frags, err := log.Fragments(page, blk)
+		s += fmt.Sprintf(", log boundary %d, %d fragments", boundary, len(frags))
+		if err != nil {
+			s += ", " + err.Error()
+		}
+	}
+	return s
+}
+
+// printLogPage lists the fragments of a log page, newest first.
+func printLogPage(w io.Writer, blk file.BlockId, page *file.Page) {
+	boundary, frags, err := log.Fragments(page, blk)
+	fmt.Fprintf(w, "  log boundary %d\n", boundary)
+	for _, f := range frags {
+		fmt.Fprintf(w, "    offset %d: %s, %d bytes\n", f.Offset, f.Kind, f.Size)
+	}
+	if err != nil {
+		fmt.Fprintf(w, "    %v\n", err)
+	}
+}
+
+// decodeField formats the value of a field of a page.
+func decodeField(page *file.Page, f field) string {
+	var val any
+	var err error
+	switch f.kind {
+	case "int":
+		val, err = page.GetInt(f.offset)
+	case "string":
+		var s string
+		s, err = page.GetString(f.offset)
+		val = strconv.Quote(s)
+	}
+	if err != nil {
+		return fmt.Sprintf("%s@%d: %v", f.kind, f.offset, err)
+	}
+	return fmt.Sprintf("%s@%d = %v", f.kind, f.offset, val)
+}
+
+// parseFields parses a list of fields such as "int:0,string:4".
+func parseFields(spec string) ([]field, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	var fields []field
+	for _, item := range strings.Split(spec, ",") {
+		kind, off, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok || (kind != "int" && kind != "string") {
+			return nil, fmt.Errorf("invalid field %q, want int:OFFSET or string:OFFSET", item)
+		}
+		offset, err := strconv.Atoi(off)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid offset in field %q", item)
+		}
+		fields = append(fields, field{kind: kind, offset: offset})
+	}
+	return fields, nil
+}
+
+// parseRange parses a block number or a range of blocks such as "2-5", which
+// must lie within a file of length blocks.
+func parseRange(spec string, length int) (int, int, error) {
+	lo, hi, isRange := strings.Cut(spec, "-")
+	first, err := strconv.Atoi(lo)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid block range %q", spec)
+	}
+	last := first
+	if isRange {
+		if last, err = strconv.Atoi(hi); err != nil {
+			return 0, 0, fmt.Errorf("invalid block range %q", spec)
+		}
+	}
+	if first < 0 || first > last || last >= length {
+		return 0, 0, fmt.Errorf("block range %q is outside the file's %d blocks", spec, length)
+	}
+	return first, last, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"database_design_and_implementation/internal/file"
+	"database_design_and_implementation/internal/log"
+	"database_design_and_implementation/internal/server"
+)
+
+// TestPageInspect tests the summary and detailed views of data and log blocks.
+func TestPageInspect(t *testing.T) {
+	dir := t.TempDir()
+	blockSize := 128
+	fm, err := file.NewFileMgrWithOptions(dir, blockSize, file.Options{Checksums: true})
+	if err != nil {
+		t.Fatalf("Failed to create FileMgr: %v", err)
+	}
+	page := file.NewPage(fm.BlockSize())
+	page.SetInt(0, 42)
+	page.SetString(4, "hello")
+	for i := 0; i < 2; i++ {
+		if _, err := fm.Append("data"); err != nil {
+			t.Fatalf("Failed to append block: %v", err)
+		}
+	}
+	if err := fm.Write(file.NewBlockId("data", 0), page.Contents()); err != nil {
+		t.Fatalf("Failed to write block: %v", err)
+	}
+	lm, err := log.NewLogMgr(fm, server.LogFile)
+	if err != nil {
+		t.Fatalf("Failed to create LogMgr: %v", err)
+	}
+	if _, err := lm.Append([]byte("one")); err != nil {
+		t.Fatalf("Failed to append log record: %v", err)
+	}
+	if err := lm.Close(); err != nil {
+		t.Fatalf("Failed to close LogMgr: %v", err)
+	}
+	if err := fm.Close(); err != nil {
+		t.Fatalf("Failed to close FileMgr: %v", err)
+	}
+
+	// Damage block 1, which was never written, behind the FileMgr's back.
+	f, err := os.OpenFile(filepath.Join(dir, "data"), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed to open data file: %v", err)
+	}
+	if _, err := f.WriteAt([]byte{0xff}, int64(blockSize+10)); err != nil {
+		t.Fatalf("Failed to damage block: %v", err)
+	}
+	f.Close()
+
+	inspect := func(args ...string) string {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		if err := run(args, &stdout, &stderr); err != nil {
+			t.Fatalf("pageinspect %v failed: %v\n%s", args, err, stderr.String())
+		}
+		return stdout.String()
+	}
+	expect := func(out string, want ...string) {
+		t.Helper()
+		for _, w := range want {
+			if !strings.Contains(out, w) {
+				t.Fatalf("Expected %q in the output:\n%s", w, out)
+			}
+		}
+	}
+
+	out := inspect(dir, "data")
+	expect(out,
+		"superblock [format",
+		"file data: 2 blocks of 128 bytes, page size 124",
+		"block 0: checksum ok, ",
+		"block 1: checksum mismatch",
+	)
+
+	out = inspect("-blocks", "0", "-fields", "int:0,string:4", dir, "data")
+	expect(out, "int@0 = 42", `string@4 = "hello"`, "00000000  00 00 00 2a")
+	if strings.Contains(out, "block 1") {
+		t.Fatalf("Expected only block 0 to be shown:\n%s", out)
+	}
+
+	out = inspect("-log", "-hex=false", "-blocks", "0-0", dir, log.SegmentName(server.LogFile, 0))
+	expect(out, "log boundary", "whole record, 3 bytes")
+	if strings.Contains(out, "00000000") {
+		t.Fatalf("Expected no hex dump with -hex=false:\n%s", out)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := run([]string{"-blocks", "1-2", dir, "data"}, &stdout, &stderr); err == nil {
+		t.Fatalf("Expected an error for blocks past the end of the file")
+	}
+}
@@ -1,10 +1,20 @@
 package buffer
 
 import (
+	"errors"
+	"fmt"
+
 	"database_design_and_implementation/internal/file"
 	"database_design_and_implementation/internal/log"
 )
 
+var (
+	// ErrFlushFailed wraps the error of a failed write of a buffer to disk.
+	ErrFlushFailed = errors.New("buffer flush failed")
+	// ErrReadFailed wraps the error of a failed read of a block into a buffer.
+	ErrReadFailed = errors.New("buffer read failed")
+)
+
 type Buffer struct {
 	fm       *file.FileMgr
 	lm       *log.LogMgr
@@ -54,23 +64,40 @@ func (b *Buffer) ModifyingTx() int {
 	return b.txnum
 }
 
-// AssignToBlock assigns the buffer to a block and reads its contents.
-func (b *Buffer) AssignToBlock(blk *file.BlockId) {
-	b.Flush()
-	b.blk = blk
-	b.fm.Read(*blk, b.contents.Contents())
+// AssignToBlock assigns the buffer to a block and reads its contents. If the
+// old contents cannot be flushed, the buffer keeps its old block. If the new
+// block cannot be read, the buffer is left unassigned.
+func (b *Buffer) AssignToBlock(blk *file.BlockId) error {
+	if err := b.Flush(); err != nil {
+		return err
+	}
+	b.blk = nil
 	b.pins = 0
+	if err := b.fm.Read(*blk, b.contents.Contents()); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrReadFailed, blk, err)
+	}
+	b.blk = blk
+	return nil
 }
 
-func (b *Buffer) Flush() {
+// Flush writes the buffer to disk if it has been modified. The log records
+// up to the buffer's LSN are flushed first, and both writes are made durable
+// according to the sync policy of the file manager. If any step fails, the
+// buffer stays modified so that the flush can be retried.
+func (b *Buffer) Flush() error {
 	if b.txnum >= 0 && b.blk != nil {
-		b.lm.Flush(b.lsn)
-		err := b.fm.Write(*b.blk, b.contents.Contents())
-		if err != nil {
-			panic("Flush failed: " + err.Error())
+		if err := b.lm.Flush(b.lsn); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrFlushFailed, b.blk, err)
+		}
+		if err := b.fm.Write(*b.blk, b.contents.Contents()); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrFlushFailed, b.blk, err)
+		}
+		if err := b.fm.Sync(b.blk.Filename); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrFlushFailed, b.blk, err)
 		}
 		b.txnum = -1
 	}
+	return nil
 }
 
 // Pin increases the pin count of the buffer.
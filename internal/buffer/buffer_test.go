@@ -1,23 +1,35 @@
 package buffer
 
 import (
+	"errors"
+	"syscall"
 	"testing"
 
 	"database_design_and_implementation/internal/file"
+	"database_design_and_implementation/internal/file/faultfs"
 	"database_design_and_implementation/internal/log"
 )
 
 // setupTestBuffer sets up a buffer for testing.
 func setupTestBuffer(t *testing.T) (*Buffer, *file.FileMgr, *file.BlockId, []byte) {
 	blockSize := 1024
-	fm, err := file.NewFileMgr("../../temp", blockSize)
+	fm, err := file.NewFileMgrWithOptions("testdb", blockSize, file.Options{Storage: file.NewMemStorage()})
 	if err != nil {
 		t.Fatalf("Failed to create FileMgr: %v", err)
 	}
+	t.Cleanup(func() { fm.Close() })
 
-	lm := log.NewLogMgr(fm, "logfile-buffer")
+	lm, err := log.NewLogMgr(fm, "logfile-buffer")
+	if err != nil {
+		t.Fatalf("Failed to create LogMgr: %v", err)
+	}
 	buffer := NewBuffer(fm, lm)
-	blk := file.NewBlockId("logfile-buffer", 1)
+	var blk file.BlockId
+	for i := 0; i < 2; i++ {
+		if blk, err = fm.Append("datafile-buffer"); err != nil {
+			t.Fatalf("Failed to append block: %v", err)
+		}
+	}
 
 	testData := []byte("test_record")
 
@@ -29,7 +41,9 @@ func TestBuffer(t *testing.T) {
 	t.Run("Test Block Assignment", func(t *testing.T) {
 		buffer, _, blk, _ := setupTestBuffer(t)
 
-		buffer.AssignToBlock(blk)
+		if err := buffer.AssignToBlock(blk); err != nil {
+			t.Fatalf("Failed to assign block: %v", err)
+		}
 		if buffer.Block() == nil || *buffer.Block() != *blk {
 			t.Fatalf("Buffer block assignment failed. Expected: %+v, Got: %+v", *blk, buffer.Block())
 		}
@@ -38,7 +52,9 @@ func TestBuffer(t *testing.T) {
 	t.Run("Test Data Write and Flush", func(t *testing.T) {
 		buffer, fm, blk, testData := setupTestBuffer(t)
 
-		buffer.AssignToBlock(blk)
+		if err := buffer.AssignToBlock(blk); err != nil {
+			t.Fatalf("Failed to assign block: %v", err)
+		}
 
 		err := buffer.Contents().SetBytes(100, testData)
 		if err != nil {
@@ -46,7 +62,9 @@ func TestBuffer(t *testing.T) {
 		}
 		buffer.SetModified(1, 100)
 
-		buffer.Flush()
+		if err := buffer.Flush(); err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
 
 		page := file.NewPage(fm.BlockSize())
 		err = fm.Read(*blk, page.Contents())
@@ -89,3 +107,144 @@ func TestBuffer(t *testing.T) {
 
 	t.Log("TestBuffer passed successfully.")
 }
+
+// TestBufferFlushWriteAheadRule crashes the storage in the middle of Buffer.Flush
+// and checks that a data block never reaches the disk before its log record.
+func TestBufferFlushWriteAheadRule(t *testing.T) {
+	blockSize := 1024
+	cases := []struct {
+		name  string
+		tearN int
+		keep  int
+	}{
+		{"Log write torn", 1, blockSize / 2},
+		{"Log written, data write lost", 2, 0},
+		{"Data write completes before power fails", 2, blockSize},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			st, err := faultfs.New(file.NewMemStorage())
+			if err != nil {
+				t.Fatalf("Failed to create fault storage: %v", err)
+			}
+			fm, err := file.NewFileMgrWithOptions("testdb", blockSize, file.Options{Storage: st})
+			if err != nil {
+				t.Fatalf("Failed to create FileMgr: %v", err)
+			}
+			lm, err := log.NewLogMgr(fm, "logfile-wal")
+			if err != nil {
+				t.Fatalf("Failed to create LogMgr: %v", err)
+			}
+
+			blk, err := fm.Append("datafile-wal")
+			if err != nil {
+				t.Fatalf("Failed to append block: %v", err)
+			}
+			if err := fm.Sync("datafile-wal"); err != nil {
+				t.Fatalf("Failed to sync block: %v", err)
+			}
+
+			buffer := NewBuffer(fm, lm)
+			if err := buffer.AssignToBlock(&blk); err != nil {
+				t.Fatalf("Failed to assign block: %v", err)
+			}
+			lsn, err := lm.Append([]byte("update"))
+			if err != nil {
+				t.Fatalf("Failed to append log record: %v", err)
+			}
+			if err := buffer.Contents().SetString(0, "updated"); err != nil {
+				t.Fatalf("Failed to write data to page: %v", err)
+			}
+			buffer.SetModified(1, lsn)
+
+			st.TearWrite(tc.tearN, tc.keep)
+			if err := buffer.Flush(); !errors.Is(err, ErrFlushFailed) || !errors.Is(err, faultfs.ErrCrashed) {
+				t.Fatalf("Expected ErrFlushFailed wrapping ErrCrashed from the torn flush, got %v", err)
+			}
+
+			img, err := st.Crash()
+			if err != nil {
+				t.Fatalf("Crash failed: %v", err)
+			}
+			reopened, err := file.NewFileMgrWithOptions("testdb", blockSize, file.Options{Storage: img})
+			if err != nil {
+				t.Fatalf("Failed to reopen FileMgr: %v", err)
+			}
+
+			page := file.NewPage(blockSize)
+			if err := reopened.Read(blk, page.Contents()); err != nil {
+				t.Fatalf("Failed to read from disk: %v", err)
+			}
+			if s, _ := page.GetString(0); s != "updated" {
+				return
+			}
+
+			relm, err := log.NewLogMgr(reopened, "logfile-wal")
+			if err != nil {
+				t.Fatalf("Failed to reopen LogMgr: %v", err)
+			}
+			iter, err := relm.Iterator()
+			if err != nil {
+				t.Fatalf("Failed to create LogIterator: %v", err)
+			}
+			rec, err := iter.Next()
+			if err != nil || string(rec) != "update" {
+				t.Fatalf("Data block reached the disk without its log record: got %q (err %v)", rec, err)
+			}
+		})
+	}
+}
+
+// TestBufferFlushError tests that failed reads and writes are returned, and
+// that a failed flush leaves the buffer modified so it can be retried.
+func TestBufferFlushError(t *testing.T) {
+	blockSize := 1024
+	st, err := faultfs.New(file.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create fault storage: %v", err)
+	}
+	fm, err := file.NewFileMgrWithOptions("testdb", blockSize, file.Options{Storage: st})
+	if err != nil {
+		t.Fatalf("Failed to create FileMgr: %v", err)
+	}
+	lm, err := log.NewLogMgr(fm, "logfile-eio")
+	if err != nil {
+		t.Fatalf("Failed to create LogMgr: %v", err)
+	}
+	bm := NewBufferMgr(fm, lm, 1)
+
+	missing := file.NewBlockId("datafile-eio", 0)
+	if _, err := bm.Pin(&missing); !errors.Is(err, ErrReadFailed) {
+		t.Fatalf("Expected ErrReadFailed for a block past the end of its file, got %v", err)
+	}
+
+	blk, err := fm.Append("datafile-eio")
+	if err != nil {
+		t.Fatalf("Failed to append block: %v", err)
+	}
+	buff, err := bm.Pin(&blk)
+	if err != nil {
+		t.Fatalf("Failed to pin block: %v", err)
+	}
+	lsn, err := lm.Append([]byte("update"))
+	if err != nil {
+		t.Fatalf("Failed to append log record: %v", err)
+	}
+	buff.SetModified(1, lsn)
+
+	st.FailWrite(1)
+	err = bm.FlushAll(1)
+	if !errors.Is(err, ErrFlushFailed) || !errors.Is(err, log.ErrWriteFailed) || !errors.Is(err, syscall.EIO) {
+		t.Fatalf("Expected ErrFlushFailed wrapping the log's EIO, got %v", err)
+	}
+	if buff.ModifyingTx() != 1 {
+		t.Fatalf("Expected the buffer to stay modified after a failed flush")
+	}
+	if err := bm.FlushAll(1); err != nil {
+		t.Fatalf("Expected a retried flush to succeed, got %v", err)
+	}
+	if buff.ModifyingTx() != -1 {
+		t.Fatalf("Expected the buffer to be flushed")
+	}
+}
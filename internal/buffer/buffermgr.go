@@ -11,10 +11,18 @@ import (
 
 const maxWaitTime = 5 * time.Millisecond
 
+var (
+	// ErrClosed is returned by operations on a BufferMgr that has been closed.
+	ErrClosed = errors.New("buffer manager is closed")
+	// ErrBufferTimeout is returned by Pin when no buffer becomes available in time.
+	ErrBufferTimeout = errors.New("buffer allocation timeout")
+)
+
 // BufferMgr manages the pinning and unpinning of buffers to blocks.
 type BufferMgr struct {
 	bufferPool   []*Buffer
 	numAvailable int
+	closed       bool
 	mutex        sync.Mutex
 }
 
@@ -37,14 +45,60 @@ func (bm *BufferMgr) Available() int {
 }
 
 // FlushAll flushes the dirty buffers modified by the specified transaction.
-func (bm *BufferMgr) FlushAll(txNum int) {
+// Every buffer is tried even if an earlier one fails, and the errors are joined.
+func (bm *BufferMgr) FlushAll(txNum int) error {
 	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
+
+	if bm.closed {
+		return ErrClosed
+	}
+	var errs []error
 	for _, buff := range bm.bufferPool {
 		if buff.ModifyingTx() == txNum {
-			buff.Flush()
+			errs = append(errs, buff.Flush())
 		}
 	}
-	bm.mutex.Unlock()
+	return errors.Join(errs...)
+}
+
+// Close flushes every modified buffer to disk. Any later call to Pin or
+// FlushAll fails with ErrClosed. If a buffer cannot be flushed, the errors
+// are joined and the buffer manager stays open, so that Close can be retried.
+func (bm *BufferMgr) Close() error {
+	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
+
+	if bm.closed {
+		return ErrClosed
+	}
+	if err := bm.flushDirty(); err != nil {
+		return err
+	}
+	bm.closed = true
+	return nil
+}
+
+// FlushDirty writes every modified buffer to disk, whichever transaction
+// modified it. If a buffer cannot be flushed, the errors are joined.
+func (bm *BufferMgr) FlushDirty() error {
+	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
+
+	if bm.closed {
+		return ErrClosed
+	}
+	return bm.flushDirty()
+}
+
+// flushDirty writes every modified buffer to disk. It is called with
+// bm.mutex held.
+func (bm *BufferMgr) flushDirty() error {
+	var errs []error
+	for _, buff := range bm.bufferPool {
+		errs = append(errs, buff.Flush())
+	}
+	return errors.Join(errs...)
 }
 
 // Unpin unpins the specified buffer. If its pin count goes to zero, it notifies waiting threads.
@@ -64,37 +118,47 @@ func (bm *BufferMgr) Pin(blk *file.BlockId) (*Buffer, error) {
 
 	for {
 		bm.mutex.Lock()
-		buff := bm.tryToPin(blk)
+		if bm.closed {
+			bm.mutex.Unlock()
+			return nil, ErrClosed
+		}
+		buff, err := bm.tryToPin(blk)
 		bm.mutex.Unlock()
 
+		if err != nil {
+			return nil, err
+		}
 		if buff != nil {
 			return buff, nil
 		}
 
 		if time.Since(startTime) >= maxWaitTime {
-			return nil, errors.New("buffer allocation timeout")
+			return nil, ErrBufferTimeout
 		}
 
 		time.Sleep(10 * time.Millisecond)
 	}
 }
 
-// tryToPin tries to pin a buffer to the specified block.
-func (bm *BufferMgr) tryToPin(blk *file.BlockId) *Buffer {
+// tryToPin tries to pin a buffer to the specified block. It returns nil if
+// every buffer is pinned.
+func (bm *BufferMgr) tryToPin(blk *file.BlockId) (*Buffer, error) {
 	buff := bm.findExistingBuffer(blk)
 	if buff == nil {
 		buff = bm.chooseUnpinnedBuffer()
 		if buff == nil {
-			return nil
+			return nil, nil
+		}
+		if err := buff.AssignToBlock(blk); err != nil {
+			return nil, err
 		}
-		buff.AssignToBlock(blk)
 	}
 
 	if !buff.IsPinned() {
 		bm.numAvailable = max(0, bm.numAvailable-1)
 	}
 	buff.Pin()
-	return buff
+	return buff, nil
 }
 
 // findExistingBuffer searches for a buffer assigned to the given block.
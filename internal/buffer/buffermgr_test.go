@@ -1,6 +1,7 @@
 package buffer
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -12,14 +13,22 @@ import (
 // setupBufferMgrTest sets up a Buffer Manager test environment with a specified number of buffers.
 func setupBufferMgrTest(numBuffers int) (*BufferMgr, *file.FileMgr, *log.LogMgr, error) {
 	blockSize := 1024
-	fm, err := file.NewFileMgr("../../temp", blockSize)
+	fm, err := file.NewFileMgrWithOptions("testdb", blockSize, file.Options{Storage: file.NewMemStorage()})
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to create FileMgr: %w", err)
 	}
 
-	lm := log.NewLogMgr(fm, "logfile-buffermgr")
+	lm, err := log.NewLogMgr(fm, "logfile-buffermgr")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create LogMgr: %w", err)
+	}
 	bm := NewBufferMgr(fm, lm, numBuffers)
 
+	for i := 0; i < 3; i++ {
+		if _, err := fm.Append("datafile-buffermgr"); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to append block: %w", err)
+		}
+	}
 	return bm, fm, lm, nil
 }
 
@@ -42,8 +51,8 @@ func TestBufferMgr(t *testing.T) {
 			t.Fatalf("Failed to set up buffer manager: %v", err)
 		}
 
-		blk1 := file.NewBlockId("logfile-buffermgr", 1)
-		blk2 := file.NewBlockId("logfile-buffermgr", 2)
+		blk1 := file.NewBlockId("datafile-buffermgr", 1)
+		blk2 := file.NewBlockId("datafile-buffermgr", 2)
 
 		buff1, err := bm.Pin(&blk1)
 		if err != nil {
@@ -75,8 +84,8 @@ func TestBufferMgr(t *testing.T) {
 			t.Fatalf("Failed to set up buffer manager: %v", err)
 		}
 
-		blk1 := file.NewBlockId("logfile-buffermgr", 1)
-		blk2 := file.NewBlockId("logfile-buffermgr", 2)
+		blk1 := file.NewBlockId("datafile-buffermgr", 1)
+		blk2 := file.NewBlockId("datafile-buffermgr", 2)
 
 		_, err = bm.Pin(&blk1)
 		if err != nil {
@@ -87,13 +96,8 @@ func TestBufferMgr(t *testing.T) {
 		_, err = bm.Pin(&blk2)
 		elapsedTime := time.Since(startTime)
 
-		wantErr := "buffer allocation timeout"
-		if err == nil {
-			t.Fatalf("Expected error: %v, but got none", wantErr)
-		}
-
-		if err.Error() != wantErr {
-			t.Fatalf("Expected error: %v, but got: %v", wantErr, err)
+		if !errors.Is(err, ErrBufferTimeout) {
+			t.Fatalf("Expected error: %v, but got: %v", ErrBufferTimeout, err)
 		}
 
 		if elapsedTime < maxWaitTime {
@@ -107,8 +111,8 @@ func TestBufferMgr(t *testing.T) {
 			t.Fatalf("Failed to set up buffer manager: %v", err)
 		}
 
-		blk1 := file.NewBlockId("logfile-buffermgr", 1)
-		blk2 := file.NewBlockId("logfile-buffermgr", 2)
+		blk1 := file.NewBlockId("datafile-buffermgr", 1)
+		blk2 := file.NewBlockId("datafile-buffermgr", 2)
 
 		buff1, err := bm.Pin(&blk1)
 		if err != nil {
@@ -122,7 +126,9 @@ func TestBufferMgr(t *testing.T) {
 		buff1.SetModified(1, 100)
 		buff2.SetModified(1, 200)
 
-		bm.FlushAll(1)
+		if err := bm.FlushAll(1); err != nil {
+			t.Fatalf("FlushAll failed: %v", err)
+		}
 
 		if buff1.ModifyingTx() != -1 || buff2.ModifyingTx() != -1 {
 			t.Fatalf("Expected buffers to be flushed, but modifications remain")
@@ -130,3 +136,56 @@ func TestBufferMgr(t *testing.T) {
 	})
 
 }
+
+// TestBufferMgrClose tests that Close flushes dirty buffers and rejects later calls.
+func TestBufferMgrClose(t *testing.T) {
+	blockSize := 1024
+	fm, err := file.NewFileMgrWithOptions("testdb", blockSize, file.Options{Storage: file.NewMemStorage()})
+	if err != nil {
+		t.Fatalf("Failed to create FileMgr: %v", err)
+	}
+	lm, err := log.NewLogMgr(fm, "logfile-close")
+	if err != nil {
+		t.Fatalf("Failed to create LogMgr: %v", err)
+	}
+	bm := NewBufferMgr(fm, lm, 2)
+
+	blk, err := fm.Append("datafile-close")
+	if err != nil {
+		t.Fatalf("Failed to append block: %v", err)
+	}
+	buff, err := bm.Pin(&blk)
+	if err != nil {
+		t.Fatalf("Failed to pin block: %v", err)
+	}
+	if err := buff.Contents().SetString(0, "dirty"); err != nil {
+		t.Fatalf("Failed to write data to page: %v", err)
+	}
+	buff.SetModified(1, -1)
+	bm.Unpin(buff)
+
+	if err := bm.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	page := file.NewPage(blockSize)
+	if err := fm.Read(blk, page.Contents()); err != nil {
+		t.Fatalf("Failed to read from disk: %v", err)
+	}
+	if s, _ := page.GetString(0); s != "dirty" {
+		t.Fatalf("Expected dirty buffer to be flushed on Close, got %q", s)
+	}
+
+	if _, err := bm.Pin(&blk); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Expected ErrClosed from Pin, got %v", err)
+	}
+	if err := bm.FlushAll(1); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Expected ErrClosed from FlushAll, got %v", err)
+	}
+	if err := bm.FlushDirty(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Expected ErrClosed from FlushDirty, got %v", err)
+	}
+	if err := bm.Close(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Expected ErrClosed from a second Close, got %v", err)
+	}
+}
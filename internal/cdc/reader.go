@@ -0,0 +1,269 @@
+// Package cdc captures the changes committed to the database by reading its
+// log. Transactions are turned into events in the order they committed, so
+// that downstream systems can follow the database without polling its tables.
+//
+// Changes are physical: each one names the block and offset that a SETINT or
+// SETSTRING record changed, with the values before and after the change.
+// Turning them into table rows is left to a layer that knows the record
+// layout of the blocks.
+package cdc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"database_design_and_implementation/internal/file"
+	"database_design_and_implementation/internal/log"
+	"database_design_and_implementation/internal/tx/recovery"
+)
+
+// DefaultPollInterval is how often a started Reader looks for new log records
+// when it has caught up with the log.
+const DefaultPollInterval = 100 * time.Millisecond
+
+// Position is a place in the change stream from which a Reader can resume.
+// The zero Position is the first record kept in the log.
+type Position struct {
+	// RestartLSN is the LSN from which the log must be read again: the first
+	// record of the oldest transaction that was still running.
+	RestartLSN int
+	// CommitLSN is the LSN of the COMMIT record of the last event delivered.
+	// Transactions that committed at or before it are not delivered again.
+	CommitLSN int
+}
+
+// Change is a value changed by a committed transaction. Before and After
+// hold an int for a SETINT record and a string for a SETSTRING record.
+type Change struct {
+	LSN    int
+	Block  file.BlockId
+	Offset int
+	Before any
+	After  any
+}
+
+// Event is a committed transaction and the changes it made, in log order.
+type Event struct {
+	TxNum     int
+	CommitLSN int
+	Changes   []Change
+	// Position is where to resume to receive the events after this one.
+	Position Position
+}
+
+// Options configures a Reader.
+type Options struct {
+	// PollInterval is how often a started Reader looks for new log records.
+	// Zero means DefaultPollInterval.
+	PollInterval time.Duration
+	// Buffer is the capacity of the channel returned by Start.
+	Buffer int
+}
+
+// pendingTx holds the changes of a transaction that has not finished yet.
+type pendingTx struct {
+	firstLSN int
+	changes  []Change
+}
+
+// Reader turns the records of a log into events. It must read the LogMgr the
+// database appends to, since a LogMgr only sees the records appended through
+// it after it was opened. Only the records already flushed are read, so an
+// event is never delivered for a commit that a crash could lose; a Reader does
+// not flush the log itself, and sees a commit once it has been flushed.
+//
+// A Reader holds the log from its position on, so that a checkpoint does not
+// truncate records it has yet to read, until it is closed. A position saved
+// elsewhere is not held: if the log has been truncated past it, Poll fails
+// with log.ErrLSNTruncated.
+type Reader struct {
+	lm      *log.LogMgr
+	hold    *log.Hold
+	opts    Options
+	nextLSN int
+	open    map[int]*pendingTx
+
+	// mu guards pos and err, which Position and Err read while a started
+	// Reader updates them.
+	mu  sync.Mutex
+	pos Position
+	err error
+}
+
+// NewReader creates a Reader that delivers the transactions committed after
+// the given position. The Reader must be closed when it is no longer used.
+func NewReader(lm *log.LogMgr, from Position, opts Options) *Reader {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	return &Reader{
+		lm:      lm,
+		hold:    lm.Hold(max(from.RestartLSN, 1)),
+		opts:    opts,
+		nextLSN: from.RestartLSN,
+		pos:     from,
+		open:    make(map[int]*pendingTx),
+	}
+}
+
+// Close releases the hold of the Reader on the log. A started Reader must be
+// stopped first.
+func (r *Reader) Close() error {
+	r.hold.Release()
+	return nil
+}
+
+// Position returns the position after the last event returned by Poll. The
+// events delivered by a started Reader carry their own positions.
+func (r *Reader) Position() Position {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pos
+}
+
+// Poll reads the records appended to the log since the last call and returns
+// the events of the transactions that committed in them. If reading fails,
+// Poll returns the events completed before the failure along with the error.
+func (r *Reader) Poll() ([]Event, error) {
+	if r.nextLSN == 0 {
+		first, err := r.lm.FirstLSN()
+		if err != nil {
+			return nil, err
+		}
+		r.nextLSN = first
+	}
+	// Nothing has been appended since the last call.
+	if r.lm.LatestLSN() < r.nextLSN {
+		return nil, nil
+	}
+	it, err := r.lm.SeekFlushedLSN(r.nextLSN)
+	if err != nil {
+		return nil, fmt.Errorf("cdc: read log from LSN %d: %w", r.nextLSN, err)
+	}
+	defer func() { r.hold.Advance(r.retainFrom()) }()
+
+	var events []Event
+	for it.HasNext() {
+		rec, err := it.Next()
+		if err != nil {
+			return events, err
+		}
+		lsn := it.LSN()
+		lr, err := recovery.CreateLogRecord(rec)
+		if err != nil {
+			return events, fmt.Errorf("cdc: decode log record at LSN %d: %w", lsn, err)
+		}
+		if e, ok := r.apply(lsn, lr); ok {
+			events = append(events, e)
+		}
+		r.nextLSN = lsn + 1
+	}
+	return events, nil
+}
+
+// retainFrom returns the first LSN the Reader may have to read again: the
+// start of its position, or of what it has yet to read.
+func (r *Reader) retainFrom() int {
+	if r.pos.RestartLSN > 0 {
+		return min(r.pos.RestartLSN, r.nextLSN)
+	}
+	return r.nextLSN
+}
+
+// apply adds a log record to the transaction it belongs to. It returns an
+// event if the record commits a transaction that has not been delivered.
+func (r *Reader) apply(lsn int, lr recovery.LogRecord) (Event, bool) {
+	switch rec := lr.(type) {
+	case *recovery.CheckpointRecord:
+		// Checkpoints are quiescent, so a transaction still open here was
+		// interrupted by a crash and undone by recovery.
+		clear(r.open)
+	case *recovery.StartRecord:
+		r.pending(rec.TxNumber(), lsn)
+	case *recovery.SetIntRecord:
+		if tx := r.open[rec.TxNumber()]; tx != nil {
+			tx.changes = append(tx.changes, Change{LSN: lsn, Block: rec.Block(), Offset: rec.Offset(), Before: rec.OldValue(), After: rec.NewValue()})
+		}
+	case *recovery.SetStringRecord:
+		if tx := r.open[rec.TxNumber()]; tx != nil {
+			tx.changes = append(tx.changes, Change{LSN: lsn, Block: rec.Block(), Offset: rec.Offset(), Before: rec.OldValue(), After: rec.NewValue()})
+		}
+	case *recovery.RollbackRecord:
+		delete(r.open, rec.TxNumber())
+	case *recovery.CommitRecord:
+		tx := r.open[rec.TxNumber()]
+		delete(r.open, rec.TxNumber())
+		if tx == nil || len(tx.changes) == 0 || lsn <= r.pos.CommitLSN {
+			return Event{}, false
+		}
+		pos := Position{RestartLSN: lsn + 1, CommitLSN: lsn}
+		for _, other := range r.open {
+			pos.RestartLSN = min(pos.RestartLSN, other.firstLSN)
+		}
+		r.mu.Lock()
+		r.pos = pos
+		r.mu.Unlock()
+		return Event{TxNum: rec.TxNumber(), CommitLSN: lsn, Changes: tx.changes, Position: pos}, true
+	}
+	return Event{}, false
+}
+
+// pending starts the transaction with the given number at lsn. The changes of
+// a transaction whose START record was not read, because it is before the
+// position of the Reader or was truncated, are not delivered.
+func (r *Reader) pending(txnum, lsn int) {
+	r.open[txnum] = &pendingTx{firstLSN: lsn}
+}
+
+// Start delivers events on the returned channel as transactions commit, until
+// ctx is done or reading the log fails. The channel is then closed and Err
+// reports why. A started Reader must not be polled directly.
+func (r *Reader) Start(ctx context.Context) <-chan Event {
+	ch := make(chan Event, r.opts.Buffer)
+	go func() {
+		defer close(ch)
+		err := r.run(ctx, ch)
+		r.mu.Lock()
+		r.err = err
+		r.mu.Unlock()
+	}()
+	return ch
+}
+
+// run polls the log and sends its events until ctx is done or an error occurs.
+func (r *Reader) run(ctx context.Context, ch chan<- Event) error {
+	ticker := time.NewTicker(r.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		events, err := r.Poll()
+		for _, e := range events {
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if len(events) > 0 {
+			continue
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Err returns the error that stopped a started Reader. It is only valid after
+// the channel returned by Start is closed, and is context.Canceled or
+// context.DeadlineExceeded if the Reader was stopped through its context.
+func (r *Reader) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
@@ -0,0 +1,395 @@
+package cdc
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"database_design_and_implementation/internal/file"
+	"database_design_and_implementation/internal/log"
+	"database_design_and_implementation/internal/tx/recovery"
+)
+
+// newTestLogMgr creates a LogMgr on a fresh in-memory database.
+func newTestLogMgr(t *testing.T) *log.LogMgr {
+	t.Helper()
+	return newTestLogMgrWithOptions(t, log.Options{})
+}
+
+// newTestLogMgrWithOptions creates a LogMgr with the given options on a fresh
+// in-memory database.
+func newTestLogMgrWithOptions(t *testing.T, opts log.Options) *log.LogMgr {
+	t.Helper()
+	fm, err := file.NewFileMgrWithOptions("cdcdb", 400, file.Options{Storage: file.NewMemStorage()})
+	if err != nil {
+		t.Fatalf("Failed to create FileMgr: %v", err)
+	}
+	lm, err := log.NewLogMgrWithOptions(fm, "cdclog", opts)
+	if err != nil {
+		t.Fatalf("Failed to create LogMgr: %v", err)
+	}
+	t.Cleanup(func() {
+		lm.Close()
+		fm.Close()
+	})
+	return lm
+}
+
+// newReader creates a Reader that is closed when the test ends.
+func newReader(t *testing.T, lm *log.LogMgr, from Position, opts Options) *Reader {
+	r := NewReader(lm, from, opts)
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+// mustLog returns a function that takes the results of appending a log
+// record and returns its LSN, failing the test on an error.
+func mustLog(t *testing.T) func(int, error) int {
+	return func(lsn int, err error) int {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("Failed to append log record: %v", err)
+		}
+		return lsn
+	}
+}
+
+// commit writes a COMMIT record and flushes the log, as a committing
+// transaction does, and returns the LSN of the record.
+func commit(t *testing.T, lm *log.LogMgr, txnum int) int {
+	t.Helper()
+	lsn := mustLog(t)(recovery.WriteCommitToLog(lm, txnum))
+	if err := lm.Flush(lsn); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	return lsn
+}
+
+// poll polls the reader and fails the test on an error.
+func poll(t *testing.T, r *Reader) []Event {
+	t.Helper()
+	events, err := r.Poll()
+	if err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+	return events
+}
+
+// TestReaderPoll tests that interleaved transactions are delivered in commit
+// order with their own changes, and that rolled back ones are left out.
+func TestReaderPoll(t *testing.T) {
+	lm := newTestLogMgr(t)
+	must := mustLog(t)
+	blk := file.NewBlockId("accounts.tbl", 2)
+
+	start1 := must(recovery.WriteStartToLog(lm, 1))
+	set1 := must(recovery.WriteSetIntToLog(lm, 1, blk, 0, 100, 150))
+	must(recovery.WriteStartToLog(lm, 2))
+	set2 := must(recovery.WriteSetStringToLog(lm, 2, blk, 40, "old", "new"))
+	must(recovery.WriteStartToLog(lm, 3))
+	must(recovery.WriteSetIntToLog(lm, 3, blk, 8, 1, 2))
+	must(recovery.WriteRollbackToLog(lm, 3))
+	commit2 := commit(t, lm, 2)
+
+	r := newReader(t, lm, Position{}, Options{})
+	events := poll(t, r)
+	if len(events) != 1 {
+		t.Fatalf("Expected only transaction 2 to be delivered, got %+v", events)
+	}
+	want := Event{
+		TxNum:     2,
+		CommitLSN: commit2,
+		Changes:   []Change{{LSN: set2, Block: blk, Offset: 40, Before: "old", After: "new"}},
+		// Transaction 1 is still running, so its records must be read again.
+		Position: Position{RestartLSN: start1, CommitLSN: commit2},
+	}
+	if !reflect.DeepEqual(events[0], want) {
+		t.Fatalf("Expected %+v, got %+v", want, events[0])
+	}
+	if events := poll(t, r); len(events) != 0 {
+		t.Fatalf("Expected no new events, got %+v", events)
+	}
+
+	set1b := must(recovery.WriteSetIntToLog(lm, 1, blk, 4, 0, -7))
+	commit1 := commit(t, lm, 1)
+	events = poll(t, r)
+	if len(events) != 1 || events[0].TxNum != 1 {
+		t.Fatalf("Expected transaction 1 to be delivered, got %+v", events)
+	}
+	wantChanges := []Change{
+		{LSN: set1, Block: blk, Offset: 0, Before: 100, After: 150},
+		{LSN: set1b, Block: blk, Offset: 4, Before: 0, After: -7},
+	}
+	if !reflect.DeepEqual(events[0].Changes, wantChanges) {
+		t.Fatalf("Expected changes %+v, got %+v", wantChanges, events[0].Changes)
+	}
+	if want := (Position{RestartLSN: commit1 + 1, CommitLSN: commit1}); r.Position() != want || events[0].Position != want {
+		t.Fatalf("Expected position %+v, got %+v", want, r.Position())
+	}
+}
+
+// TestReaderResume tests that a Reader resumed from the position of an event
+// delivers each later transaction exactly once.
+func TestReaderResume(t *testing.T) {
+	lm := newTestLogMgr(t)
+	must := mustLog(t)
+	blk := file.NewBlockId("students.tbl", 0)
+
+	must(recovery.WriteStartToLog(lm, 1))
+	must(recovery.WriteSetIntToLog(lm, 1, blk, 0, 0, 1))
+	must(recovery.WriteStartToLog(lm, 2))
+	must(recovery.WriteSetIntToLog(lm, 2, blk, 4, 0, 2))
+	commit(t, lm, 2)
+	must(recovery.WriteStartToLog(lm, 3))
+	must(recovery.WriteSetIntToLog(lm, 3, blk, 8, 0, 3))
+	commit(t, lm, 3)
+	commit(t, lm, 1)
+
+	all := poll(t, newReader(t, lm, Position{}, Options{}))
+	if len(all) != 3 {
+		t.Fatalf("Expected 3 events, got %+v", all)
+	}
+	for i, e := range all {
+		resumed := append([]Event{}, poll(t, newReader(t, lm, e.Position, Options{}))...)
+		if !reflect.DeepEqual(resumed, all[i+1:]) {
+			t.Fatalf("Resuming after event %d: expected %+v, got %+v", i, all[i+1:], resumed)
+		}
+	}
+}
+
+// TestReaderIgnoresUnfinished tests that changes of a transaction interrupted
+// by a crash are dropped at the checkpoint written by recovery.
+func TestReaderIgnoresUnfinished(t *testing.T) {
+	lm := newTestLogMgr(t)
+	must := mustLog(t)
+	blk := file.NewBlockId("t.tbl", 1)
+
+	must(recovery.WriteStartToLog(lm, 1))
+	must(recovery.WriteSetIntToLog(lm, 1, blk, 0, 0, 9))
+	must(recovery.WriteCheckpointToLog(lm))
+	// Transaction numbers are reused after a restart.
+	must(recovery.WriteStartToLog(lm, 1))
+	must(recovery.WriteSetIntToLog(lm, 1, blk, 4, 0, 5))
+	commit(t, lm, 1)
+	// A transaction that changed nothing has no event.
+	must(recovery.WriteStartToLog(lm, 2))
+	commit(t, lm, 2)
+
+	events := poll(t, newReader(t, lm, Position{}, Options{}))
+	if len(events) != 1 || len(events[0].Changes) != 1 || events[0].Changes[0].Offset != 4 {
+		t.Fatalf("Expected only the change made after the checkpoint, got %+v", events)
+	}
+}
+
+// TestReaderBadRecord tests that a record the reader cannot decode is reported.
+func TestReaderBadRecord(t *testing.T) {
+	lm := newTestLogMgr(t)
+	must := mustLog(t)
+	must(recovery.WriteStartToLog(lm, 1))
+	bad := must(lm.Append([]byte("not a log record")))
+	if err := lm.Flush(bad); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	if _, err := newReader(t, lm, Position{}, Options{}).Poll(); err == nil {
+		t.Fatalf("Expected an error for an unknown log record")
+	}
+}
+
+// TestReaderReadsFlushedRecords tests that Poll delivers only the commits
+// that have been flushed, and does not flush the log itself.
+func TestReaderReadsFlushedRecords(t *testing.T) {
+	fm, err := file.NewFileMgrWithOptions("cdcdb", 400, file.Options{Storage: file.NewMemStorage()})
+	if err != nil {
+		t.Fatalf("Failed to create FileMgr: %v", err)
+	}
+	defer fm.Close()
+	lm, err := log.NewLogMgr(fm, "cdclog")
+	if err != nil {
+		t.Fatalf("Failed to create LogMgr: %v", err)
+	}
+	defer lm.Close()
+	must := mustLog(t)
+	blk := file.NewBlockId("t.tbl", 0)
+	r := newReader(t, lm, Position{}, Options{})
+
+	commitTxs(t, lm, 1, 2)
+	must(recovery.WriteStartToLog(lm, 3))
+	must(recovery.WriteSetIntToLog(lm, 3, blk, 0, 2, 3))
+	unflushed := must(recovery.WriteCommitToLog(lm, 3))
+
+	writes := fm.Stats().Total.Writes
+	events := poll(t, r)
+	if len(events) != 2 || events[1].TxNum != 2 {
+		t.Fatalf("Expected the 2 flushed transactions, got %+v", events)
+	}
+	if got := fm.Stats().Total.Writes; got != writes {
+		t.Fatalf("Expected Poll not to write the log, it made %d writes", got-writes)
+	}
+	if events := poll(t, r); len(events) != 0 {
+		t.Fatalf("Expected no events before the commit is flushed, got %+v", events)
+	}
+
+	if err := lm.Flush(unflushed); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	events = poll(t, r)
+	if len(events) != 1 || events[0].TxNum != 3 || events[0].CommitLSN != unflushed {
+		t.Fatalf("Expected transaction 3 once its commit is flushed, got %+v", events)
+	}
+}
+
+// TestReaderStart tests that a started Reader delivers transactions on its
+// channel as they commit and stops when its context is canceled.
+func TestReaderStart(t *testing.T) {
+	lm := newTestLogMgr(t)
+	must := mustLog(t)
+	blk := file.NewBlockId("t.tbl", 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := newReader(t, lm, Position{}, Options{PollInterval: time.Millisecond})
+	events := r.Start(ctx)
+
+	for tx := 1; tx <= 3; tx++ {
+		must(recovery.WriteStartToLog(lm, tx))
+		must(recovery.WriteSetIntToLog(lm, tx, blk, 0, tx-1, tx))
+		commit := commit(t, lm, tx)
+		select {
+		case e := <-events:
+			if e.TxNum != tx || e.CommitLSN != commit {
+				t.Fatalf("Expected transaction %d committed at LSN %d, got %+v", tx, commit, e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for transaction %d", tx)
+		}
+	}
+
+	cancel()
+	for range events {
+	}
+	if err := r.Err(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the reader to stop with context.Canceled, got %v", err)
+	}
+}
+
+// TestReaderStartPosition tests that Position and Err can be called while a
+// started Reader is delivering events. Run with -race.
+func TestReaderStartPosition(t *testing.T) {
+	lm := newTestLogMgr(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := newReader(t, lm, Position{}, Options{PollInterval: time.Millisecond})
+	events := r.Start(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ctx.Err() == nil {
+			r.Position()
+			r.Err()
+		}
+	}()
+
+	last := commitTxs(t, lm, 1, 20)
+	for e := range events {
+		if e.CommitLSN == last {
+			break
+		}
+	}
+	if pos := r.Position(); pos.CommitLSN != last {
+		t.Fatalf("Expected the position after commit %d, got %+v", last, pos)
+	}
+	cancel()
+	for range events {
+	}
+	<-done
+	if err := r.Err(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the reader to stop with context.Canceled, got %v", err)
+	}
+}
+
+// commitTxs writes transactions first to first+n-1, each changing one integer,
+// and returns the LSN of the last record.
+func commitTxs(t *testing.T, lm *log.LogMgr, first, n int) int {
+	t.Helper()
+	must := mustLog(t)
+	blk := file.NewBlockId("t.tbl", 0)
+	lsn := 0
+	for tx := first; tx < first+n; tx++ {
+		must(recovery.WriteStartToLog(lm, tx))
+		must(recovery.WriteSetIntToLog(lm, tx, blk, 0, tx-1, tx))
+		lsn = commit(t, lm, tx)
+	}
+	return lsn
+}
+
+// checkpoint writes a checkpoint and truncates the log before it.
+func checkpoint(t *testing.T, lm *log.LogMgr) {
+	t.Helper()
+	lsn := mustLog(t)(recovery.WriteCheckpointToLog(lm))
+	if err := lm.Truncate(lsn); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+}
+
+// TestReaderTruncated tests that a Reader resumed from a position that the
+// log has been truncated past reports it, and that one started from the zero
+// Position delivers only the whole transactions left in the log.
+func TestReaderTruncated(t *testing.T) {
+	lm := newTestLogMgrWithOptions(t, log.Options{SegmentBlocks: 1})
+	commitTxs(t, lm, 1, 30)
+	all := poll(t, newReader(t, lm, Position{}, Options{}))
+	if len(all) != 30 {
+		t.Fatalf("Expected 30 events, got %d", len(all))
+	}
+	checkpoint(t, lm)
+
+	if _, err := newReader(t, lm, all[0].Position, Options{}).Poll(); !errors.Is(err, log.ErrLSNTruncated) {
+		t.Fatalf("Expected log.ErrLSNTruncated resuming from a truncated position, got %v", err)
+	}
+
+	kept := poll(t, newReader(t, lm, Position{}, Options{}))
+	if len(kept) == 0 || len(kept) >= len(all) {
+		t.Fatalf("Expected some but not all of the %d events after truncation, got %d", len(all), len(kept))
+	}
+	for _, e := range kept {
+		if want := all[e.TxNum-1]; !reflect.DeepEqual(e.Changes, want.Changes) {
+			t.Fatalf("Expected transaction %d whole, got %+v", e.TxNum, e.Changes)
+		}
+	}
+}
+
+// TestReaderHoldsLog tests that a Reader keeps a checkpoint from truncating
+// the records it has yet to read, until it is closed.
+func TestReaderHoldsLog(t *testing.T) {
+	lm := newTestLogMgrWithOptions(t, log.Options{SegmentBlocks: 1})
+	commitTxs(t, lm, 1, 5)
+	r := NewReader(lm, Position{}, Options{})
+	if events := poll(t, r); len(events) != 5 {
+		t.Fatalf("Expected 5 events, got %d", len(events))
+	}
+
+	// The reader lags behind a checkpoint.
+	commitTxs(t, lm, 6, 30)
+	checkpoint(t, lm)
+	events := poll(t, r)
+	if len(events) != 30 || events[0].TxNum != 6 {
+		t.Fatalf("Expected the 30 transactions written before the checkpoint, got %d events", len(events))
+	}
+
+	held, err := lm.FirstLSN()
+	if err != nil {
+		t.Fatalf("FirstLSN failed: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	commitTxs(t, lm, 36, 30)
+	checkpoint(t, lm)
+	if first, err := lm.FirstLSN(); err != nil || first <= held {
+		t.Fatalf("Expected the log to be truncated past %d once the reader closed, it starts at %d (err %v)", held, first, err)
+	}
+}
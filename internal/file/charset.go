@@ -0,0 +1,96 @@
+package file
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Charset is the character encoding of the strings stored in a Page.
+type Charset int
+
+const (
+	// UTF8 stores strings as UTF-8, taking up to four bytes per character.
+	UTF8 Charset = iota
+	// ASCII stores strings of 7-bit characters, one byte per character.
+	ASCII
+	// Latin1 stores strings of characters up to U+00FF as ISO 8859-1, one
+	// byte per character.
+	Latin1
+)
+
+// String returns the name of the charset.
+func (cs Charset) String() string {
+	switch cs {
+	case UTF8:
+		return "UTF-8"
+	case ASCII:
+		return "ASCII"
+	case Latin1:
+		return "ISO-8859-1"
+	}
+	return fmt.Sprintf("Charset(%d)", int(cs))
+}
+
+// MaxBytesPerChar returns the largest number of bytes a character takes.
+func (cs Charset) MaxBytesPerChar() int {
+	if cs == UTF8 {
+		return utf8.UTFMax
+	}
+	return 1
+}
+
+// MaxLength returns the maximum byte length required to store a string of
+// strlen characters, including its length prefix.
+func (cs Charset) MaxLength(strlen int) int {
+	return IntSize + strlen*cs.MaxBytesPerChar()
+}
+
+// encode returns the stored form of s.
+func (cs Charset) encode(s string) ([]byte, error) {
+	switch cs {
+	case UTF8:
+		if !utf8.ValidString(s) {
+			return nil, fmt.Errorf("string %q is not valid %s", s, cs)
+		}
+		return []byte(s), nil
+	case ASCII, Latin1:
+		limit := rune(utf8.RuneSelf - 1)
+		if cs == Latin1 {
+			limit = 0xff
+		}
+		b := make([]byte, 0, len(s))
+		for _, r := range s {
+			if r > limit {
+				return nil, fmt.Errorf("string %q cannot be stored as %s", s, cs)
+			}
+			b = append(b, byte(r))
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("unknown charset %s", cs)
+}
+
+// decode returns the string whose stored form is b.
+func (cs Charset) decode(b []byte) (string, error) {
+	switch cs {
+	case UTF8:
+		if !utf8.Valid(b) {
+			return "", fmt.Errorf("stored string is not valid %s", cs)
+		}
+		return string(b), nil
+	case ASCII:
+		for _, c := range b {
+			if c >= utf8.RuneSelf {
+				return "", fmt.Errorf("stored string is not valid %s", cs)
+			}
+		}
+		return string(b), nil
+	case Latin1:
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+		return string(r), nil
+	}
+	return "", fmt.Errorf("unknown charset %s", cs)
+}
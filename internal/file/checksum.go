@@ -0,0 +1,66 @@
+package file
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// ChecksumSize is the size of the checksum trailer at the end of each block
+// when checksums are enabled.
+const ChecksumSize = 4
+
+// castagnoli is the CRC32C table used for block checksums.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrChecksumMismatch is matched by the *ChecksumError returned when a block
+// read from disk does not match its checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ChecksumError reports a block whose contents do not match its checksum,
+// typically because of a torn write or bit rot.
+type ChecksumError struct {
+	Blk      BlockId
+	Stored   uint32
+	Computed uint32
+}
+
+// Error returns a description of the corrupted block.
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%v in %s: stored %08x, computed %08x", ErrChecksumMismatch, e.Blk, e.Stored, e.Computed)
+}
+
+// Unwrap returns ErrChecksumMismatch so callers can match it with errors.Is.
+func (e *ChecksumError) Unwrap() error {
+	return ErrChecksumMismatch
+}
+
+// stampChecksum writes the CRC32C of the page part of block into its trailer.
+func stampChecksum(block []byte) {
+	n := len(block) - ChecksumSize
+	binary.BigEndian.PutUint32(block[n:], crc32.Checksum(block[:n], castagnoli))
+}
+
+// verifyChecksum checks the trailer of a block read from disk. The CRC32C of
+// a page of zeros is not zero, so a block of all zeros, trailer included,
+// fails the check; FileMgr.Read only accepts one past the last written block.
+func verifyChecksum(blk BlockId, block []byte) error {
+	n := len(block) - ChecksumSize
+	stored := binary.BigEndian.Uint32(block[n:])
+	computed := crc32.Checksum(block[:n], castagnoli)
+	if stored == computed {
+		return nil
+	}
+	return &ChecksumError{Blk: blk, Stored: stored, Computed: computed}
+}
+
+// isZero reports whether every byte of b is zero.
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
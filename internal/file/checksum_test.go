@@ -0,0 +1,139 @@
+package file
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksums(t *testing.T) {
+	testDir := t.TempDir()
+	blockSize := 512
+
+	fm, err := NewFileMgrWithOptions(testDir, blockSize, Options{Checksums: true})
+	require.NoError(t, err, "Failed to create FileMgr")
+	require.True(t, fm.Checksums())
+	require.Equal(t, blockSize-ChecksumSize, fm.BlockSize(), "Pages should exclude the checksum trailer")
+
+	blk, err := fm.Append("checkfile")
+	require.NoError(t, err, "Append failed")
+
+	t.Run("Appended block is valid", func(t *testing.T) {
+		p := NewPage(fm.BlockSize())
+		require.NoError(t, fm.Read(blk, p.Contents()), "Read of an appended block failed")
+	})
+
+	t.Run("Round trip", func(t *testing.T) {
+		p := NewPage(fm.BlockSize())
+		require.NoError(t, p.SetString(0, "checked"))
+		require.NoError(t, fm.Write(blk, p.Contents()), "Write failed")
+
+		length, err := fm.Length("checkfile")
+		require.NoError(t, err, "Length failed")
+		require.Equal(t, 1, length, "Checksummed blocks should keep the configured block size on disk")
+
+		read := NewPage(fm.BlockSize())
+		require.NoError(t, fm.Read(blk, read.Contents()), "Read failed")
+		s, err := read.GetString(0)
+		require.NoError(t, err)
+		require.Equal(t, "checked", s)
+	})
+
+	t.Run("Bit rot", func(t *testing.T) {
+		corruptFile(t, filepath.Join(testDir, "checkfile"), 20, []byte{0xff})
+
+		err := fm.Read(blk, NewPage(fm.BlockSize()).Contents())
+		require.Error(t, err, "Expected a checksum mismatch")
+		require.True(t, errors.Is(err, ErrChecksumMismatch), "Expected ErrChecksumMismatch, got %v", err)
+
+		var ce *ChecksumError
+		require.True(t, errors.As(err, &ce), "Expected a *ChecksumError, got %T", err)
+		require.Equal(t, blk, ce.Blk, "The error should name the corrupted block")
+		require.Contains(t, err.Error(), blk.String())
+	})
+
+	t.Run("Torn write", func(t *testing.T) {
+		p := NewPage(fm.BlockSize())
+		require.NoError(t, p.SetString(0, "first version"))
+		require.NoError(t, fm.Write(blk, p.Contents()), "Write failed")
+
+		// Only the first half of a newer version reaches the disk.
+		require.NoError(t, p.SetString(0, "second version"))
+		torn := make([]byte, blockSize)
+		copy(torn, p.Contents())
+		stampChecksum(torn)
+		corruptFile(t, filepath.Join(testDir, "checkfile"), 0, torn[:blockSize/2])
+
+		err := fm.Read(blk, NewPage(fm.BlockSize()).Contents())
+		require.True(t, errors.Is(err, ErrChecksumMismatch), "Expected ErrChecksumMismatch, got %v", err)
+	})
+
+	t.Run("Too small block", func(t *testing.T) {
+		_, err := NewFileMgrWithOptions(t.TempDir(), ChecksumSize, Options{Checksums: true})
+		require.Error(t, err, "Expected an error for a block with no room for a page")
+	})
+}
+
+func TestChecksumZeroedBlocks(t *testing.T) {
+	testDir := t.TempDir()
+	blockSize := 512
+	path := filepath.Join(testDir, "zerofile")
+
+	fm, err := NewFileMgrWithOptions(testDir, blockSize, Options{Checksums: true})
+	require.NoError(t, err, "Failed to create FileMgr")
+	for i := 0; i < 3; i++ {
+		blk, err := fm.Append("zerofile")
+		require.NoError(t, err, "Append failed")
+		p := NewPage(fm.BlockSize())
+		require.NoError(t, p.SetString(0, "data"))
+		require.NoError(t, fm.Write(blk, p.Contents()), "Write failed")
+	}
+	blk := NewBlockId("zerofile", 1)
+
+	t.Run("Zeroed written block", func(t *testing.T) {
+		corruptFile(t, path, int64(blk.Blknum*blockSize), make([]byte, blockSize))
+		err := fm.Read(blk, NewPage(fm.BlockSize()).Contents())
+		require.ErrorIs(t, err, ErrChecksumMismatch, "A zeroed block before the end of the file should fail its checksum")
+	})
+
+	t.Run("Zeroed last block", func(t *testing.T) {
+		last := NewBlockId("zerofile", 2)
+		corruptFile(t, path, int64(last.Blknum*blockSize), make([]byte, blockSize))
+		err := fm.Read(last, NewPage(fm.BlockSize()).Contents())
+		require.ErrorIs(t, err, ErrChecksumMismatch, "A zeroed block that was written should fail its checksum")
+	})
+
+	require.NoError(t, fm.Close())
+	reopened, err := NewFileMgrWithOptions(testDir, blockSize, Options{Checksums: true})
+	require.NoError(t, err, "Failed to reopen FileMgr")
+	defer reopened.Close()
+
+	t.Run("Unwritten tail", func(t *testing.T) {
+		// Blocks 1 and 2 are now zero up to the end of the file, as if they
+		// had been appended by a process that crashed before writing them.
+		for _, blknum := range []int{1, 2} {
+			err := reopened.Read(NewBlockId("zerofile", blknum), NewPage(reopened.BlockSize()).Contents())
+			require.NoError(t, err, "A zero block past the last written one should be accepted")
+		}
+	})
+
+	t.Run("Zeroed block before data", func(t *testing.T) {
+		p := NewPage(reopened.BlockSize())
+		require.NoError(t, p.SetString(0, "later"))
+		require.NoError(t, reopened.Write(NewBlockId("zerofile", 2), p.Contents()), "Write failed")
+		err := reopened.Read(blk, NewPage(reopened.BlockSize()).Contents())
+		require.ErrorIs(t, err, ErrChecksumMismatch, "A zero block followed by data should fail its checksum")
+	})
+}
+
+// corruptFile overwrites part of a file behind the FileMgr's back.
+func corruptFile(t *testing.T, path string, offset int64, data []byte) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0666)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.WriteAt(data, offset)
+	require.NoError(t, err)
+}
@@ -0,0 +1,8 @@
+//go:build linux || darwin || netbsd || openbsd
+
+package file
+
+import "syscall"
+
+// dsyncFlag makes every write to a file durable before it returns.
+const dsyncFlag = syscall.O_DSYNC
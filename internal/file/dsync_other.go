@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || netbsd || openbsd)
+
+package file
+
+import "os"
+
+// dsyncFlag falls back to O_SYNC where O_DSYNC is not available.
+const dsyncFlag = os.O_SYNC
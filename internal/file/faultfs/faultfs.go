@@ -0,0 +1,478 @@
+// Package faultfs provides a file.Storage wrapper that simulates crashes and
+// I/O faults, so tests can check what survives a power failure.
+package faultfs
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"syscall"
+
+	"database_design_and_implementation/internal/file"
+)
+
+// ErrCrashed is returned by every operation after the storage has crashed.
+var ErrCrashed = errors.New("storage has crashed")
+
+// Storage wraps a file.Storage and keeps track of which bytes are durable.
+// Reads and writes go to the wrapped storage, so a running FileMgr sees every
+// write it made. Writes only become durable when their file is synced; Crash
+// returns the bytes that would be left on disk after a power failure.
+//
+// Directory entries are tracked the same way. Creating or removing a file
+// changes the directory, and the change is only durable once the directory
+// is synced, which Open and Remove do before they return, as OSStorage does.
+// A file whose creation was never synced is lost in a crash, even if its
+// contents were synced.
+type Storage struct {
+	inner file.Storage
+
+	mu         sync.Mutex
+	durable    map[string][]byte
+	pending    []op
+	exists     map[string]bool
+	dirPending []dirOp
+	writes     int
+	failAt     int
+	tearAt     int
+	tearLen    int
+	torn       *op
+	dirSyncs   int
+	failDirAt  int
+	crashed    bool
+}
+
+// op is an unsynced write or truncation of a file.
+type op struct {
+	name     string
+	off      int64
+	data     []byte
+	truncate bool
+}
+
+// applyTo performs the operation on the contents of a file and returns the
+// new contents. A file is extended with zeros as needed.
+func (o op) applyTo(data []byte) []byte {
+	end := o.off
+	if !o.truncate {
+		end += int64(len(o.data))
+	}
+	if int64(len(data)) < end {
+		data = append(data, make([]byte, end-int64(len(data)))...)
+	}
+	if o.truncate {
+		return data[:o.off]
+	}
+	copy(data[o.off:], o.data)
+	return data
+}
+
+// dirOp is an unsynced creation, removal or rename of a file. A removal
+// keeps the durable contents of the file, which a crash can bring back, and a
+// rename keeps those of the file it replaced, if there was one.
+type dirOp struct {
+	name     string
+	remove   bool
+	from     string
+	replaced bool
+	data     []byte
+}
+
+// New wraps inner. Everything already stored in inner is treated as durable.
+func New(inner file.Storage) (*Storage, error) {
+	s := &Storage{inner: inner, durable: make(map[string][]byte), exists: make(map[string]bool)}
+	names, err := inner.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		data, err := readAll(inner, name)
+		if err != nil {
+			return nil, err
+		}
+		s.durable[name] = data
+		s.exists[name] = true
+	}
+	return s, nil
+}
+
+// FailWrite makes the nth write from now fail with EIO without changing the file.
+func (s *Storage) FailWrite(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failAt = s.writes + n
+}
+
+// TearWrite makes the nth write from now tear: only its first keep bytes
+// reach the disk before the power fails. The write returns ErrCrashed, as
+// does every later operation.
+func (s *Storage) TearWrite(n, keep int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tearAt = s.writes + n
+	s.tearLen = keep
+}
+
+// FailDirSync makes the nth directory sync from now fail with EIO, so that
+// the creation or removal it was meant to make durable can be lost in a crash.
+func (s *Storage) FailDirSync(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failDirAt = s.dirSyncs + n
+}
+
+// Writes returns the number of writes made through the storage so far.
+func (s *Storage) Writes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writes
+}
+
+// Crash simulates a power failure in which every unsynced write is lost, and
+// returns the surviving bytes as a new storage to reopen the database from.
+// The storage fails every later operation with ErrCrashed.
+func (s *Storage) Crash() (*file.MemStorage, error) {
+	return s.crash(nil)
+}
+
+// CrashReordered simulates a power failure in which the disk had written a
+// random subset of the unsynced writes, in a random order.
+func (s *Storage) CrashReordered(r *rand.Rand) (*file.MemStorage, error) {
+	return s.crash(r)
+}
+
+// crash builds the image left on disk. With r set, a random subset of the
+// pending writes and directory changes survives, the writes in a random
+// order; otherwise none does.
+func (s *Storage) crash(r *rand.Rand) (*file.MemStorage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.crashed = true
+
+	// The durable contents assume that every directory change was synced,
+	// so the lost ones are undone, the latest first.
+	files := make(map[string][]byte, len(s.durable))
+	for name, data := range s.durable {
+		files[name] = data
+	}
+	for i := len(s.dirPending) - 1; i >= 0; i-- {
+		if r != nil && r.Intn(2) == 0 {
+			continue
+		}
+		switch d := s.dirPending[i]; {
+		case d.from != "":
+			files[d.from] = files[d.name]
+			if d.replaced {
+				files[d.name] = d.data
+			} else {
+				delete(files, d.name)
+			}
+		case d.remove:
+			files[d.name] = d.data
+		default:
+			delete(files, d.name)
+		}
+	}
+
+	var survivors []op
+	if r != nil {
+		for _, i := range r.Perm(len(s.pending)) {
+			if r.Intn(2) == 0 {
+				survivors = append(survivors, s.pending[i])
+			}
+		}
+	}
+	if s.torn != nil {
+		survivors = append(survivors, *s.torn)
+	}
+
+	img := file.NewMemStorage()
+	for name, data := range files {
+		if err := apply(img, op{name: name, data: data}); err != nil {
+			return nil, err
+		}
+	}
+	for _, o := range survivors {
+		// A write to a file whose directory entry was lost is lost with it.
+		if _, exists := files[o.name]; !exists {
+			continue
+		}
+		if err := apply(img, o); err != nil {
+			return nil, err
+		}
+	}
+	return img, nil
+}
+
+// Open opens the named file, creating it if it does not exist. A created
+// file is empty until it is synced, and its directory entry is synced before
+// Open returns. If that sync fails, the file is removed again, as OSStorage
+// does, and the creation may or may not survive a crash.
+func (s *Storage) Open(name string) (file.StorageFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.crashed {
+		return nil, ErrCrashed
+	}
+	f, err := s.inner.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if !s.exists[name] {
+		s.exists[name] = true
+		s.durable[name] = nil
+		s.dirPending = append(s.dirPending, dirOp{name: name})
+		if err := s.syncDir("create", name); err != nil {
+			f.Close()
+			if rerr := s.remove(name); rerr != nil {
+				return nil, errors.Join(err, rerr)
+			}
+			return nil, err
+		}
+	}
+	return &faultFile{s: s, name: name, f: f}, nil
+}
+
+// Remove deletes the named file and syncs the directory. If the sync fails,
+// the file may come back in a crash with the contents it last had on disk.
+func (s *Storage) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.crashed {
+		return ErrCrashed
+	}
+	if err := s.remove(name); err != nil {
+		return err
+	}
+	return s.syncDir("remove", name)
+}
+
+// Rename replaces newname with the file named oldname and syncs the
+// directory. Unsynced writes to the file move with it. If the sync fails,
+// a crash may undo the rename.
+func (s *Storage) Rename(oldname, newname string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.crashed {
+		return ErrCrashed
+	}
+	if err := s.inner.Rename(oldname, newname); err != nil {
+		return err
+	}
+	d := dirOp{name: newname, from: oldname, replaced: s.exists[newname], data: s.durable[newname]}
+	s.dirPending = append(s.dirPending, d)
+	s.dropPending(newname)
+	for i := range s.pending {
+		if s.pending[i].name == oldname {
+			s.pending[i].name = newname
+		}
+	}
+	s.durable[newname] = s.durable[oldname]
+	delete(s.durable, oldname)
+	delete(s.exists, oldname)
+	s.exists[newname] = true
+	return s.syncDir("rename", oldname)
+}
+
+// remove deletes a file without syncing the directory. It is called with s.mu held.
+func (s *Storage) remove(name string) error {
+	if err := s.inner.Remove(name); err != nil {
+		return err
+	}
+	s.dirPending = append(s.dirPending, dirOp{name: name, remove: true, data: s.durable[name]})
+	delete(s.durable, name)
+	delete(s.exists, name)
+	s.dropPending(name)
+	return nil
+}
+
+// syncDir makes the pending directory changes durable, unless a failure has
+// been scheduled for it. It is called with s.mu held.
+func (s *Storage) syncDir(action, name string) error {
+	s.dirSyncs++
+	if s.dirSyncs == s.failDirAt {
+		return fmt.Errorf("sync directory after %s %s: %w", action, name, syscall.EIO)
+	}
+	s.dirPending = nil
+	return nil
+}
+
+// List returns the names of the files in the wrapped storage.
+func (s *Storage) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.crashed {
+		return nil, ErrCrashed
+	}
+	return s.inner.List()
+}
+
+// dropPending forgets the unsynced operations on a file. It is called with s.mu held.
+func (s *Storage) dropPending(name string) {
+	kept := s.pending[:0]
+	for _, o := range s.pending {
+		if o.name != name {
+			kept = append(kept, o)
+		}
+	}
+	s.pending = kept
+}
+
+// faultFile is a file opened from a fault-injecting Storage.
+type faultFile struct {
+	s    *Storage
+	name string
+	f    file.StorageFile
+}
+
+// ReadAt reads from the wrapped file.
+func (ff *faultFile) ReadAt(p []byte, off int64) (int, error) {
+	ff.s.mu.Lock()
+	crashed := ff.s.crashed
+	ff.s.mu.Unlock()
+
+	if crashed {
+		return 0, ErrCrashed
+	}
+	return ff.f.ReadAt(p, off)
+}
+
+// WriteAt writes to the wrapped file and records the write as unsynced,
+// unless a fault has been scheduled for it.
+func (ff *faultFile) WriteAt(p []byte, off int64) (int, error) {
+	s := ff.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.crashed {
+		return 0, ErrCrashed
+	}
+	s.writes++
+	switch s.writes {
+	case s.failAt:
+		return 0, &writeError{name: ff.name, off: off}
+	case s.tearAt:
+		keep := min(s.tearLen, len(p))
+		s.torn = &op{name: ff.name, off: off, data: append([]byte(nil), p[:keep]...)}
+		s.crashed = true
+		return keep, ErrCrashed
+	}
+
+	n, err := ff.f.WriteAt(p, off)
+	if n > 0 {
+		s.pending = append(s.pending, op{name: ff.name, off: off, data: append([]byte(nil), p[:n]...)})
+	}
+	return n, err
+}
+
+// Size returns the size of the wrapped file.
+func (ff *faultFile) Size() (int64, error) {
+	ff.s.mu.Lock()
+	crashed := ff.s.crashed
+	ff.s.mu.Unlock()
+
+	if crashed {
+		return 0, ErrCrashed
+	}
+	return ff.f.Size()
+}
+
+// Truncate truncates the wrapped file and records it as unsynced.
+func (ff *faultFile) Truncate(size int64) error {
+	s := ff.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.crashed {
+		return ErrCrashed
+	}
+	if err := ff.f.Truncate(size); err != nil {
+		return err
+	}
+	s.pending = append(s.pending, op{name: ff.name, off: size, truncate: true})
+	return nil
+}
+
+// Sync makes the current contents of the file durable, by applying the
+// writes and truncations made since the last sync to its durable contents.
+func (ff *faultFile) Sync() error {
+	s := ff.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.crashed {
+		return ErrCrashed
+	}
+	if err := ff.f.Sync(); err != nil {
+		return err
+	}
+	data := s.durable[ff.name]
+	for _, o := range s.pending {
+		if o.name == ff.name {
+			data = o.applyTo(data)
+		}
+	}
+	s.durable[ff.name] = data
+	s.dropPending(ff.name)
+	return nil
+}
+
+// Close closes the wrapped file.
+func (ff *faultFile) Close() error {
+	return ff.f.Close()
+}
+
+// writeError is the EIO returned by a write scheduled to fail.
+type writeError struct {
+	name string
+	off  int64
+}
+
+// Error describes the failed write.
+func (e *writeError) Error() string {
+	return fmt.Sprintf("write %s at offset %d: %v", e.name, e.off, syscall.EIO)
+}
+
+// Unwrap returns EIO so callers can match it with errors.Is.
+func (e *writeError) Unwrap() error {
+	return syscall.EIO
+}
+
+// readAll returns the contents of a file of st.
+func readAll(st file.Storage, name string) ([]byte, error) {
+	f, err := st.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	size, err := f.Size()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	if _, err := f.ReadAt(data, 0); err != nil && size > 0 {
+		return nil, err
+	}
+	return data, nil
+}
+
+// apply performs an operation on a file of st.
+func apply(st file.Storage, o op) error {
+	f, err := st.Open(o.name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if o.truncate {
+		return f.Truncate(o.off)
+	}
+	_, err = f.WriteAt(o.data, o.off)
+	return err
+}
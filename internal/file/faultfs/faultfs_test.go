@@ -0,0 +1,314 @@
+package faultfs
+
+import (
+	"errors"
+	"math/rand"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"database_design_and_implementation/internal/file"
+)
+
+const blockSize = 64
+
+// openFileMgr opens a FileMgr on st.
+func openFileMgr(t *testing.T, st file.Storage, opts file.Options) *file.FileMgr {
+	t.Helper()
+	opts.Storage = st
+	fm, err := file.NewFileMgrWithOptions("faultdb", blockSize, opts)
+	require.NoError(t, err, "Failed to create FileMgr")
+	return fm
+}
+
+// writeBlock writes a string at the start of a block.
+func writeBlock(t *testing.T, fm *file.FileMgr, blk file.BlockId, s string) error {
+	t.Helper()
+	p := file.NewPage(fm.BlockSize())
+	require.NoError(t, p.SetString(0, s))
+	return fm.Write(blk, p.Contents())
+}
+
+// readBlock reads the string at the start of a block.
+func readBlock(t *testing.T, fm *file.FileMgr, blk file.BlockId) string {
+	t.Helper()
+	p := file.NewPage(fm.BlockSize())
+	require.NoError(t, fm.Read(blk, p.Contents()), "Read failed")
+	s, err := p.GetString(0)
+	require.NoError(t, err)
+	return s
+}
+
+func TestCrashDropsUnsyncedWrites(t *testing.T) {
+	st, err := New(file.NewMemStorage())
+	require.NoError(t, err)
+	fm := openFileMgr(t, st, file.Options{})
+
+	synced := file.NewBlockId("datafile", 0)
+	unsynced := file.NewBlockId("datafile", 1)
+	for _, blk := range []file.BlockId{synced, unsynced} {
+		_, err := fm.Append("datafile")
+		require.NoError(t, err, "Append failed")
+		require.NoError(t, writeBlock(t, fm, blk, "old"))
+	}
+	require.NoError(t, fm.Sync("datafile"), "Sync failed")
+
+	require.NoError(t, writeBlock(t, fm, synced, "new"))
+	require.NoError(t, fm.Sync("datafile"), "Sync failed")
+	require.NoError(t, writeBlock(t, fm, unsynced, "new"))
+	require.Equal(t, "new", readBlock(t, fm, unsynced), "The running FileMgr should see its own writes")
+
+	img, err := st.Crash()
+	require.NoError(t, err, "Crash failed")
+	require.ErrorIs(t, writeBlock(t, fm, synced, "after"), ErrCrashed)
+
+	reopened := openFileMgr(t, img, file.Options{})
+	require.Equal(t, "new", readBlock(t, reopened, synced))
+	require.Equal(t, "old", readBlock(t, reopened, unsynced), "An unsynced write should not survive a crash")
+}
+
+func TestFailWrite(t *testing.T) {
+	st, err := New(file.NewMemStorage())
+	require.NoError(t, err)
+	fm := openFileMgr(t, st, file.Options{})
+
+	blk, err := fm.Append("datafile")
+	require.NoError(t, err, "Append failed")
+
+	st.FailWrite(2)
+	require.NoError(t, writeBlock(t, fm, blk, "first"))
+	err = writeBlock(t, fm, blk, "second")
+	require.True(t, errors.Is(err, syscall.EIO), "Expected EIO, got %v", err)
+	require.Equal(t, "first", readBlock(t, fm, blk), "A failed write should not change the block")
+
+	require.NoError(t, writeBlock(t, fm, blk, "third"), "Only the scheduled write should fail")
+}
+
+func TestTearWrite(t *testing.T) {
+	st, err := New(file.NewMemStorage())
+	require.NoError(t, err)
+	fm := openFileMgr(t, st, file.Options{Checksums: true})
+
+	blk, err := fm.Append("datafile")
+	require.NoError(t, err, "Append failed")
+	require.NoError(t, writeBlock(t, fm, blk, "complete"))
+	require.NoError(t, fm.Sync("datafile"), "Sync failed")
+
+	st.TearWrite(1, blockSize/2)
+	require.ErrorIs(t, writeBlock(t, fm, blk, "torn apart"), ErrCrashed)
+	require.ErrorIs(t, fm.Sync("datafile"), ErrCrashed, "Every operation after a tear should fail")
+
+	img, err := st.Crash()
+	require.NoError(t, err, "Crash failed")
+
+	reopened := openFileMgr(t, img, file.Options{Checksums: true})
+	err = reopened.Read(blk, file.NewPage(reopened.BlockSize()).Contents())
+	require.ErrorIs(t, err, file.ErrChecksumMismatch, "A torn block should fail its checksum")
+}
+
+func TestCrashReordered(t *testing.T) {
+	st, err := New(file.NewMemStorage())
+	require.NoError(t, err)
+	fm := openFileMgr(t, st, file.Options{})
+
+	numBlocks := 16
+	for i := 0; i < numBlocks; i++ {
+		blk, err := fm.Append("datafile")
+		require.NoError(t, err, "Append failed")
+		require.NoError(t, writeBlock(t, fm, blk, "old"))
+	}
+	require.NoError(t, fm.Sync("datafile"), "Sync failed")
+
+	for i := 0; i < numBlocks; i++ {
+		require.NoError(t, writeBlock(t, fm, file.NewBlockId("datafile", i), "new"))
+	}
+
+	img, err := st.CrashReordered(rand.New(rand.NewSource(1)))
+	require.NoError(t, err, "Crash failed")
+
+	reopened := openFileMgr(t, img, file.Options{})
+	survived := 0
+	for i := 0; i < numBlocks; i++ {
+		s := readBlock(t, reopened, file.NewBlockId("datafile", i))
+		require.Contains(t, []string{"old", "new"}, s)
+		if s == "new" {
+			survived++
+		}
+	}
+	require.Greater(t, survived, 0, "Some unsynced writes should have reached the disk")
+	require.Less(t, survived, numBlocks, "Some unsynced writes should have been lost")
+}
+
+func TestRemoveAndTruncate(t *testing.T) {
+	inner := file.NewMemStorage()
+	st, err := New(inner)
+	require.NoError(t, err)
+
+	f, err := st.Open("gone")
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("data"), 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Sync())
+	require.NoError(t, st.Remove("gone"))
+
+	f, err = st.Open("shrunk")
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("0123456789"), 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Sync())
+	require.NoError(t, f.Truncate(4))
+
+	img, err := st.Crash()
+	require.NoError(t, err, "Crash failed")
+	names, err := img.List()
+	require.NoError(t, err)
+	require.Equal(t, []string{"shrunk"}, names, "A removed file should stay removed")
+
+	f, err = img.Open("shrunk")
+	require.NoError(t, err)
+	size, err := f.Size()
+	require.NoError(t, err)
+	require.Equal(t, int64(10), size, "An unsynced truncation should be lost")
+}
+
+func TestFailDirSync(t *testing.T) {
+	st, err := New(file.NewMemStorage())
+	require.NoError(t, err)
+
+	// A creation whose directory sync fails is undone and may be lost.
+	st.FailDirSync(1)
+	_, err = st.Open("created")
+	require.ErrorIs(t, err, syscall.EIO)
+	names, err := st.List()
+	require.NoError(t, err)
+	require.Empty(t, names, "A file whose creation failed should be removed")
+
+	f, err := st.Open("kept")
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("data"), 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Sync())
+
+	// A removal whose directory sync fails can be undone by a crash.
+	st.FailDirSync(1)
+	require.ErrorIs(t, st.Remove("kept"), syscall.EIO)
+
+	img, err := st.Crash()
+	require.NoError(t, err, "Crash failed")
+	names, err = img.List()
+	require.NoError(t, err)
+	require.Equal(t, []string{"kept"}, names, "An unsynced removal should be lost")
+	f, err = img.Open("kept")
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = f.ReadAt(buf, 0)
+	require.NoError(t, err)
+	require.Equal(t, "data", string(buf), "The removed file should come back with its synced contents")
+}
+
+func TestRename(t *testing.T) {
+	// writeFile creates a file holding data and syncs it.
+	writeFile := func(st *Storage, name, data string) {
+		f, err := st.Open(name)
+		require.NoError(t, err)
+		_, err = f.WriteAt([]byte(data), 0)
+		require.NoError(t, err)
+		require.NoError(t, f.Sync())
+		require.NoError(t, f.Close())
+	}
+	// contents returns the files of a crash image and what they hold.
+	contents := func(img *file.MemStorage) map[string]string {
+		names, err := img.List()
+		require.NoError(t, err)
+		files := make(map[string]string)
+		for _, name := range names {
+			data, err := readAll(img, name)
+			require.NoError(t, err)
+			files[name] = string(data)
+		}
+		return files
+	}
+
+	for _, failSync := range []bool{false, true} {
+		st, err := New(file.NewMemStorage())
+		require.NoError(t, err)
+		writeFile(st, "current", "old")
+		writeFile(st, "next", "new")
+
+		if failSync {
+			st.FailDirSync(1)
+			require.ErrorIs(t, st.Rename("next", "current"), syscall.EIO)
+		} else {
+			require.NoError(t, st.Rename("next", "current"))
+		}
+		names, err := st.List()
+		require.NoError(t, err)
+		require.Equal(t, []string{"current"}, names)
+
+		img, err := st.Crash()
+		require.NoError(t, err, "Crash failed")
+		if failSync {
+			require.Equal(t, map[string]string{"current": "old", "next": "new"}, contents(img),
+				"An unsynced rename should be lost")
+		} else {
+			require.Equal(t, map[string]string{"current": "new"}, contents(img))
+		}
+	}
+}
+
+// readCounter is a storage whose files count the reads made from them.
+type readCounter struct {
+	*file.MemStorage
+	reads int
+}
+
+func (s *readCounter) Open(name string) (file.StorageFile, error) {
+	f, err := s.MemStorage.Open(name)
+	return &countedFile{StorageFile: f, s: s}, err
+}
+
+type countedFile struct {
+	file.StorageFile
+	s *readCounter
+}
+
+func (f *countedFile) ReadAt(p []byte, off int64) (int, error) {
+	f.s.reads++
+	return f.StorageFile.ReadAt(p, off)
+}
+
+func TestSyncAppliesPendingOps(t *testing.T) {
+	inner := &readCounter{MemStorage: file.NewMemStorage()}
+	st, err := New(inner)
+	require.NoError(t, err)
+
+	f, err := st.Open("datafile")
+	require.NoError(t, err, "Open failed")
+	write := func(s string, off int64) {
+		_, err := f.WriteAt([]byte(s), off)
+		require.NoError(t, err, "WriteAt failed")
+	}
+	write("hello world", 0)
+	require.NoError(t, f.Sync(), "Sync failed")
+	write("XY", 20)
+	require.NoError(t, f.Truncate(8), "Truncate failed")
+	write("abc", 10)
+	require.NoError(t, f.Truncate(12), "Truncate failed")
+
+	reads := inner.reads
+	require.NoError(t, f.Sync(), "Sync failed")
+	require.Equal(t, reads, inner.reads, "Sync should not read the file back")
+	write("lost", 0)
+
+	img, err := st.Crash()
+	require.NoError(t, err, "Crash failed")
+	crashed, err := img.Open("datafile")
+	require.NoError(t, err)
+	size, err := crashed.Size()
+	require.NoError(t, err)
+	got := make([]byte, size)
+	_, err = crashed.ReadAt(got, 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello wo\x00\x00ab"), got, "The crash should keep the contents as of the last sync")
+}
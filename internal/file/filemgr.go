@@ -1,138 +1,688 @@
 package file
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 )
 
+// SyncPolicy controls when FileMgr forces written blocks to stable storage.
+type SyncPolicy int
+
+const (
+	// SyncExplicit fsyncs a file only when Sync is called for it. LogMgr and
+	// Buffer call Sync after writing, so a flushed log record or buffer is
+	// durable without paying for an fsync on every other write.
+	SyncExplicit SyncPolicy = iota
+	// SyncEveryWrite fsyncs a file after every Write and Append.
+	SyncEveryWrite
+	// SyncDSync opens files with O_DSYNC, so every write is durable when it returns.
+	SyncDSync
+	// SyncNone never fsyncs. Data may be lost on power failure, so it is only
+	// meant for tests.
+	SyncNone
+)
+
+// String returns the name of the sync policy.
+func (sp SyncPolicy) String() string {
+	switch sp {
+	case SyncExplicit:
+		return "explicit"
+	case SyncEveryWrite:
+		return "every-write"
+	case SyncDSync:
+		return "dsync"
+	case SyncNone:
+		return "none"
+	}
+	return fmt.Sprintf("SyncPolicy(%d)", int(sp))
+}
+
+// ErrClosed is returned by operations on a FileMgr that has been closed.
+var ErrClosed = errors.New("file manager is closed")
+
+// Options configures a FileMgr.
+type Options struct {
+	// Sync is the durability policy for writes.
+	Sync SyncPolicy
+	// Checksums reserves a trailer at the end of every block for a CRC32C of
+	// its contents. Write and Append stamp the checksum and Read verifies it,
+	// returning a *ChecksumError on mismatch; a block of all zeros only
+	// passes past the last written block of its file. Pages are ChecksumSize
+	// bytes smaller than blocks, so callers must size them with BlockSize.
+	Checksums bool
+	// Storage is the backend that holds the files. If nil, the files are kept
+	// in dbDirectory on the local file system. SyncDSync opens local files
+	// with O_DSYNC; with any other storage it fsyncs after every write.
+	Storage Storage
+	// ReadOnly opens an existing database without changing it. Write and
+	// Append fail with ErrReadOnly, temporary files are left in place, and
+	// the database lock is shared, so several read-only FileMgrs can have a
+	// database open at once, but not alongside a writer.
+	ReadOnly bool
+}
+
+// FileMgr reads and writes blocks of the files in a database directory. It is
+// safe for concurrent use.
 type FileMgr struct {
 	dbDirectory string
+	superblock  *Superblock
+	storage     Storage
 	blockSize   int
 	isNew       bool
-	openFiles   map[string]*os.File
-	writeCount  int
-	readCount   int
+	syncPolicy  SyncPolicy
+	syncWrites  bool
+	checksums   bool
+	readOnly    bool
+	unlock      func() error
+
+	// mu guards openFiles, tempFiles and closed.
+	mu        sync.Mutex
+	openFiles map[string]*openFile
+	tempFiles map[int][]string
+	nextTemp  int
+	closed    bool
+	stats     ioCounters
+}
+
+// openFile is a file opened by the FileMgr, with its own lock and statistics.
+type openFile struct {
+	f StorageFile
+	// mu serializes Append and Length, so two appenders never get the same
+	// block number.
+	mu    sync.Mutex
+	stats ioCounters
+	// written is one past the highest block written or appended through
+	// this FileMgr. It is guarded by mu.
+	written int
 }
 
+// NewFileMgr creates a FileMgr with the default options, which fsync files
+// only when Sync is called.
 func NewFileMgr(dbDirectory string, blockSize int) (*FileMgr, error) {
-	isNew := false
-	if _, err := os.Stat(dbDirectory); os.IsNotExist(err) {
-		isNew = true
-		if err := os.MkdirAll(dbDirectory, os.ModePerm); err != nil {
+	return NewFileMgrWithOptions(dbDirectory, blockSize, Options{})
+}
+
+// NewFileMgrWithOptions creates a FileMgr for the given database directory.
+// If the storage is a Locker, the database is locked until the FileMgr is
+// closed, and opening it from another process fails with a *LockedError.
+func NewFileMgrWithOptions(dbDirectory string, blockSize int, opts Options) (fm *FileMgr, err error) {
+	if opts.Checksums && blockSize <= ChecksumSize {
+		return nil, fmt.Errorf("block size %d is too small for a checksum trailer", blockSize)
+	}
+
+	storage := opts.Storage
+	if storage == nil {
+		storage, err = newOSStorage(dbDirectory, opts.Sync == SyncDSync, opts.ReadOnly)
+		if err != nil {
 			return nil, err
 		}
 	}
+	dsync := false
+	if oss, ok := storage.(*OSStorage); ok {
+		dsync = oss.dsync
+	}
+
+	unlock := func() error { return nil }
+	if locker, ok := storage.(Locker); ok {
+		if unlock, err = locker.Lock(opts.ReadOnly); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err != nil {
+				_ = unlock()
+			}
+		}()
+	}
 
 	// Remove temporary files
-	files, err := os.ReadDir(dbDirectory)
+	files, err := storage.List()
 	if err != nil {
 		return nil, err
 	}
-	for _, file := range files {
-		if file.IsDir() {
+	isNew := true
+	for _, name := range files {
+		if name == LockFile {
+			continue
+		}
+		// A superblock left half written by a crash is written again.
+		if strings.HasPrefix(name, "temp") || name == superblockTempFile {
+			if !opts.ReadOnly {
+				_ = storage.Remove(name)
+			}
 			continue
 		}
-		if filepath.HasPrefix(file.Name(), "temp") {
-			_ = os.Remove(filepath.Join(dbDirectory, file.Name()))
+		isNew = false
+	}
+	if isNew && opts.ReadOnly {
+		return nil, fmt.Errorf("no database in %s to open read-only", dbDirectory)
+	}
+
+	// A new database records its format. An existing one must be opened with
+	// the same settings; one created before superblocks existed adopts the
+	// settings it is opened with, provided its files fit the block size, and
+	// is recorded with the legacy format version so that its log is not
+	// mistaken for one of the current format.
+	sb, err := readSuperblock(storage)
+	if err != nil {
+		return nil, err
+	}
+	if sb != nil {
+		if err := sb.check(dbDirectory, blockSize, opts.Checksums); err != nil {
+			return nil, err
+		}
+	} else {
+		if !isNew {
+			if err := checkBlockSize(storage, dbDirectory, files, blockSize); err != nil {
+				return nil, err
+			}
+		}
+		if sb, err = newSuperblock(blockSize, opts.Checksums); err != nil {
+			return nil, err
+		}
+		if !isNew {
+			sb.FormatVersion = LegacyFormatVersion
+		}
+		if !opts.ReadOnly {
+			if err := writeSuperblock(storage, sb); err != nil {
+				return nil, err
+			}
 		}
 	}
 
 	return &FileMgr{
 		dbDirectory: dbDirectory,
+		superblock:  sb,
+		storage:     storage,
 		blockSize:   blockSize,
 		isNew:       isNew,
-		openFiles:   make(map[string]*os.File),
+		openFiles:   make(map[string]*openFile),
+		tempFiles:   make(map[int][]string),
+		syncPolicy:  opts.Sync,
+		syncWrites:  opts.Sync == SyncEveryWrite || (opts.Sync == SyncDSync && !dsync),
+		checksums:   opts.Checksums,
+		readOnly:    opts.ReadOnly,
+		unlock:      unlock,
 	}, nil
 }
 
+// Read reads the contents of a block into p. With checksums enabled, a
+// mismatch is reported as a *ChecksumError.
 func (fm *FileMgr) Read(blk BlockId, p []byte) error {
-	file, err := fm.getFile(blk.Filename)
+	of, err := fm.getFile(blk.Filename)
 	if err != nil {
 		return err
 	}
-	_, err = file.ReadAt(p, int64(blk.Blknum*fm.blockSize))
+
+	block := p
+	if fm.checksums {
+		block = make([]byte, fm.blockSize)
+	}
+	start := time.Now()
+	_, err = of.f.ReadAt(block, int64(blk.Blknum*fm.blockSize))
 	if err != nil {
 		return err
 	}
-	fm.readCount++
+	fm.recordRead(of, len(block), time.Since(start))
+
+	if fm.checksums {
+		// The contents are copied even if the checksum does not match, so
+		// that a caller able to validate them in finer detail can use them.
+		copy(p, block[:fm.BlockSize()])
+		err := verifyChecksum(blk, block)
+		if err != nil && isZero(block) {
+			unwritten, zerr := fm.unwritten(of, blk)
+			if zerr != nil {
+				return errors.Join(err, zerr)
+			}
+			if unwritten {
+				return nil
+			}
+		}
+		return err
+	}
 	return nil
 }
 
-func (fm *FileMgr) Write(blk BlockId, p []byte) error {
+// unwritten reports whether an all-zero block is past the last block known to
+// have been written: no later block of the file holds data, and none from it
+// on has been written or appended through this FileMgr. Such a block was
+// appended by a crashed process whose write of it never reached the disk.
+// Any other zeroed block was written and then lost, as in a torn write.
+func (fm *FileMgr) unwritten(of *openFile, blk BlockId) (bool, error) {
+	of.mu.Lock()
+	defer of.mu.Unlock()
+
+	if blk.Blknum < of.written {
+		return false, nil
+	}
+	length, err := fm.length(of)
+	if err != nil {
+		return false, err
+	}
+	block := make([]byte, fm.blockSize)
+	for blknum := blk.Blknum + 1; blknum < length; blknum++ {
+		if _, err := of.f.ReadAt(block, int64(blknum*fm.blockSize)); err != nil {
+			return false, err
+		}
+		if !isZero(block) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
 
-	file, err := fm.getFile(blk.Filename)
+// Write writes p to a block.
+func (fm *FileMgr) Write(blk BlockId, p []byte) error {
+	if fm.readOnly {
+		return ErrReadOnly
+	}
+	of, err := fm.getFile(blk.Filename)
 	if err != nil {
 		return err
 	}
-	_, err = file.WriteAt(p, int64(blk.Blknum*fm.blockSize))
+	if fm.checksums {
+		block := make([]byte, fm.blockSize)
+		copy(block[:fm.BlockSize()], p)
+		stampChecksum(block)
+		p = block
+	}
+
+	start := time.Now()
+	_, err = of.f.WriteAt(p, int64(blk.Blknum*fm.blockSize))
 	if err != nil {
 		return err
 	}
-	fm.writeCount++
+	of.mu.Lock()
+	of.written = max(of.written, blk.Blknum+1)
+	of.mu.Unlock()
+	if fm.syncWrites {
+		if err := of.f.Sync(); err != nil {
+			return err
+		}
+	}
+	fm.recordWrite(of, len(p), time.Since(start))
 	return nil
 }
 
+// Append adds an empty block to the end of a file and returns its BlockId.
 func (fm *FileMgr) Append(filename string) (BlockId, error) {
+	if fm.readOnly {
+		return BlockId{}, ErrReadOnly
+	}
+	of, err := fm.getFile(filename)
+	if err != nil {
+		return BlockId{}, err
+	}
+
+	of.mu.Lock()
+	defer of.mu.Unlock()
 
-	newBlkNum, err := fm.Length(filename)
+	newBlkNum, err := fm.length(of)
 	if err != nil {
 		return BlockId{}, err
 	}
 
 	blk := NewBlockId(filename, newBlkNum)
 	buffer := make([]byte, fm.blockSize)
+	if fm.checksums {
+		// An empty block carries a checksum too, so that it cannot be told
+		// apart from one zeroed by a lost write.
+		stampChecksum(buffer)
+	}
 
-	file, err := fm.getFile(filename)
+	start := time.Now()
+	_, err = of.f.WriteAt(buffer, int64(blk.Blknum*fm.blockSize))
 	if err != nil {
 		return BlockId{}, err
 	}
-	_, err = file.WriteAt(buffer, int64(blk.Blknum*fm.blockSize))
-	if err != nil {
-		return BlockId{}, err
+	of.written = max(of.written, blk.Blknum+1)
+	if fm.syncWrites {
+		if err := of.f.Sync(); err != nil {
+			return BlockId{}, err
+		}
 	}
+	d := time.Since(start)
+	of.stats.recordAppend(len(buffer), d)
+	fm.stats.recordAppend(len(buffer), d)
 
 	return blk, nil
 }
 
+// Sync forces the written blocks of the given file to stable storage. It
+// only fsyncs under SyncExplicit: the other policies have either synced the
+// writes already or chosen not to.
+func (fm *FileMgr) Sync(filename string) error {
+	of, err := fm.getFile(filename)
+	if err != nil {
+		return err
+	}
+	if fm.syncPolicy != SyncExplicit {
+		return nil
+	}
+	return of.f.Sync()
+}
+
+// Length returns the number of blocks in a file.
 func (fm *FileMgr) Length(filename string) (int, error) {
-	file, err := fm.getFile(filename)
+	of, err := fm.getFile(filename)
 	if err != nil {
 		return 0, err
 	}
-	info, err := file.Stat()
+
+	of.mu.Lock()
+	defer of.mu.Unlock()
+	return fm.length(of)
+}
+
+// length returns the number of blocks in an open file. It is called with of.mu held.
+func (fm *FileMgr) length(of *openFile) (int, error) {
+	size, err := of.f.Size()
 	if err != nil {
 		return 0, err
 	}
-	return int(info.Size()) / fm.blockSize, nil
+	return int(size) / fm.blockSize, nil
+}
+
+// Truncate shrinks a file to the given number of blocks. It does nothing if
+// the file is not longer than that.
+func (fm *FileMgr) Truncate(filename string, blocks int) error {
+	if fm.readOnly {
+		return ErrReadOnly
+	}
+	if blocks < 0 {
+		return fmt.Errorf("cannot truncate %s to %d blocks", filename, blocks)
+	}
+	of, err := fm.getFile(filename)
+	if err != nil {
+		return err
+	}
+
+	of.mu.Lock()
+	defer of.mu.Unlock()
+
+	length, err := fm.length(of)
+	if err != nil {
+		return err
+	}
+	if blocks >= length {
+		return nil
+	}
+	if err := of.f.Truncate(int64(blocks * fm.blockSize)); err != nil {
+		return err
+	}
+	if fm.syncWrites {
+		return of.f.Sync()
+	}
+	return nil
+}
+
+// ListFiles returns the names of the files in the database.
+func (fm *FileMgr) ListFiles() ([]string, error) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	if fm.closed {
+		return nil, ErrClosed
+	}
+	return fm.storage.List()
+}
+
+// ArchiveFile copies a file to dst as it is stored, including any checksum
+// trailers, so that the copy can be opened as the same file, and syncs the
+// copy. A copy left in dst by an earlier attempt is overwritten.
+func (fm *FileMgr) ArchiveFile(filename string, dst Storage) error {
+	of, err := fm.getFile(filename)
+	if err != nil {
+		return err
+	}
+
+	of.mu.Lock()
+	defer of.mu.Unlock()
+
+	size, err := of.f.Size()
+	if err != nil {
+		return err
+	}
+	out, err := dst.Open(filename)
+	if err != nil {
+		return err
+	}
+	if err := out.Truncate(0); err != nil {
+		return errors.Join(err, out.Close())
+	}
+	if _, err := io.Copy(io.NewOffsetWriter(out, 0), io.NewSectionReader(of.f, 0, size)); err != nil {
+		return errors.Join(err, out.Close())
+	}
+	if err := out.Sync(); err != nil {
+		return errors.Join(err, out.Close())
+	}
+	return out.Close()
+}
+
+// DeleteFile closes and removes a file. Deleting a file that does not exist
+// is not an error.
+func (fm *FileMgr) DeleteFile(filename string) error {
+	if fm.readOnly {
+		return ErrReadOnly
+	}
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	if fm.closed {
+		return ErrClosed
+	}
+	for owner, names := range fm.tempFiles {
+		for i, name := range names {
+			if name == filename {
+				fm.tempFiles[owner] = append(names[:i:i], names[i+1:]...)
+				break
+			}
+		}
+	}
+	return fm.deleteFile(filename)
+}
+
+// CreateTempFile creates an empty temporary file on behalf of an owner,
+// typically a transaction number, and returns its name. The file is removed
+// by ReleaseTempFiles, by Close, or failing both, when the database is next
+// opened.
+func (fm *FileMgr) CreateTempFile(owner int) (string, error) {
+	if fm.readOnly {
+		return "", ErrReadOnly
+	}
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	if fm.closed {
+		return "", ErrClosed
+	}
+	names, err := fm.storage.List()
+	if err != nil {
+		return "", err
+	}
+	exists := make(map[string]bool, len(names))
+	for _, name := range names {
+		exists[name] = true
+	}
+
+	var filename string
+	for {
+		fm.nextTemp++
+		filename = fmt.Sprintf("temp%d", fm.nextTemp)
+		if !exists[filename] {
+			break
+		}
+	}
+	f, err := fm.storage.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	fm.openFiles[filename] = &openFile{f: f}
+	fm.tempFiles[owner] = append(fm.tempFiles[owner], filename)
+	return filename, nil
+}
+
+// TempFiles returns the names of the temporary files held by an owner.
+func (fm *FileMgr) TempFiles(owner int) []string {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	return append([]string(nil), fm.tempFiles[owner]...)
+}
+
+// ReleaseTempFiles removes every temporary file held by an owner.
+func (fm *FileMgr) ReleaseTempFiles(owner int) error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	if fm.closed {
+		return ErrClosed
+	}
+	var errs []error
+	for _, name := range fm.tempFiles[owner] {
+		if err := fm.deleteFile(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	delete(fm.tempFiles, owner)
+	return errors.Join(errs...)
+}
+
+// deleteFile closes and removes a file. It is called with fm.mu held.
+func (fm *FileMgr) deleteFile(filename string) error {
+	if of, exists := fm.openFiles[filename]; exists {
+		delete(fm.openFiles, filename)
+		if err := of.f.Close(); err != nil {
+			return err
+		}
+	}
+	if err := fm.storage.Remove(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Close closes every file opened by the FileMgr, removes the temporary files
+// that were not released and releases the database lock. Any later call that
+// needs a file fails with ErrClosed.
+func (fm *FileMgr) Close() error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	if fm.closed {
+		return ErrClosed
+	}
+	fm.closed = true
+
+	var errs []error
+	for _, names := range fm.tempFiles {
+		for _, name := range names {
+			if err := fm.deleteFile(name); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	fm.tempFiles = nil
+	for _, of := range fm.openFiles {
+		if err := of.f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	fm.openFiles = nil
+	if err := fm.unlock(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
 }
 
-func (fm *FileMgr) getFile(filename string) (*os.File, error) {
-	if file, exists := fm.openFiles[filename]; exists {
-		return file, nil
+func (fm *FileMgr) getFile(filename string) (*openFile, error) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	if fm.closed {
+		return nil, ErrClosed
 	}
 
-	path := filepath.Join(fm.dbDirectory, filename)
-	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if of, exists := fm.openFiles[filename]; exists {
+		return of, nil
+	}
+
+	file, err := fm.storage.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 
-	fm.openFiles[filename] = file
-	return file, nil
+	of := &openFile{f: file}
+	fm.openFiles[filename] = of
+	return of, nil
+}
+
+// recordRead counts a read in the statistics of the file and the total.
+func (fm *FileMgr) recordRead(of *openFile, n int, d time.Duration) {
+	of.stats.recordRead(n, d)
+	fm.stats.recordRead(n, d)
+}
+
+// recordWrite counts a write in the statistics of the file and the total.
+func (fm *FileMgr) recordWrite(of *openFile, n int, d time.Duration) {
+	of.stats.recordWrite(n, d)
+	fm.stats.recordWrite(n, d)
+}
+
+// Stats returns a snapshot of the I/O statistics, in total and per file.
+func (fm *FileMgr) Stats() Stats {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	files := make(map[string]IOStats, len(fm.openFiles))
+	for name, of := range fm.openFiles {
+		files[name] = of.stats.snapshot()
+	}
+	return Stats{Total: fm.stats.snapshot(), Files: files}
 }
 
 func (fm *FileMgr) GetWriteCount() int {
-	return fm.writeCount
+	return int(fm.stats.writes.Load())
 }
 
 func (fm *FileMgr) GetReadCount() int {
-	return fm.readCount
+	return int(fm.stats.reads.Load())
+}
+
+// Superblock returns the recorded format of the database.
+func (fm *FileMgr) Superblock() Superblock {
+	return *fm.superblock
 }
 
+// IsNew reports whether the database had no files when the FileMgr was created.
 func (fm *FileMgr) IsNew() bool {
 	return fm.isNew
 }
 
+// BlockSize returns the size of the pages read and written through the
+// FileMgr. With checksums enabled it excludes the checksum trailer.
 func (fm *FileMgr) BlockSize() int {
+	if fm.checksums {
+		return fm.blockSize - ChecksumSize
+	}
 	return fm.blockSize
 }
+
+// Checksums reports whether blocks carry a checksum trailer.
+func (fm *FileMgr) Checksums() bool {
+	return fm.checksums
+}
+
+// ReadOnly reports whether the FileMgr was opened read-only.
+func (fm *FileMgr) ReadOnly() bool {
+	return fm.readOnly
+}
+
+// SyncPolicy returns the durability policy of the FileMgr.
+func (fm *FileMgr) SyncPolicy() SyncPolicy {
+	return fm.syncPolicy
+}
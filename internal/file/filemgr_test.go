@@ -3,7 +3,9 @@ package file
 import (
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -84,3 +86,305 @@ func TestFileMgr(t *testing.T) {
 		require.NoError(t, err, "Expected file testfile to exist")
 	})
 }
+
+func TestFileMgrSyncPolicies(t *testing.T) {
+	blockSize := 512
+	policies := []SyncPolicy{SyncExplicit, SyncEveryWrite, SyncDSync, SyncNone}
+
+	for _, policy := range policies {
+		t.Run(policy.String(), func(t *testing.T) {
+			testDir := t.TempDir()
+			fm, err := NewFileMgrWithOptions(testDir, blockSize, Options{Sync: policy})
+			require.NoError(t, err, "Failed to create FileMgr")
+			require.Equal(t, policy, fm.SyncPolicy())
+
+			block, err := fm.Append("syncfile")
+			require.NoError(t, err, "Append failed")
+
+			data := make([]byte, blockSize)
+			copy(data, "durable")
+			require.NoError(t, fm.Write(block, data), "Write failed")
+			require.NoError(t, fm.Sync("syncfile"), "Sync failed")
+			require.NoError(t, fm.Close(), "Close failed")
+
+			reopened, err := NewFileMgrWithOptions(testDir, blockSize, Options{Sync: policy})
+			require.NoError(t, err, "Failed to reopen FileMgr")
+			readBuffer := make([]byte, blockSize)
+			require.NoError(t, reopened.Read(block, readBuffer), "Read failed")
+			require.Equal(t, "durable", string(readBuffer[:7]), "Data mismatch after reopen")
+		})
+	}
+
+	require.Equal(t, "SyncPolicy(9)", SyncPolicy(9).String())
+}
+
+func TestFileMgrConcurrentAppend(t *testing.T) {
+	blockSize := 512
+	fm, err := NewFileMgrWithOptions(t.TempDir(), blockSize, Options{Sync: SyncNone})
+	require.NoError(t, err, "Failed to create FileMgr")
+
+	numWorkers := 8
+	appendsPerWorker := 25
+
+	var wg sync.WaitGroup
+	blocks := make(chan int, numWorkers*appendsPerWorker)
+	errCh := make(chan error, numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data := make([]byte, blockSize)
+			for i := 0; i < appendsPerWorker; i++ {
+				blk, err := fm.Append("concurrentfile")
+				if err != nil {
+					errCh <- err
+					return
+				}
+				copy(data, blk.String())
+				if err := fm.Write(blk, data); err != nil {
+					errCh <- err
+					return
+				}
+				if err := fm.Read(blk, make([]byte, blockSize)); err != nil {
+					errCh <- err
+					return
+				}
+				blocks <- blk.Blknum
+			}
+		}()
+	}
+	wg.Wait()
+	close(blocks)
+	close(errCh)
+
+	for err := range errCh {
+		require.NoError(t, err, "Concurrent I/O failed")
+	}
+
+	seen := make(map[int]bool)
+	for blknum := range blocks {
+		require.False(t, seen[blknum], "Block %d was appended twice", blknum)
+		seen[blknum] = true
+	}
+
+	total := numWorkers * appendsPerWorker
+	length, err := fm.Length("concurrentfile")
+	require.NoError(t, err, "Length failed")
+	require.Equal(t, total, length)
+
+	stats := fm.Stats()
+	require.Equal(t, int64(total), stats.Total.Appends)
+	require.Equal(t, int64(total), stats.Total.Writes)
+	require.Equal(t, int64(total), stats.Total.Reads)
+	require.Equal(t, stats.Total, stats.Files["concurrentfile"], "A single file should account for all I/O")
+	require.Equal(t, total, fm.GetWriteCount())
+	require.Equal(t, total, fm.GetReadCount())
+}
+
+func TestFileMgrStats(t *testing.T) {
+	blockSize := 512
+	fm, err := NewFileMgrWithOptions(t.TempDir(), blockSize, Options{Sync: SyncNone})
+	require.NoError(t, err, "Failed to create FileMgr")
+
+	data := make([]byte, blockSize)
+	for _, name := range []string{"file-a", "file-b"} {
+		blk, err := fm.Append(name)
+		require.NoError(t, err, "Append failed")
+		require.NoError(t, fm.Write(blk, data), "Write failed")
+	}
+	require.NoError(t, fm.Read(NewBlockId("file-a", 0), data), "Read failed")
+
+	stats := fm.Stats()
+	require.Len(t, stats.Files, 2)
+
+	a := stats.Files["file-a"]
+	require.Equal(t, int64(1), a.Reads)
+	require.Equal(t, int64(1), a.Writes)
+	require.Equal(t, int64(1), a.Appends)
+	require.Equal(t, int64(blockSize), a.BytesRead)
+	require.Equal(t, int64(2*blockSize), a.BytesWritten)
+
+	b := stats.Files["file-b"]
+	require.Equal(t, int64(0), b.Reads)
+	require.Equal(t, time.Duration(0), b.AvgReadLatency())
+
+	require.Equal(t, int64(1), stats.Total.Reads)
+	require.Equal(t, int64(2), stats.Total.Writes)
+	require.Equal(t, int64(4*blockSize), stats.Total.BytesWritten)
+	require.Equal(t, stats.Total.WriteTime/2, stats.Total.AvgWriteLatency())
+}
+
+func TestFileMgrClose(t *testing.T) {
+	blockSize := 512
+	fm, err := NewFileMgr(t.TempDir(), blockSize)
+	require.NoError(t, err, "Failed to create FileMgr")
+
+	blk, err := fm.Append("closefile")
+	require.NoError(t, err, "Append failed")
+
+	require.NoError(t, fm.Close(), "Close failed")
+
+	data := make([]byte, blockSize)
+	require.ErrorIs(t, fm.Read(blk, data), ErrClosed)
+	require.ErrorIs(t, fm.Write(blk, data), ErrClosed)
+	require.ErrorIs(t, fm.Sync("closefile"), ErrClosed)
+	_, err = fm.Append("closefile")
+	require.ErrorIs(t, err, ErrClosed)
+	_, err = fm.Length("closefile")
+	require.ErrorIs(t, err, ErrClosed)
+	require.ErrorIs(t, fm.Close(), ErrClosed, "A second Close should fail")
+}
+
+func TestFileMgrLock(t *testing.T) {
+	if !flockSupported {
+		t.Skip("flock is not supported on this platform")
+	}
+	testDir := t.TempDir()
+	blockSize := 512
+
+	fm, err := NewFileMgr(testDir, blockSize)
+	require.NoError(t, err, "Failed to create FileMgr")
+	require.True(t, fm.IsNew(), "The lock file should not make a database look existing")
+	blk, err := fm.Append("lockfile")
+	require.NoError(t, err, "Append failed")
+
+	t.Run("Second writer", func(t *testing.T) {
+		_, err := NewFileMgr(testDir, blockSize)
+		require.ErrorIs(t, err, ErrLocked)
+		var le *LockedError
+		require.ErrorAs(t, err, &le)
+		require.Equal(t, os.Getpid(), le.PID, "The error should name the holder")
+		require.Contains(t, err.Error(), testDir)
+	})
+
+	t.Run("Reader alongside a writer", func(t *testing.T) {
+		_, err := NewFileMgrWithOptions(testDir, blockSize, Options{ReadOnly: true})
+		require.ErrorIs(t, err, ErrLocked)
+	})
+
+	require.NoError(t, fm.Close(), "Close failed")
+
+	t.Run("Shared readers", func(t *testing.T) {
+		tmp := filepath.Join(testDir, "temp1")
+		require.NoError(t, os.WriteFile(tmp, []byte("scratch"), 0666))
+
+		r1, err := NewFileMgrWithOptions(testDir, blockSize, Options{ReadOnly: true})
+		require.NoError(t, err, "Failed to open read-only")
+		r2, err := NewFileMgrWithOptions(testDir, blockSize, Options{ReadOnly: true})
+		require.NoError(t, err, "Read-only opens should share the lock")
+		require.True(t, r1.ReadOnly())
+		require.FileExists(t, tmp, "A read-only open should leave temporary files alone")
+
+		data := make([]byte, blockSize)
+		require.NoError(t, r1.Read(blk, data), "Read failed")
+		require.ErrorIs(t, r1.Write(blk, data), ErrReadOnly)
+		_, err = r1.Append("lockfile")
+		require.ErrorIs(t, err, ErrReadOnly)
+
+		_, err = NewFileMgr(testDir, blockSize)
+		var le *LockedError
+		require.ErrorAs(t, err, &le, "A writer should wait for the readers")
+		require.Equal(t, 0, le.PID, "Readers do not record a PID")
+
+		require.NoError(t, r1.Close())
+		require.NoError(t, r2.Close())
+	})
+
+	t.Run("Shared reader without a lock file", func(t *testing.T) {
+		lockFile := filepath.Join(testDir, LockFile)
+		require.NoError(t, os.Remove(lockFile))
+
+		r, err := NewFileMgrWithOptions(testDir, blockSize, Options{ReadOnly: true})
+		require.NoError(t, err, "A read-only open should not need a lock file")
+		require.NoFileExists(t, lockFile, "A read-only open should not create the lock file")
+
+		_, err = NewFileMgr(testDir, blockSize)
+		require.ErrorIs(t, err, ErrLocked, "A writer should wait for a reader locking the directory")
+		require.NoError(t, r.Close())
+	})
+
+	t.Run("Reopen after Close", func(t *testing.T) {
+		fm, err := NewFileMgr(testDir, blockSize)
+		require.NoError(t, err, "Close should release the lock")
+		require.NoError(t, fm.Close())
+	})
+
+	t.Run("Read-only without a database", func(t *testing.T) {
+		_, err := NewFileMgrWithOptions(t.TempDir(), blockSize, Options{ReadOnly: true})
+		require.Error(t, err)
+	})
+}
+
+func TestFileMgrTempFiles(t *testing.T) {
+	blockSize := 64
+	st := NewMemStorage()
+	fm, err := NewFileMgrWithOptions("tempdb", blockSize, Options{Storage: st})
+	require.NoError(t, err, "Failed to create FileMgr")
+
+	// A temp file left behind by an earlier run is not reused.
+	stale, err := st.Open("temp1")
+	require.NoError(t, err)
+	require.NoError(t, stale.Close())
+
+	t1a, err := fm.CreateTempFile(1)
+	require.NoError(t, err, "CreateTempFile failed")
+	t1b, err := fm.CreateTempFile(1)
+	require.NoError(t, err, "CreateTempFile failed")
+	t2, err := fm.CreateTempFile(2)
+	require.NoError(t, err, "CreateTempFile failed")
+	require.NotContains(t, []string{t1a, t1b, t2}, "temp1")
+	require.Len(t, map[string]bool{t1a: true, t1b: true, t2: true}, 3, "Temp file names should be unique")
+	require.Equal(t, []string{t1a, t1b}, fm.TempFiles(1))
+
+	for i := 0; i < 3; i++ {
+		_, err := fm.Append(t1a)
+		require.NoError(t, err, "Append failed")
+	}
+
+	t.Run("Truncate", func(t *testing.T) {
+		require.NoError(t, fm.Truncate(t1a, 1), "Truncate failed")
+		length, err := fm.Length(t1a)
+		require.NoError(t, err)
+		require.Equal(t, 1, length)
+
+		require.NoError(t, fm.Truncate(t1a, 5), "Truncate should not grow a file")
+		length, err = fm.Length(t1a)
+		require.NoError(t, err)
+		require.Equal(t, 1, length)
+
+		require.Error(t, fm.Truncate(t1a, -1))
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		require.NoError(t, fm.ReleaseTempFiles(1), "ReleaseTempFiles failed")
+		require.Empty(t, fm.TempFiles(1))
+		names, err := st.List()
+		require.NoError(t, err)
+		require.NotContains(t, names, t1a)
+		require.NotContains(t, names, t1b)
+		require.Contains(t, names, t2, "Files of other owners should be kept")
+		require.NoError(t, fm.ReleaseTempFiles(1), "Releasing twice should be harmless")
+	})
+
+	t.Run("DeleteFile", func(t *testing.T) {
+		blk, err := fm.Append("datafile")
+		require.NoError(t, err)
+		require.NoError(t, fm.DeleteFile("datafile"), "DeleteFile failed")
+		names, err := st.List()
+		require.NoError(t, err)
+		require.NotContains(t, names, "datafile")
+		require.NoError(t, fm.DeleteFile("datafile"), "Deleting a missing file should be harmless")
+
+		// The file is recreated empty on next use.
+		length, err := fm.Length(blk.Filename)
+		require.NoError(t, err)
+		require.Equal(t, 0, length)
+	})
+
+	t.Run("Close removes unreleased temp files", func(t *testing.T) {
+		require.NoError(t, fm.Close(), "Close failed")
+		names, err := st.List()
+		require.NoError(t, err)
+		require.NotContains(t, names, t2)
+	})
+}
@@ -0,0 +1,166 @@
+package file
+
+import (
+	"fmt"
+	"sync"
+)
+
+// FreeSpaceSuffix is appended to the name of a data file to name its free-space map.
+const FreeSpaceSuffix = ".fsm"
+
+// freeSpaceLevels is the number of steps in which free space is recorded.
+const freeSpaceLevels = 255
+
+// FreeSpaceMap records how much of each block of a data file is free, so
+// that space released by deletes can be reused instead of growing the file.
+//
+// The map is kept in its own file, named after the data file with
+// FreeSpaceSuffix, holding one byte per data block. A byte is the free space
+// of its block in units of 1/255 of a page, rounded down, so a block has at
+// least the recorded space free. Blocks the map does not cover are recorded
+// as full. The map is a hint that is not synced with the data file: callers
+// must check that a block really has room before using it.
+//
+// A FreeSpaceMap is safe for concurrent use, but there must be only one per
+// data file.
+type FreeSpaceMap struct {
+	fm       *FileMgr
+	filename string
+	mapfile  string
+	mu       sync.Mutex
+}
+
+// NewFreeSpaceMap returns the free-space map of a data file.
+func NewFreeSpaceMap(fm *FileMgr, filename string) *FreeSpaceMap {
+	return &FreeSpaceMap{fm: fm, filename: filename, mapfile: filename + FreeSpaceSuffix}
+}
+
+// Allocate returns a block of the data file with at least need bytes free,
+// appending a new block if there is none. The space is recorded as used, so
+// concurrent callers get different space; callers should call Update once
+// they know the exact free space of the block.
+func (fsm *FreeSpaceMap) Allocate(need int) (BlockId, error) {
+	pageSize := fsm.fm.BlockSize()
+	if need < 0 || need > pageSize {
+		return BlockId{}, fmt.Errorf("cannot allocate %d bytes in blocks of %d", need, pageSize)
+	}
+
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+
+	length, err := fsm.fm.Length(fsm.filename)
+	if err != nil {
+		return BlockId{}, err
+	}
+	mapLength, err := fsm.fm.Length(fsm.mapfile)
+	if err != nil {
+		return BlockId{}, err
+	}
+
+	p := NewPage(pageSize)
+	for mapBlk := 0; mapBlk < mapLength; mapBlk++ {
+		if err := fsm.fm.Read(NewBlockId(fsm.mapfile, mapBlk), p.Contents()); err != nil {
+			return BlockId{}, err
+		}
+		for i, level := range p.Contents() {
+			blknum := mapBlk*pageSize + i
+			if blknum >= length {
+				break
+			}
+			if free := levelToFree(level, pageSize); free >= need && level > 0 {
+				blk := NewBlockId(fsm.filename, blknum)
+				return blk, fsm.set(blk, free-need)
+			}
+		}
+	}
+
+	blk, err := fsm.fm.Append(fsm.filename)
+	if err != nil {
+		return BlockId{}, err
+	}
+	return blk, fsm.set(blk, pageSize-need)
+}
+
+// Free records that a block of the data file is empty.
+func (fsm *FreeSpaceMap) Free(blk BlockId) error {
+	return fsm.Update(blk, fsm.fm.BlockSize())
+}
+
+// Update records the number of free bytes in a block of the data file.
+func (fsm *FreeSpaceMap) Update(blk BlockId, free int) error {
+	if blk.Filename != fsm.filename {
+		return fmt.Errorf("block %s is not in %s", blk, fsm.filename)
+	}
+	if free < 0 || free > fsm.fm.BlockSize() {
+		return fmt.Errorf("invalid free space %d for block %s", free, blk)
+	}
+
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+
+	length, err := fsm.fm.Length(fsm.filename)
+	if err != nil {
+		return err
+	}
+	if blk.Blknum < 0 || blk.Blknum >= length {
+		return fmt.Errorf("block %s is past the end of the file", blk)
+	}
+	return fsm.set(blk, free)
+}
+
+// FreeSpace returns the recorded number of free bytes in a block of the data
+// file. It may be less than the real free space, but never more.
+func (fsm *FreeSpaceMap) FreeSpace(blk BlockId) (int, error) {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+
+	mapBlk, idx := fsm.entry(blk)
+	mapLength, err := fsm.fm.Length(fsm.mapfile)
+	if err != nil || mapBlk.Blknum >= mapLength {
+		return 0, err
+	}
+	p := NewPage(fsm.fm.BlockSize())
+	if err := fsm.fm.Read(mapBlk, p.Contents()); err != nil {
+		return 0, err
+	}
+	return levelToFree(p.Contents()[idx], fsm.fm.BlockSize()), nil
+}
+
+// set records the free space of a block, extending the map if it does not
+// cover the block yet. It is called with fsm.mu held.
+func (fsm *FreeSpaceMap) set(blk BlockId, free int) error {
+	mapBlk, idx := fsm.entry(blk)
+	mapLength, err := fsm.fm.Length(fsm.mapfile)
+	if err != nil {
+		return err
+	}
+	for mapLength <= mapBlk.Blknum {
+		if _, err := fsm.fm.Append(fsm.mapfile); err != nil {
+			return err
+		}
+		mapLength++
+	}
+
+	p := NewPage(fsm.fm.BlockSize())
+	if err := fsm.fm.Read(mapBlk, p.Contents()); err != nil {
+		return err
+	}
+	p.Contents()[idx] = freeToLevel(free, fsm.fm.BlockSize())
+	return fsm.fm.Write(mapBlk, p.Contents())
+}
+
+// entry returns the map block and the offset in it that describe a data block.
+func (fsm *FreeSpaceMap) entry(blk BlockId) (BlockId, int) {
+	pageSize := fsm.fm.BlockSize()
+	return NewBlockId(fsm.mapfile, blk.Blknum/pageSize), blk.Blknum % pageSize
+}
+
+// freeToLevel converts a number of free bytes to a map entry, rounding down.
+func freeToLevel(free, pageSize int) byte {
+	return byte(free * freeSpaceLevels / pageSize)
+}
+
+// levelToFree converts a map entry to a number of free bytes, rounding down.
+func levelToFree(level byte, pageSize int) int {
+	return int(level) * pageSize / freeSpaceLevels
+}
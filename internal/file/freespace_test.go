@@ -0,0 +1,105 @@
+package file
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreeSpaceMap(t *testing.T) {
+	blockSize := 64
+	st := NewMemStorage()
+	fm, err := NewFileMgrWithOptions("fsmdb", blockSize, Options{Storage: st})
+	require.NoError(t, err, "Failed to create FileMgr")
+
+	fsm := NewFreeSpaceMap(fm, "table")
+
+	t.Run("Allocate grows an empty file", func(t *testing.T) {
+		blk, err := fsm.Allocate(40)
+		require.NoError(t, err, "Allocate failed")
+		require.Equal(t, NewBlockId("table", 0), blk)
+
+		free, err := fsm.FreeSpace(blk)
+		require.NoError(t, err)
+		require.LessOrEqual(t, free, blockSize-40, "The map must not overstate free space")
+		require.Greater(t, free, blockSize-40-2)
+
+		// The rest of block 0 is too small, so a new block is appended.
+		blk, err = fsm.Allocate(40)
+		require.NoError(t, err, "Allocate failed")
+		require.Equal(t, 1, blk.Blknum)
+	})
+
+	t.Run("Small requests fill partly used blocks", func(t *testing.T) {
+		blk, err := fsm.Allocate(10)
+		require.NoError(t, err, "Allocate failed")
+		require.Equal(t, 0, blk.Blknum)
+	})
+
+	t.Run("Freed blocks are reused", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			_, err := fsm.Allocate(blockSize)
+			require.NoError(t, err, "Allocate failed")
+		}
+		length, err := fm.Length("table")
+		require.NoError(t, err)
+		require.Equal(t, 5, length)
+
+		require.NoError(t, fsm.Free(NewBlockId("table", 3)), "Free failed")
+		blk, err := fsm.Allocate(blockSize)
+		require.NoError(t, err, "Allocate failed")
+		require.Equal(t, 3, blk.Blknum, "A freed block should be reused before the file grows")
+
+		length, err = fm.Length("table")
+		require.NoError(t, err)
+		require.Equal(t, 5, length, "The file should not grow when a block is free")
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		blk := NewBlockId("table", 2)
+		require.NoError(t, fsm.Update(blk, 32), "Update failed")
+		free, err := fsm.FreeSpace(blk)
+		require.NoError(t, err)
+		require.LessOrEqual(t, free, 32)
+		require.Greater(t, free, 30)
+
+		require.Error(t, fsm.Update(blk, blockSize+1), "Free space cannot exceed a page")
+		require.Error(t, fsm.Update(NewBlockId("table", 99), 0), "The block must exist")
+		require.Error(t, fsm.Update(NewBlockId("other", 0), 0), "The block must be in the data file")
+		_, err = fsm.Allocate(blockSize + 1)
+		require.Error(t, err, "A request larger than a page cannot be satisfied")
+	})
+
+	t.Run("Map survives a reopen", func(t *testing.T) {
+		require.NoError(t, fm.Close())
+		fm, err := NewFileMgrWithOptions("fsmdb", blockSize, Options{Storage: st})
+		require.NoError(t, err, "Failed to reopen FileMgr")
+
+		fsm := NewFreeSpaceMap(fm, "table")
+		free, err := fsm.FreeSpace(NewBlockId("table", 2))
+		require.NoError(t, err)
+		require.Greater(t, free, 30)
+	})
+}
+
+func TestFreeSpaceMapManyBlocks(t *testing.T) {
+	blockSize := 16
+	fm, err := NewFileMgrWithOptions("fsmdb", blockSize, Options{Storage: NewMemStorage()})
+	require.NoError(t, err, "Failed to create FileMgr")
+
+	// Each map block covers blockSize data blocks, so 40 blocks need three.
+	fsm := NewFreeSpaceMap(fm, "table")
+	for i := 0; i < 40; i++ {
+		blk, err := fsm.Allocate(blockSize)
+		require.NoError(t, err, "Allocate failed")
+		require.Equal(t, i, blk.Blknum)
+	}
+	mapLength, err := fm.Length("table" + FreeSpaceSuffix)
+	require.NoError(t, err)
+	require.Equal(t, 3, mapLength)
+
+	require.NoError(t, fsm.Free(NewBlockId("table", 37)), "Free failed")
+	blk, err := fsm.Allocate(1)
+	require.NoError(t, err, "Allocate failed")
+	require.Equal(t, 37, blk.Blknum)
+}
@@ -0,0 +1,71 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LockFile is the name of the file that a FileMgr locks while it has a
+// database open.
+const LockFile = "simpledb.lock"
+
+// ErrLocked is matched by the error returned when a database is already
+// open in another process.
+var ErrLocked = errors.New("database is locked")
+
+// ErrReadOnly is returned by writes through a FileMgr opened read-only.
+var ErrReadOnly = errors.New("file manager is read-only")
+
+// LockedError reports that another process holds a conflicting lock on a
+// database directory.
+type LockedError struct {
+	Dir string
+	// PID is the process holding the lock, or 0 if it is not known.
+	PID int
+}
+
+func (e *LockedError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("database %s is locked by another process", e.Dir)
+	}
+	return fmt.Sprintf("database %s is locked by process %d", e.Dir, e.PID)
+}
+
+// Unwrap returns ErrLocked.
+func (e *LockedError) Unwrap() error {
+	return ErrLocked
+}
+
+// Locker is implemented by storages that can keep two processes from opening
+// the same database. A FileMgr takes the lock when it is created and releases
+// it when it is closed.
+type Locker interface {
+	// Lock takes a shared or exclusive lock and returns a function that
+	// releases it. It returns a *LockedError if another process holds a
+	// conflicting lock.
+	Lock(shared bool) (release func() error, err error)
+}
+
+// readLockPID returns the PID recorded in a lock file, or 0 if there is none.
+func readLockPID(r io.ReaderAt) int {
+	b := make([]byte, 32)
+	n, _ := r.ReadAt(b, 0)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b[:n])))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// writeLockPID records the current process in a lock file.
+func writeLockPID(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	return err
+}
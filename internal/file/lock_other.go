@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package file
+
+// flockSupported reports whether OSStorage locks the database directory.
+const flockSupported = false
+
+// Lock does nothing where flock is not available.
+func (s *OSStorage) Lock(shared bool) (func() error, error) {
+	return func() error { return nil }, nil
+}
@@ -0,0 +1,83 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package file
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// flockSupported reports whether OSStorage locks the database directory.
+const flockSupported = true
+
+// Lock takes an advisory flock on the lock file of the directory. The holder
+// of an exclusive lock records its PID in the file, so that a second opener
+// can report it.
+//
+// A shared lock does not create the lock file, so that a database on a
+// read-only file system can still be opened read-only. Without a lock file,
+// the directory itself is locked instead, which is why a writer locks the
+// directory as well as the lock file.
+func (s *OSStorage) Lock(shared bool) (func() error, error) {
+	if shared {
+		f, err := os.Open(filepath.Join(s.dir, LockFile))
+		if errors.Is(err, fs.ErrNotExist) {
+			f, err = os.Open(s.dir)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := s.flock(f, syscall.LOCK_SH); err != nil {
+			return nil, err
+		}
+		// Closing the file releases the lock.
+		return f.Close, nil
+	}
+
+	f, err := os.OpenFile(filepath.Join(s.dir, LockFile), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.flock(f, syscall.LOCK_EX); err != nil {
+		return nil, err
+	}
+	dir, err := os.Open(s.dir)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := s.flock(dir, syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := writeLockPID(f); err != nil {
+		dir.Close()
+		f.Close()
+		return nil, err
+	}
+
+	return func() error {
+		// Clear the PID so that it is not reported after the lock is released.
+		_ = f.Truncate(0)
+		// Closing the files releases the locks.
+		return errors.Join(dir.Close(), f.Close())
+	}, nil
+}
+
+// flock locks f without blocking. If another process holds a conflicting
+// lock, f is closed and a *LockedError is returned.
+func (s *OSStorage) flock(f *os.File, how int) error {
+	err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+	if err == nil {
+		return nil
+	}
+	pid := readLockPID(f)
+	f.Close()
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return &LockedError{Dir: s.dir, PID: pid}
+	}
+	return err
+}
@@ -1,17 +1,32 @@
 package file
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
+	"math"
+	"time"
 )
 
 // Define the int size
 const IntSize = 4
 
-// Page represents a block of memory that can store data.
+// Sizes of the other fixed-width values stored in a page.
+const (
+	Int64Size     = 8
+	Float64Size   = 8
+	BoolSize      = 1
+	DateSize      = 4
+	TimestampSize = 8
+	// MaxVarintSize is the largest number of bytes a varint can take.
+	MaxVarintSize = binary.MaxVarintLen64
+)
+
+// Page represents a block of memory that can store data. Strings are stored
+// in the charset of the page, which is UTF8 unless the page was created with
+// NewPageWithCharset.
 type Page struct {
-	data []byte
+	data    []byte
+	charset Charset
 }
 
 // NewPage creates a new Page with a given block size.
@@ -19,6 +34,11 @@ func NewPage(blockSize int) *Page {
 	return &Page{data: make([]byte, blockSize)}
 }
 
+// NewPageWithCharset creates a new Page that stores strings in the given charset.
+func NewPageWithCharset(blockSize int, cs Charset) *Page {
+	return &Page{data: make([]byte, blockSize), charset: cs}
+}
+
 // NewPageFromBytes creates a new Page from an existing byte slice (used for log pages).
 func NewPageFromBytes(b []byte) *Page {
 	return &Page{data: b}
@@ -63,24 +83,162 @@ func (p *Page) SetBytes(offset int, b []byte) error {
 	return nil
 }
 
-// GetString retrieves a string from the specified offset.
+// GetString retrieves a string from the specified offset. It returns an
+// error if the stored bytes are not valid in the charset of the page.
 func (p *Page) GetString(offset int) (string, error) {
 	b, err := p.GetBytes(offset)
 	if err != nil {
 		return "", err
 	}
-	return string(bytes.TrimRight(b, "\x00")), nil
+	return p.charset.decode(b)
 }
 
-// SetString stores a string at the specified offset.
+// SetString stores a string at the specified offset. It returns an error if
+// the string cannot be represented in the charset of the page.
 func (p *Page) SetString(offset int, s string) error {
-	b := []byte(s)
+	b, err := p.charset.encode(s)
+	if err != nil {
+		return err
+	}
 	return p.SetBytes(offset, b)
 }
 
-// MaxLength returns the maximum byte length required to store a string of given length.
+// Charset returns the charset in which the page stores strings.
+func (p *Page) Charset() Charset {
+	return p.charset
+}
+
+// MaxLength returns the maximum byte length required to store a string of
+// strlen characters in UTF-8, the default charset of a page.
 func MaxLength(strlen int) int {
-	return IntSize + strlen
+	return UTF8.MaxLength(strlen)
+}
+
+// VarintLength returns the number of bytes SetVarint uses to store n.
+func VarintLength(n int64) int {
+	var buf [MaxVarintSize]byte
+	return binary.PutVarint(buf[:], n)
+}
+
+// GetInt64 retrieves a 64-bit integer from the specified offset.
+func (p *Page) GetInt64(offset int) (int64, error) {
+	if err := p.checkRange(offset, Int64Size); err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(p.data[offset:])), nil
+}
+
+// SetInt64 writes a 64-bit integer to the specified offset.
+func (p *Page) SetInt64(offset int, n int64) error {
+	if err := p.checkRange(offset, Int64Size); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint64(p.data[offset:], uint64(n))
+	return nil
+}
+
+// GetFloat64 retrieves a float from the specified offset.
+func (p *Page) GetFloat64(offset int) (float64, error) {
+	n, err := p.GetInt64(offset)
+	return math.Float64frombits(uint64(n)), err
+}
+
+// SetFloat64 writes a float to the specified offset.
+func (p *Page) SetFloat64(offset int, f float64) error {
+	return p.SetInt64(offset, int64(math.Float64bits(f)))
+}
+
+// GetBool retrieves a boolean from the specified offset.
+func (p *Page) GetBool(offset int) (bool, error) {
+	if err := p.checkRange(offset, BoolSize); err != nil {
+		return false, err
+	}
+	return p.data[offset] != 0, nil
+}
+
+// SetBool writes a boolean to the specified offset.
+func (p *Page) SetBool(offset int, b bool) error {
+	if err := p.checkRange(offset, BoolSize); err != nil {
+		return err
+	}
+	p.data[offset] = 0
+	if b {
+		p.data[offset] = 1
+	}
+	return nil
+}
+
+// GetDate retrieves a date, stored as days since the Unix epoch, from the
+// specified offset. The date is returned as midnight UTC.
+func (p *Page) GetDate(offset int) (time.Time, error) {
+	days, err := p.GetInt(offset)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(days)*secondsPerDay, 0).UTC(), nil
+}
+
+// SetDate writes the date of t, in its own location, as days since the Unix
+// epoch to the specified offset. The time of day is dropped.
+func (p *Page) SetDate(offset int, t time.Time) error {
+	y, m, d := t.Date()
+	days := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / secondsPerDay
+	if days < math.MinInt32 || days > math.MaxInt32 {
+		return errors.New("date out of range")
+	}
+	return p.SetInt(offset, int32(days))
+}
+
+// GetTimestamp retrieves a timestamp, stored as microseconds since the Unix
+// epoch, from the specified offset. The timestamp is returned in UTC.
+func (p *Page) GetTimestamp(offset int) (time.Time, error) {
+	us, err := p.GetInt64(offset)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMicro(us).UTC(), nil
+}
+
+// SetTimestamp writes t as microseconds since the Unix epoch to the
+// specified offset. Precision below a microsecond is dropped.
+func (p *Page) SetTimestamp(offset int, t time.Time) error {
+	return p.SetInt64(offset, t.UnixMicro())
+}
+
+// GetVarint retrieves a variable-length integer from the specified offset
+// and returns it with the number of bytes it takes.
+func (p *Page) GetVarint(offset int) (int64, int, error) {
+	if err := p.checkRange(offset, 0); err != nil {
+		return 0, 0, err
+	}
+	n, size := binary.Varint(p.data[offset:])
+	if size <= 0 {
+		return 0, 0, errors.New("invalid varint")
+	}
+	return n, size, nil
+}
+
+// SetVarint writes a variable-length integer to the specified offset and
+// returns the number of bytes it takes, which is VarintLength(n).
+func (p *Page) SetVarint(offset int, n int64) (int, error) {
+	var buf [MaxVarintSize]byte
+	size := binary.PutVarint(buf[:], n)
+	if err := p.checkRange(offset, size); err != nil {
+		return 0, err
+	}
+	copy(p.data[offset:], buf[:size])
+	return size, nil
+}
+
+// secondsPerDay converts dates to and from Unix time.
+const secondsPerDay = 24 * 60 * 60
+
+// checkRange returns an error if size bytes at offset do not fit in the page.
+func (p *Page) checkRange(offset, size int) error {
+	if offset < 0 || offset+size > len(p.data) {
+		return errors.New("offset out of range")
+	}
+	return nil
 }
 
 // Contents returns the raw byte slice.
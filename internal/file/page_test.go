@@ -1,7 +1,10 @@
 package file
 
 import (
+	"math"
 	"testing"
+	"time"
+	"unicode/utf8"
 )
 
 func TestPageOperations(t *testing.T) {
@@ -70,9 +73,9 @@ func TestPageOperations(t *testing.T) {
 		t.Errorf("Expected error for out of range GetString, but got nil")
 	}
 
-	// Test MaxLength
+	// Test MaxLength, which allows for the widest UTF-8 characters
 	maxLen := MaxLength(10)
-	expectedLen := 10 + IntSize
+	expectedLen := IntSize + 10*4
 	if maxLen != expectedLen {
 		t.Errorf("Expected %d, got %d", expectedLen, maxLen)
 	}
@@ -83,3 +86,164 @@ func TestPageOperations(t *testing.T) {
 		t.Errorf("Expected %d, got %d", blockSize, len(contents))
 	}
 }
+
+func TestPageTypedAccessors(t *testing.T) {
+	blockSize := 64
+	page := NewPage(blockSize)
+
+	// Test SetInt64 and GetInt64
+	if err := page.SetInt64(0, -1<<40); err != nil {
+		t.Fatalf("SetInt64 failed: %v", err)
+	}
+	if n, err := page.GetInt64(0); err != nil || n != -1<<40 {
+		t.Errorf("Expected %d, got %d (err %v)", int64(-1<<40), n, err)
+	}
+	if err := page.SetInt64(blockSize-Int64Size+1, 1); err == nil {
+		t.Errorf("Expected error for out of range SetInt64, but got nil")
+	}
+
+	// Test SetFloat64 and GetFloat64
+	if err := page.SetFloat64(8, 3.25); err != nil {
+		t.Fatalf("SetFloat64 failed: %v", err)
+	}
+	if f, err := page.GetFloat64(8); err != nil || f != 3.25 {
+		t.Errorf("Expected 3.25, got %v (err %v)", f, err)
+	}
+
+	// Test SetBool and GetBool
+	for _, b := range []bool{true, false} {
+		if err := page.SetBool(16, b); err != nil {
+			t.Fatalf("SetBool failed: %v", err)
+		}
+		if got, err := page.GetBool(16); err != nil || got != b {
+			t.Errorf("Expected %t, got %t (err %v)", b, got, err)
+		}
+	}
+	if _, err := page.GetBool(blockSize); err == nil {
+		t.Errorf("Expected error for out of range GetBool, but got nil")
+	}
+
+	// Test SetDate and GetDate, before and after the epoch
+	for _, date := range []time.Time{
+		time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC),
+		time.Date(1969, time.July, 20, 0, 0, 0, 0, time.UTC),
+	} {
+		withTime := time.Date(date.Year(), date.Month(), date.Day(), 23, 59, 0, 0, time.FixedZone("JST", 9*60*60))
+		if err := page.SetDate(20, withTime); err != nil {
+			t.Fatalf("SetDate failed: %v", err)
+		}
+		if got, err := page.GetDate(20); err != nil || !got.Equal(date) {
+			t.Errorf("Expected %v, got %v (err %v)", date, got, err)
+		}
+	}
+
+	// Test SetTimestamp and GetTimestamp
+	ts := time.Date(2024, time.March, 1, 12, 34, 56, 789012345, time.UTC)
+	if err := page.SetTimestamp(24, ts); err != nil {
+		t.Fatalf("SetTimestamp failed: %v", err)
+	}
+	if got, err := page.GetTimestamp(24); err != nil || !got.Equal(ts.Truncate(time.Microsecond)) {
+		t.Errorf("Expected %v, got %v (err %v)", ts.Truncate(time.Microsecond), got, err)
+	}
+
+	// Test SetVarint and GetVarint
+	offset := 32
+	for _, n := range []int64{0, 1, -1, 63, -64, 64, 1 << 20, math.MaxInt64, math.MinInt64} {
+		size, err := page.SetVarint(offset, n)
+		if err != nil {
+			t.Fatalf("SetVarint(%d) failed: %v", n, err)
+		}
+		if size != VarintLength(n) || size > MaxVarintSize {
+			t.Errorf("SetVarint(%d) used %d bytes, VarintLength says %d", n, size, VarintLength(n))
+		}
+		got, gotSize, err := page.GetVarint(offset)
+		if err != nil || got != n || gotSize != size {
+			t.Errorf("Expected %d in %d bytes, got %d in %d bytes (err %v)", n, size, got, gotSize, err)
+		}
+	}
+	if VarintLength(1) != 1 || VarintLength(64) != 2 {
+		t.Errorf("Unexpected varint lengths %d and %d", VarintLength(1), VarintLength(64))
+	}
+	if _, err := page.SetVarint(blockSize-1, math.MaxInt64); err == nil {
+		t.Errorf("Expected error for out of range SetVarint, but got nil")
+	}
+	if _, _, err := page.GetVarint(blockSize); err == nil {
+		t.Errorf("Expected error for out of range GetVarint, but got nil")
+	}
+}
+
+func TestPageCharsets(t *testing.T) {
+	blockSize := 64
+
+	// A string of multi-byte characters fits in a slot sized by MaxLength
+	s := "データベースの設計実装"
+	if n := utf8.RuneCountInString(s); n != 11 {
+		t.Fatalf("Expected 11 characters, got %d", n)
+	}
+	page := NewPage(MaxLength(11))
+	if err := page.SetString(0, s); err != nil {
+		t.Fatalf("SetString failed for a string of MaxLength characters: %v", err)
+	}
+	if got, err := page.GetString(0); err != nil || got != s {
+		t.Errorf("Expected %q, got %q (err %v)", s, got, err)
+	}
+
+	// Trailing NULs are part of the string
+	page = NewPage(blockSize)
+	if err := page.SetString(0, "nul\x00\x00"); err != nil {
+		t.Fatalf("SetString failed: %v", err)
+	}
+	if got, err := page.GetString(0); err != nil || got != "nul\x00\x00" {
+		t.Errorf("Expected trailing NULs to be kept, got %q (err %v)", got, err)
+	}
+
+	// Stored bytes that are not valid in the charset are rejected
+	if err := page.SetBytes(0, []byte{0xff, 0xfe}); err != nil {
+		t.Fatalf("SetBytes failed: %v", err)
+	}
+	if _, err := page.GetString(0); err == nil {
+		t.Errorf("Expected error for invalid UTF-8, but got nil")
+	}
+	if err := page.SetString(0, "\xff"); err == nil {
+		t.Errorf("Expected error for storing invalid UTF-8, but got nil")
+	}
+
+	// A stored length past the end of the page is rejected
+	if err := page.SetInt(0, int32(blockSize)); err != nil {
+		t.Fatalf("SetInt failed: %v", err)
+	}
+	if _, err := page.GetString(0); err == nil {
+		t.Errorf("Expected error for a stored length past the end of the page, but got nil")
+	}
+
+	// Single-byte charsets
+	tests := []struct {
+		cs      Charset
+		valid   string
+		invalid string
+	}{
+		{ASCII, "plain text", "café"},
+		{Latin1, "café", "データ"},
+	}
+	for _, tt := range tests {
+		page := NewPageWithCharset(tt.cs.MaxLength(len([]rune(tt.valid))), tt.cs)
+		if page.Charset() != tt.cs || tt.cs.MaxBytesPerChar() != 1 {
+			t.Fatalf("Unexpected charset %s with %d bytes per character", page.Charset(), tt.cs.MaxBytesPerChar())
+		}
+		if err := page.SetString(0, tt.valid); err != nil {
+			t.Fatalf("SetString(%q) in %s failed: %v", tt.valid, tt.cs, err)
+		}
+		if got, err := page.GetString(0); err != nil || got != tt.valid {
+			t.Errorf("Expected %q in %s, got %q (err %v)", tt.valid, tt.cs, got, err)
+		}
+		if err := page.SetString(0, tt.invalid); err == nil {
+			t.Errorf("Expected error for storing %q in %s, but got nil", tt.invalid, tt.cs)
+		}
+	}
+	if _, err := NewPageWithCharset(blockSize, ASCII).GetString(0); err != nil {
+		t.Errorf("GetString of an empty string failed: %v", err)
+	}
+	if UTF8.String() != "UTF-8" || Charset(9).String() != "Charset(9)" {
+		t.Errorf("Unexpected charset names %s and %s", UTF8, Charset(9))
+	}
+}
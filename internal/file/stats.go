@@ -0,0 +1,85 @@
+package file
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// IOStats is a snapshot of I/O counters.
+type IOStats struct {
+	Reads        int64
+	Writes       int64
+	Appends      int64
+	BytesRead    int64
+	BytesWritten int64
+	ReadTime     time.Duration
+	WriteTime    time.Duration
+}
+
+// AvgReadLatency returns the average time spent in a read.
+func (s IOStats) AvgReadLatency() time.Duration {
+	if s.Reads == 0 {
+		return 0
+	}
+	return s.ReadTime / time.Duration(s.Reads)
+}
+
+// AvgWriteLatency returns the average time spent in a write.
+func (s IOStats) AvgWriteLatency() time.Duration {
+	if s.Writes == 0 {
+		return 0
+	}
+	return s.WriteTime / time.Duration(s.Writes)
+}
+
+// Stats is a snapshot of the I/O statistics of a FileMgr, in total and per file.
+type Stats struct {
+	Total IOStats
+	Files map[string]IOStats
+}
+
+// ioCounters accumulates I/O statistics and is safe for concurrent use.
+type ioCounters struct {
+	reads        atomic.Int64
+	writes       atomic.Int64
+	appends      atomic.Int64
+	bytesRead    atomic.Int64
+	bytesWritten atomic.Int64
+	readNanos    atomic.Int64
+	writeNanos   atomic.Int64
+}
+
+// recordRead counts a read of n bytes that took d.
+func (c *ioCounters) recordRead(n int, d time.Duration) {
+	c.reads.Add(1)
+	c.bytesRead.Add(int64(n))
+	c.readNanos.Add(int64(d))
+}
+
+// recordWrite counts a write of n bytes that took d.
+func (c *ioCounters) recordWrite(n int, d time.Duration) {
+	c.writes.Add(1)
+	c.bytesWritten.Add(int64(n))
+	c.writeNanos.Add(int64(d))
+}
+
+// recordAppend counts an append of a block of n bytes that took d. Appends
+// count towards bytes and time written, but not towards Writes.
+func (c *ioCounters) recordAppend(n int, d time.Duration) {
+	c.appends.Add(1)
+	c.bytesWritten.Add(int64(n))
+	c.writeNanos.Add(int64(d))
+}
+
+// snapshot returns the current values of the counters.
+func (c *ioCounters) snapshot() IOStats {
+	return IOStats{
+		Reads:        c.reads.Load(),
+		Writes:       c.writes.Load(),
+		Appends:      c.appends.Load(),
+		BytesRead:    c.bytesRead.Load(),
+		BytesWritten: c.bytesWritten.Load(),
+		ReadTime:     time.Duration(c.readNanos.Load()),
+		WriteTime:    time.Duration(c.writeNanos.Load()),
+	}
+}
@@ -0,0 +1,162 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Storage is the backend in which a FileMgr keeps the files of a database.
+// Implementations must be safe for concurrent use.
+type Storage interface {
+	// Open opens the named file for reading and writing, creating it if it
+	// does not exist. A file it creates survives a crash once Open returns,
+	// though its contents only do once they are synced.
+	Open(name string) (StorageFile, error)
+	// Remove deletes the named file. The removal survives a crash once
+	// Remove returns.
+	Remove(name string) error
+	// Rename atomically replaces newname with the file named oldname. The
+	// rename survives a crash once Rename returns.
+	Rename(oldname, newname string) error
+	// List returns the names of the files in the storage.
+	List() ([]string, error)
+}
+
+// StorageFile is a file opened from a Storage. ReadAt and WriteAt follow the
+// io.ReaderAt and io.WriterAt contracts and may be called concurrently.
+type StorageFile interface {
+	io.ReaderAt
+	io.WriterAt
+	// Size returns the size of the file in bytes.
+	Size() (int64, error)
+	// Truncate changes the size of the file.
+	Truncate(size int64) error
+	// Sync commits the contents of the file to stable storage.
+	Sync() error
+	// Close releases the file.
+	Close() error
+}
+
+// OSStorage keeps files in a directory of the local file system.
+type OSStorage struct {
+	dir      string
+	dsync    bool
+	readOnly bool
+}
+
+// NewOSStorage returns an OSStorage for the given directory, creating the
+// directory if it does not exist.
+func NewOSStorage(dir string) (*OSStorage, error) {
+	return newOSStorage(dir, false, false)
+}
+
+// newOSStorage returns an OSStorage that opens files with O_DSYNC if dsync is
+// set. A read-only storage opens existing files for reading and does not
+// create the directory.
+func newOSStorage(dir string, dsync, readOnly bool) (*OSStorage, error) {
+	if readOnly {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, err
+		}
+	} else if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &OSStorage{dir: dir, dsync: dsync, readOnly: readOnly}, nil
+}
+
+// Dir returns the directory of the storage.
+func (s *OSStorage) Dir() string {
+	return s.dir
+}
+
+// Open opens the named file in the directory, creating it if it does not
+// exist. A read-only storage only opens existing files. The directory is
+// fsynced after a file is created, since fsyncing the file alone does not
+// make its directory entry durable. If that fails, the file is removed again
+// so that a retry creates and syncs it anew.
+func (s *OSStorage) Open(name string) (StorageFile, error) {
+	path := filepath.Join(s.dir, name)
+	if s.readOnly {
+		f, err := os.OpenFile(path, os.O_RDONLY, 0)
+		if err != nil {
+			return nil, err
+		}
+		return osFile{f}, nil
+	}
+
+	flag := os.O_RDWR
+	if s.dsync {
+		flag |= dsyncFlag
+	}
+	f, err := os.OpenFile(path, flag|os.O_CREATE|os.O_EXCL, 0666)
+	if errors.Is(err, fs.ErrExist) {
+		if f, err = os.OpenFile(path, flag, 0666); err != nil {
+			return nil, err
+		}
+		return osFile{f}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := syncDir(s.dir); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("sync directory after creating %s: %w", name, err)
+	}
+	return osFile{f}, nil
+}
+
+// Remove deletes the named file from the directory and fsyncs the directory.
+func (s *OSStorage) Remove(name string) error {
+	if err := os.Remove(filepath.Join(s.dir, name)); err != nil {
+		return err
+	}
+	if err := syncDir(s.dir); err != nil {
+		return fmt.Errorf("sync directory after removing %s: %w", name, err)
+	}
+	return nil
+}
+
+// Rename renames a file in the directory and syncs the directory.
+func (s *OSStorage) Rename(oldname, newname string) error {
+	if err := os.Rename(filepath.Join(s.dir, oldname), filepath.Join(s.dir, newname)); err != nil {
+		return err
+	}
+	if err := syncDir(s.dir); err != nil {
+		return fmt.Errorf("sync directory after renaming %s to %s: %w", oldname, newname, err)
+	}
+	return nil
+}
+
+// List returns the names of the regular files in the directory.
+func (s *OSStorage) List() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// osFile adapts *os.File to StorageFile.
+type osFile struct {
+	*os.File
+}
+
+// Size returns the size of the file in bytes.
+func (f osFile) Size() (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
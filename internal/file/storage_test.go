@@ -0,0 +1,105 @@
+package file
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	osStorage, err := NewOSStorage(t.TempDir())
+	require.NoError(t, err, "Failed to create OSStorage")
+
+	storages := map[string]Storage{
+		"os":  osStorage,
+		"mem": NewMemStorage(),
+	}
+
+	for name, st := range storages {
+		t.Run(name, func(t *testing.T) {
+			f, err := st.Open("storagefile")
+			require.NoError(t, err, "Open failed")
+
+			size, err := f.Size()
+			require.NoError(t, err, "Size failed")
+			require.Equal(t, int64(0), size, "A new file should be empty")
+
+			_, err = f.WriteAt([]byte("hello"), 10)
+			require.NoError(t, err, "WriteAt failed")
+			size, err = f.Size()
+			require.NoError(t, err, "Size failed")
+			require.Equal(t, int64(15), size)
+
+			buf := make([]byte, 15)
+			n, err := f.ReadAt(buf, 0)
+			require.NoError(t, err, "ReadAt failed")
+			require.Equal(t, 15, n)
+			require.Equal(t, make([]byte, 10), buf[:10], "The gap before a write should read as zeros")
+			require.Equal(t, "hello", string(buf[10:]))
+
+			n, err = f.ReadAt(buf, 12)
+			require.ErrorIs(t, err, io.EOF, "A read past the end should return io.EOF")
+			require.Equal(t, 3, n)
+
+			require.NoError(t, f.Truncate(12), "Truncate failed")
+			size, err = f.Size()
+			require.NoError(t, err, "Size failed")
+			require.Equal(t, int64(12), size)
+			require.NoError(t, f.Sync(), "Sync failed")
+			require.NoError(t, f.Close(), "Close failed")
+
+			// Reopening sees the same contents.
+			f, err = st.Open("storagefile")
+			require.NoError(t, err, "Open failed")
+			n, err = f.ReadAt(buf[:2], 10)
+			require.NoError(t, err, "ReadAt failed")
+			require.Equal(t, "he", string(buf[:n]))
+			require.NoError(t, f.Close(), "Close failed")
+
+			names, err := st.List()
+			require.NoError(t, err, "List failed")
+			require.Equal(t, []string{"storagefile"}, names)
+
+			require.NoError(t, st.Remove("storagefile"), "Remove failed")
+			names, err = st.List()
+			require.NoError(t, err, "List failed")
+			require.Empty(t, names)
+			require.Error(t, st.Remove("storagefile"), "Removing a missing file should fail")
+		})
+	}
+}
+
+func TestFileMgrMemStorage(t *testing.T) {
+	blockSize := 512
+	st := NewMemStorage()
+
+	fm, err := NewFileMgrWithOptions("memdb", blockSize, Options{Storage: st})
+	require.NoError(t, err, "Failed to create FileMgr")
+	require.True(t, fm.IsNew(), "An empty storage should be a new database")
+
+	blk, err := fm.Append("memfile")
+	require.NoError(t, err, "Append failed")
+	data := make([]byte, blockSize)
+	copy(data, "in memory")
+	require.NoError(t, fm.Write(blk, data), "Write failed")
+	require.NoError(t, fm.Close(), "Close failed")
+
+	// Temporary files are removed when the database is reopened.
+	tmp, err := st.Open("temp1")
+	require.NoError(t, err)
+	_, err = tmp.WriteAt([]byte("scratch"), 0)
+	require.NoError(t, err)
+
+	fm, err = NewFileMgrWithOptions("memdb", blockSize, Options{Storage: st})
+	require.NoError(t, err, "Failed to reopen FileMgr")
+	require.False(t, fm.IsNew(), "A storage with files should not be a new database")
+
+	names, err := st.List()
+	require.NoError(t, err, "List failed")
+	require.Equal(t, []string{"memfile", SuperblockFile}, names)
+
+	readBuffer := make([]byte, blockSize)
+	require.NoError(t, fm.Read(blk, readBuffer), "Read failed")
+	require.Equal(t, "in memory", string(readBuffer[:9]))
+}
@@ -0,0 +1,229 @@
+package file
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"time"
+)
+
+// SuperblockFile is the name of the file that records the format of a database.
+const SuperblockFile = "simpledb.meta"
+
+// superblockTempFile is the file a superblock is written to before it is
+// renamed into place.
+const superblockTempFile = SuperblockFile + ".tmp"
+
+// FormatVersion is the version of the on-disk format written by this code.
+// Version 2 frames every log record with a CRC. Version 3 sizes the strings
+// of SETINT and SETSTRING log records by their bytes.
+const FormatVersion = 3
+
+// LegacyFormatVersion is the format of a database created before superblocks
+// existed. Its blocks are laid out as in later versions, but its log records
+// have no CRC, so the log cannot be read by this code.
+const LegacyFormatVersion = 1
+
+// superblockMagic identifies a superblock file ("SDBM").
+const superblockMagic = 0x5344424d
+
+// superblockSize is the encoded size of a superblock: magic, version, block
+// size, flags, creation time, UUID and a CRC32C of the preceding fields.
+const superblockSize = 4 + 4 + 4 + 4 + 8 + 16 + 4
+
+// flagChecksums is set in the superblock flags when blocks carry checksums.
+const flagChecksums = 1
+
+// ErrIncompatibleDatabase is matched by the errors returned when a database
+// is opened with settings that do not match its superblock.
+var ErrIncompatibleDatabase = errors.New("incompatible database")
+
+// Superblock describes the on-disk format of a database. It is written when
+// the database is created and checked every time it is opened.
+type Superblock struct {
+	FormatVersion int
+	BlockSize     int
+	Checksums     bool
+	Created       time.Time
+	UUID          [16]byte
+}
+
+// newSuperblock returns a superblock for a database created now.
+func newSuperblock(blockSize int, checksums bool) (*Superblock, error) {
+	sb := &Superblock{
+		FormatVersion: FormatVersion,
+		BlockSize:     blockSize,
+		Checksums:     checksums,
+		Created:       time.Now(),
+	}
+	if _, err := rand.Read(sb.UUID[:]); err != nil {
+		return nil, err
+	}
+	// Mark the UUID as a random (version 4, RFC 4122 variant) UUID.
+	sb.UUID[6] = sb.UUID[6]&0x0f | 0x40
+	sb.UUID[8] = sb.UUID[8]&0x3f | 0x80
+	return sb, nil
+}
+
+// UUIDString returns the database UUID in its canonical text form.
+func (sb *Superblock) UUIDString() string {
+	u := sb.UUID
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// String returns a one-line description of the superblock.
+func (sb *Superblock) String() string {
+	return fmt.Sprintf("[format %d, block size %d, checksums %t, created %s, uuid %s]",
+		sb.FormatVersion, sb.BlockSize, sb.Checksums, sb.Created.UTC().Format(time.RFC3339), sb.UUIDString())
+}
+
+// check returns an error if the database cannot be opened with the given settings.
+func (sb *Superblock) check(dbDirectory string, blockSize int, checksums bool) error {
+	if sb.FormatVersion != FormatVersion && sb.FormatVersion != LegacyFormatVersion {
+		return fmt.Errorf("%w: database %s has format version %d, this build supports %d",
+			ErrIncompatibleDatabase, dbDirectory, sb.FormatVersion, FormatVersion)
+	}
+	if sb.BlockSize != blockSize {
+		return fmt.Errorf("%w: database %s has block size %d, opened with %d",
+			ErrIncompatibleDatabase, dbDirectory, sb.BlockSize, blockSize)
+	}
+	if sb.Checksums != checksums {
+		return fmt.Errorf("%w: database %s was created with checksums %t, opened with %t",
+			ErrIncompatibleDatabase, dbDirectory, sb.Checksums, checksums)
+	}
+	return nil
+}
+
+// checkBlockSize returns an error if one of the named files of a database
+// without a superblock is not a whole number of blocks long, which means the
+// database was created with a different block size.
+func checkBlockSize(st Storage, dbDirectory string, names []string, blockSize int) error {
+	for _, name := range names {
+		if name == LockFile || name == superblockTempFile || strings.HasPrefix(name, "temp") {
+			continue
+		}
+		f, err := st.Open(name)
+		if err != nil {
+			return err
+		}
+		size, err := f.Size()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("size of %s: %w", name, err)
+		}
+		if size%int64(blockSize) != 0 {
+			return fmt.Errorf("%w: file %s of database %s is %d bytes long, not a multiple of block size %d",
+				ErrIncompatibleDatabase, name, dbDirectory, size, blockSize)
+		}
+	}
+	return nil
+}
+
+// encode returns the on-disk form of the superblock.
+func (sb *Superblock) encode() []byte {
+	b := make([]byte, superblockSize)
+	binary.BigEndian.PutUint32(b[0:], superblockMagic)
+	binary.BigEndian.PutUint32(b[4:], uint32(sb.FormatVersion))
+	binary.BigEndian.PutUint32(b[8:], uint32(sb.BlockSize))
+	var flags uint32
+	if sb.Checksums {
+		flags |= flagChecksums
+	}
+	binary.BigEndian.PutUint32(b[12:], flags)
+	binary.BigEndian.PutUint64(b[16:], uint64(sb.Created.UnixNano()))
+	copy(b[24:40], sb.UUID[:])
+	binary.BigEndian.PutUint32(b[40:], crc32.Checksum(b[:40], castagnoli))
+	return b
+}
+
+// decodeSuperblock parses the on-disk form of a superblock.
+func decodeSuperblock(b []byte) (*Superblock, error) {
+	if len(b) < superblockSize || binary.BigEndian.Uint32(b[0:]) != superblockMagic {
+		return nil, errors.New("not a superblock")
+	}
+	if binary.BigEndian.Uint32(b[40:]) != crc32.Checksum(b[:40], castagnoli) {
+		return nil, fmt.Errorf("superblock %w", ErrChecksumMismatch)
+	}
+	sb := &Superblock{
+		FormatVersion: int(binary.BigEndian.Uint32(b[4:])),
+		BlockSize:     int(binary.BigEndian.Uint32(b[8:])),
+		Checksums:     binary.BigEndian.Uint32(b[12:])&flagChecksums != 0,
+		Created:       time.Unix(0, int64(binary.BigEndian.Uint64(b[16:]))),
+	}
+	copy(sb.UUID[:], b[24:40])
+	return sb, nil
+}
+
+// ReadSuperblock reads the superblock of a database without opening it, so
+// that tools can learn the settings to open it with. If st is nil, the
+// database is read from dbDirectory on the local file system. It returns nil
+// if the database has no superblock.
+func ReadSuperblock(dbDirectory string, st Storage) (*Superblock, error) {
+	if st == nil {
+		oss, err := newOSStorage(dbDirectory, false, true)
+		if err != nil {
+			return nil, err
+		}
+		st = oss
+	}
+	return readSuperblock(st)
+}
+
+// readSuperblock reads the superblock of a storage. It returns nil if the
+// storage has no superblock.
+func readSuperblock(st Storage) (*Superblock, error) {
+	names, err := st.List()
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, name := range names {
+		found = found || name == SuperblockFile
+	}
+	if !found {
+		return nil, nil
+	}
+
+	f, err := st.Open(SuperblockFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b := make([]byte, superblockSize)
+	if _, err := f.ReadAt(b, 0); err != nil {
+		return nil, fmt.Errorf("read %s: %w", SuperblockFile, err)
+	}
+	sb, err := decodeSuperblock(b)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", SuperblockFile, err)
+	}
+	return sb, nil
+}
+
+// writeSuperblock writes the superblock of a storage. It is written to a
+// temporary file, which is synced and renamed over the superblock file, so
+// that a crash leaves either the old superblock or the new one.
+func writeSuperblock(st Storage, sb *Superblock) error {
+	f, err := st.Open(superblockTempFile)
+	if err != nil {
+		return err
+	}
+	err = f.Truncate(0)
+	if err == nil {
+		_, err = f.WriteAt(sb.encode(), 0)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("write %s: %w", superblockTempFile, err)
+	}
+	return st.Rename(superblockTempFile, SuperblockFile)
+}
@@ -0,0 +1,129 @@
+package file
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuperblock(t *testing.T) {
+	st := NewMemStorage()
+
+	fm, err := NewFileMgrWithOptions("sbdb", 400, Options{Storage: st, Checksums: true})
+	require.NoError(t, err, "Failed to create FileMgr")
+	sb := fm.Superblock()
+	require.Equal(t, FormatVersion, sb.FormatVersion)
+	require.Equal(t, 400, sb.BlockSize)
+	require.True(t, sb.Checksums)
+	require.False(t, sb.Created.IsZero(), "The creation time should be recorded")
+	require.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, sb.UUIDString())
+	require.NoError(t, fm.Close())
+
+	t.Run("Read without opening", func(t *testing.T) {
+		read, err := ReadSuperblock("sbdb", st)
+		require.NoError(t, err)
+		require.Equal(t, sb.UUID, read.UUID)
+		require.Equal(t, 400, read.BlockSize)
+		require.True(t, read.Checksums)
+
+		read, err = ReadSuperblock("nodb", NewMemStorage())
+		require.NoError(t, err)
+		require.Nil(t, read, "A storage without a superblock has none to read")
+	})
+
+	t.Run("Reopen with the same settings", func(t *testing.T) {
+		fm, err := NewFileMgrWithOptions("sbdb", 400, Options{Storage: st, Checksums: true})
+		require.NoError(t, err, "Failed to reopen FileMgr")
+		reopened := fm.Superblock()
+		require.Equal(t, sb.UUID, reopened.UUID, "The UUID should survive a reopen")
+		require.True(t, sb.Created.Equal(reopened.Created), "The creation time should survive a reopen")
+		require.NoError(t, fm.Close())
+	})
+
+	t.Run("Block size mismatch", func(t *testing.T) {
+		_, err := NewFileMgrWithOptions("sbdb", 512, Options{Storage: st, Checksums: true})
+		require.ErrorIs(t, err, ErrIncompatibleDatabase)
+		require.ErrorContains(t, err, "block size 400, opened with 512")
+	})
+
+	t.Run("Checksum mismatch", func(t *testing.T) {
+		_, err := NewFileMgrWithOptions("sbdb", 400, Options{Storage: st})
+		require.ErrorIs(t, err, ErrIncompatibleDatabase)
+	})
+
+	t.Run("Format version mismatch", func(t *testing.T) {
+		future := sb
+		future.FormatVersion = FormatVersion + 1
+		require.NoError(t, writeSuperblock(st, &future))
+		_, err := NewFileMgrWithOptions("sbdb", 400, Options{Storage: st, Checksums: true})
+		require.ErrorIs(t, err, ErrIncompatibleDatabase)
+		require.ErrorContains(t, err, "format version")
+	})
+
+	t.Run("Corrupt superblock", func(t *testing.T) {
+		f, err := st.Open(SuperblockFile)
+		require.NoError(t, err)
+		_, err = f.WriteAt([]byte{0xff}, 20)
+		require.NoError(t, err)
+		_, err = NewFileMgrWithOptions("sbdb", 400, Options{Storage: st, Checksums: true})
+		require.True(t, errors.Is(err, ErrChecksumMismatch), "Expected a checksum error, got %v", err)
+	})
+
+	t.Run("Database without a superblock", func(t *testing.T) {
+		legacy := NewMemStorage()
+		f, err := legacy.Open("data")
+		require.NoError(t, err)
+		_, err = f.WriteAt(make([]byte, 256), 0)
+		require.NoError(t, err)
+
+		fm, err := NewFileMgrWithOptions("legacy", 256, Options{Storage: legacy})
+		require.NoError(t, err, "A database without a superblock should be adopted")
+		require.False(t, fm.IsNew())
+		require.Equal(t, 256, fm.Superblock().BlockSize)
+
+		_, err = NewFileMgrWithOptions("legacy", 512, Options{Storage: legacy})
+		require.ErrorIs(t, err, ErrIncompatibleDatabase)
+	})
+
+	t.Run("Database without a superblock opened with the wrong block size", func(t *testing.T) {
+		legacy := NewMemStorage()
+		f, err := legacy.Open("data")
+		require.NoError(t, err)
+		_, err = f.WriteAt(make([]byte, 400), 0)
+		require.NoError(t, err)
+
+		_, err = NewFileMgrWithOptions("legacy", 512, Options{Storage: legacy})
+		require.ErrorIs(t, err, ErrIncompatibleDatabase)
+		require.ErrorContains(t, err, "not a multiple of block size 512")
+		read, err := ReadSuperblock("legacy", legacy)
+		require.NoError(t, err)
+		require.Nil(t, read, "No superblock should be recorded for a mismatched block size")
+
+		fm, err := NewFileMgrWithOptions("legacy", 400, Options{Storage: legacy})
+		require.NoError(t, err, "The database should open with its own block size")
+		require.Equal(t, 400, fm.Superblock().BlockSize)
+	})
+}
+
+func TestSuperblockInterruptedWrite(t *testing.T) {
+	st := NewMemStorage()
+	fm, err := NewFileMgrWithOptions("sbdb", 400, Options{Storage: st})
+	require.NoError(t, err, "Failed to create FileMgr")
+	uuid := fm.Superblock().UUID
+	require.NoError(t, fm.Close())
+
+	// A crash while writing a superblock leaves its temporary file behind.
+	f, err := st.Open(superblockTempFile)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("torn"), 0)
+	require.NoError(t, err)
+
+	fm, err = NewFileMgrWithOptions("sbdb", 400, Options{Storage: st})
+	require.NoError(t, err, "A leftover temporary superblock should not stop the database from opening")
+	require.Equal(t, uuid, fm.Superblock().UUID, "The superblock in place should be kept")
+	require.NoError(t, fm.Close())
+	names, err := st.List()
+	require.NoError(t, err)
+	require.NotContains(t, names, superblockTempFile, "The temporary superblock should be removed")
+}
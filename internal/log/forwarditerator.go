@@ -0,0 +1,228 @@
+package log
+
+import (
+	"fmt"
+
+	"database_design_and_implementation/internal/file"
+)
+
+// ForwardLogIterator provides a way to iterate over log records in append
+// order, from a starting block up to the tail of the log as it was when the
+// iterator was created.
+type ForwardLogIterator struct {
+	lf      *logFile
+	blknum  int
+	first   int
+	lastBlk int
+	p       *file.Page
+	offsets []int
+	next    int
+	lsn     int
+	tail    *logTail
+	// err is a failure to read a later block while looking for records,
+	// returned by the next call to Next.
+	err error
+}
+
+// NewForwardLogIterator creates a new ForwardLogIterator for a log kept in
+// the single file of the given block, starting at the first record of that
+// block. If the block begins with the rest of a record split across blocks,
+// the iterator starts at the beginning of that record instead.
+func NewForwardLogIterator(fm *file.FileMgr, blk file.BlockId) (*ForwardLogIterator, error) {
+	lf := singleLogFile(fm, blk.Filename)
+	first, length, err := lf.bounds()
+	if err != nil {
+		return nil, err
+	}
+	return newForwardLogIterator(lf, blk.Blknum, first, length-1, nil)
+}
+
+// newForwardLogIterator creates a new ForwardLogIterator that starts at block
+// blknum of a log whose blocks run from first to lastBlk. If tail is not nil,
+// the tail block is read from it.
+func newForwardLogIterator(lf *logFile, blknum, first, lastBlk int, tail *logTail) (*ForwardLogIterator, error) {
+	if blknum < first || blknum > lastBlk {
+		return nil, fmt.Errorf("log block %d is out of range [%d, %d]", blknum, first, lastBlk)
+	}
+
+	iterator := &ForwardLogIterator{
+		lf:      lf,
+		first:   first,
+		lastBlk: lastBlk,
+		p:       file.NewPage(lf.fm.BlockSize()),
+		tail:    tail,
+	}
+
+	if err := iterator.moveToBlock(blknum); err != nil {
+		return nil, err
+	}
+	if err := iterator.backUpToRecordStart(); err != nil {
+		return nil, err
+	}
+	return iterator, nil
+}
+
+// HasNext returns true if there are more log records to read, either in the
+// current block or in a later one. Blocks that hold no records are skipped,
+// so HasNext only returns true if Next has a record or an error to return.
+func (it *ForwardLogIterator) HasNext() bool {
+	if it.err == nil {
+		it.err = it.skipEmptyBlocks()
+	}
+	return it.err != nil || it.next < len(it.offsets)
+}
+
+// skipEmptyBlocks moves on from a block whose records have all been read to
+// the nearest later block that holds records, stopping at the last block.
+func (it *ForwardLogIterator) skipEmptyBlocks() error {
+	for it.next >= len(it.offsets) && it.blknum < it.lastBlk {
+		if err := it.moveToBlock(it.blknum + 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Next reads the next log record in append order, moving to the following
+// block once the current one is exhausted. A record split across blocks is
+// returned whole, with the LSN of its last fragment.
+func (it *ForwardLogIterator) Next() ([]byte, error) {
+	kind, data, err := it.nextFragment()
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case fragFull:
+		return data, nil
+	case fragFirst:
+	default:
+		return nil, fmt.Errorf("%s at LSN %d does not follow the start of its record", fragmentName(kind), it.lsn)
+	}
+
+	start := it.lsn
+	rec := append([]byte(nil), data...)
+	for kind != fragLast {
+		if !it.HasNext() {
+			return nil, fmt.Errorf("log record starting at LSN %d has no last fragment", start)
+		}
+		if kind, data, err = it.nextFragment(); err != nil {
+			return nil, err
+		}
+		if kind != fragMiddle && kind != fragLast {
+			return nil, fmt.Errorf("log record starting at LSN %d is interrupted by a %s", start, fragmentName(kind))
+		}
+		rec = append(rec, data...)
+	}
+	return rec, nil
+}
+
+// nextFragment reads the next fragment in append order and sets the LSN to
+// its position.
+func (it *ForwardLogIterator) nextFragment() (uint32, []byte, error) {
+	if !it.HasNext() {
+		return 0, nil, ErrNoMoreRecords
+	}
+	if it.err != nil {
+		return 0, nil, it.err
+	}
+
+	kind, data, err := readFragment(it.p, it.offsets[it.next], it.lf.block(it.blknum))
+	if err != nil {
+		return 0, nil, err
+	}
+	it.lsn = lsnAt(it.lf.fm.BlockSize(), it.blknum, it.offsets[it.next])
+	it.next++
+	return kind, data, nil
+}
+
+// LSN returns the LSN of the record most recently returned by Next.
+func (it *ForwardLogIterator) LSN() int {
+	return it.lsn
+}
+
+// skipBefore advances the iterator past the records whose LSN is less than
+// lsn, so that the next call to Next returns the first record at or after it.
+func (it *ForwardLogIterator) skipBefore(lsn int) error {
+	for it.HasNext() {
+		blknum, next := it.blknum, it.next
+		if _, err := it.Next(); err != nil {
+			return err
+		}
+		if it.LSN() >= lsn {
+			// Step back so that Next returns this record again.
+			if it.blknum != blknum {
+				if err := it.moveToBlock(blknum); err != nil {
+					return err
+				}
+			}
+			it.next = next
+			return nil
+		}
+	}
+	return nil
+}
+
+// backUpToRecordStart moves the iterator back to the block holding the first
+// fragment of a record, if the current block starts in the middle of one.
+func (it *ForwardLogIterator) backUpToRecordStart() error {
+	if len(it.offsets) == 0 {
+		return nil
+	}
+	kind, _, err := readFragment(it.p, it.offsets[0], it.lf.block(it.blknum))
+	if err != nil || kind == fragFull || kind == fragFirst {
+		return err
+	}
+
+	start := it.lf.block(it.blknum)
+	for blknum := it.blknum - 1; blknum >= it.first; blknum-- {
+		if err := it.moveToBlock(blknum); err != nil {
+			return err
+		}
+		if len(it.offsets) == 0 {
+			break
+		}
+		// The first fragment of a record is the newest one in its block.
+		it.next = len(it.offsets) - 1
+		kind, _, err := readFragment(it.p, it.offsets[it.next], it.lf.block(blknum))
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case fragFirst:
+			return nil
+		case fragMiddle:
+			continue
+		}
+		break
+	}
+	return fmt.Errorf("log block %s continues a record with no first fragment", start)
+}
+
+// moveToBlock reads the specified block and collects the offsets of its
+// records. Records are stored from the end of the page towards the boundary,
+// so the offsets are reversed to put them in append order.
+func (it *ForwardLogIterator) moveToBlock(blknum int) error {
+	blk := it.lf.block(blknum)
+	boundary, err := it.lf.read(blknum, it.p, it.tail)
+	if err != nil {
+		return err
+	}
+
+	var offsets []int
+	for pos := boundary; pos < it.lf.fm.BlockSize(); {
+		_, data, err := readFragment(it.p, pos, blk)
+		if err != nil {
+			return err
+		}
+		offsets = append(offsets, pos)
+		pos += fragHeaderSize + len(data)
+	}
+	for i, j := 0, len(offsets)-1; i < j; i, j = i+1, j-1 {
+		offsets[i], offsets[j] = offsets[j], offsets[i]
+	}
+
+	it.blknum = blknum
+	it.offsets = offsets
+	it.next = 0
+	return nil
+}
@@ -0,0 +1,214 @@
+package log
+
+import (
+	"fmt"
+	"testing"
+
+	"database_design_and_implementation/internal/file"
+)
+
+// setupForwardLog creates a log that spans several blocks and returns the LSNs of its records.
+func setupForwardLog(t *testing.T, numRecords int) (*LogMgr, *file.FileMgr, []int) {
+	fm := newTestFileMgr(t, file.NewMemStorage(), 64)
+
+	logMgr := newTestLogMgr(t, fm, "logfile-forward")
+	lsns := make([]int, numRecords)
+	for i := 0; i < numRecords; i++ {
+		lsn, err := logMgr.Append([]byte(fmt.Sprintf("record%02d", i)))
+		if err != nil {
+			t.Fatalf("Failed to append log record: %v", err)
+		}
+		lsns[i] = lsn
+		if i > 0 && lsns[i] <= lsns[i-1] {
+			t.Fatalf("Expected increasing LSNs, got %d after %d", lsns[i], lsns[i-1])
+		}
+	}
+	return logMgr, fm, lsns
+}
+
+// TestForwardLogIterator tests reading the log in append order across blocks.
+func TestForwardLogIterator(t *testing.T) {
+	numRecords := 20
+	logMgr, fm, lsns := setupForwardLog(t, numRecords)
+
+	t.Run("From first block", func(t *testing.T) {
+		iter, err := logMgr.ForwardIterator(0)
+		if err != nil {
+			t.Fatalf("Failed to create ForwardLogIterator: %v", err)
+		}
+
+		for i := 0; i < numRecords; i++ {
+			if !iter.HasNext() {
+				t.Fatalf("Expected more records, but iterator has no next element at index %d", i)
+			}
+			rec, err := iter.Next()
+			if err != nil {
+				t.Fatalf("Failed to read log record %d: %v", i, err)
+			}
+			if want := fmt.Sprintf("record%02d", i); string(rec) != want {
+				t.Fatalf("Mismatch: expected %s, but got %s", want, rec)
+			}
+			if iter.LSN() != lsns[i] {
+				t.Fatalf("Expected LSN %d for record %d, got %d", lsns[i], i, iter.LSN())
+			}
+		}
+
+		if iter.HasNext() {
+			t.Fatalf("Expected no more records, but iterator has next element")
+		}
+	})
+
+	t.Run("From later block", func(t *testing.T) {
+		iter, err := logMgr.ForwardIterator(1)
+		if err != nil {
+			t.Fatalf("Failed to create ForwardLogIterator: %v", err)
+		}
+
+		// Block 0 holds as many records as fit before the boundary.
+		perBlock := (fm.BlockSize() - file.IntSize) / (fragHeaderSize + len("record00"))
+		rec, err := iter.Next()
+		if err != nil {
+			t.Fatalf("Failed to read log record: %v", err)
+		}
+		if want := fmt.Sprintf("record%02d", perBlock); string(rec) != want {
+			t.Fatalf("Mismatch: expected %s, but got %s", want, rec)
+		}
+	})
+
+	t.Run("Out of range block", func(t *testing.T) {
+		if _, err := logMgr.ForwardIterator(100); err == nil {
+			t.Fatalf("Expected an error for a block past the tail of the log")
+		}
+	})
+}
+
+// TestSeekLSN tests positioning a forward iterator at a given LSN.
+func TestSeekLSN(t *testing.T) {
+	numRecords := 20
+	logMgr, _, lsns := setupForwardLog(t, numRecords)
+
+	for _, start := range []int{0, 6, 12, numRecords - 1} {
+		for _, lsn := range []int{lsns[start], lsns[start] - 1} {
+			iter, err := logMgr.SeekLSN(lsn)
+			if err != nil {
+				t.Fatalf("SeekLSN(%d) failed: %v", lsn, err)
+			}
+
+			count := 0
+			for iter.HasNext() {
+				rec, err := iter.Next()
+				if err != nil {
+					t.Fatalf("Failed to read log record: %v", err)
+				}
+				if want := fmt.Sprintf("record%02d", start+count); string(rec) != want {
+					t.Fatalf("Mismatch after SeekLSN(%d): expected %s, but got %s", lsn, want, rec)
+				}
+				count++
+			}
+			if count != numRecords-start {
+				t.Fatalf("Expected %d records after SeekLSN(%d), got %d", numRecords-start, lsn, count)
+			}
+		}
+	}
+
+	iter, err := logMgr.SeekLSN(lsns[numRecords-1] + 1)
+	if err != nil {
+		t.Fatalf("SeekLSN past the tail failed: %v", err)
+	}
+	if iter.HasNext() {
+		t.Fatalf("Expected no records after the tail of the log")
+	}
+}
+
+// TestSeekFlushedLSN tests that SeekFlushedLSN reads only the flushed
+// records, without flushing the log, even when a record that spans blocks has
+// been written ahead of its unflushed end.
+func TestSeekFlushedLSN(t *testing.T) {
+	blockSize := 64
+	fm := newTestFileMgr(t, file.NewMemStorage(), blockSize)
+	logMgr := newTestLogMgr(t, fm, "logfile-seekflushed")
+
+	lsns := appendRecords(t, logMgr, 0, 3)
+	if err := logMgr.Flush(lsns[2]); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	// Record 3 is flushed with the start of the spanning record, whose end
+	// is not.
+	appendRecords(t, logMgr, 3, 1)
+	if _, err := logMgr.Append(spanningRecord(4, 100)); err != nil {
+		t.Fatalf("Failed to append a spanning record: %v", err)
+	}
+
+	for _, want := range []int{4, 5} {
+		writes := fm.Stats().Total.Writes
+		iter, err := logMgr.SeekFlushedLSN(1)
+		if err != nil {
+			t.Fatalf("SeekFlushedLSN failed: %v", err)
+		}
+		if got := fm.Stats().Total.Writes; got != writes {
+			t.Fatalf("Expected SeekFlushedLSN not to write the log, it made %d writes", got-writes)
+		}
+		count := 0
+		for iter.HasNext() {
+			if _, err := iter.Next(); err != nil {
+				t.Fatalf("Failed to read flushed record %d: %v", count, err)
+			}
+			count++
+		}
+		if count != want {
+			t.Fatalf("Expected %d flushed records, got %d", want, count)
+		}
+		if err := logMgr.Flush(logMgr.LatestLSN()); err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+	}
+}
+
+// TestForwardLogIteratorSkipsEmptyBlocks tests that HasNext does not report
+// records in an empty tail block, so that it agrees with Next.
+func TestForwardLogIteratorSkipsEmptyBlocks(t *testing.T) {
+	blockSize := 64
+	fm := newTestFileMgr(t, file.NewMemStorage(), blockSize)
+
+	// Block 0 holds a record; the tail block 1 was appended but never written.
+	for i := 0; i < 2; i++ {
+		if _, err := fm.Append("logfile-emptytail"); err != nil {
+			t.Fatalf("Failed to append block: %v", err)
+		}
+	}
+	page := file.NewPage(blockSize)
+	boundary := blockSize - fragHeaderSize - len("record")
+	writeLogRecord(page, boundary, []byte("record"))
+	if err := page.SetInt(0, int32(boundary)); err != nil {
+		t.Fatalf("Failed to write boundary to page: %v", err)
+	}
+	first := file.NewBlockId("logfile-emptytail", 0)
+	if err := fm.Write(first, page.Contents()); err != nil {
+		t.Fatalf("Failed to write block: %v", err)
+	}
+
+	iter, err := NewForwardLogIterator(fm, first)
+	if err != nil {
+		t.Fatalf("Failed to create ForwardLogIterator: %v", err)
+	}
+	if !iter.HasNext() {
+		t.Fatalf("Expected the record in block 0")
+	}
+	rec, err := iter.Next()
+	if err != nil || string(rec) != "record" {
+		t.Fatalf("Expected record %q, got %q (err %v)", "record", rec, err)
+	}
+	if iter.HasNext() {
+		_, err := iter.Next()
+		t.Fatalf("Expected no more records in the empty tail block, Next returned %v", err)
+	}
+
+	// An iterator that starts at the empty tail block has nothing to read.
+	iter, err = NewForwardLogIterator(fm, file.NewBlockId("logfile-emptytail", 1))
+	if err != nil {
+		t.Fatalf("Failed to create ForwardLogIterator: %v", err)
+	}
+	if iter.HasNext() {
+		t.Fatalf("Expected no records from the empty tail block")
+	}
+}
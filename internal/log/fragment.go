@@ -0,0 +1,147 @@
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"database_design_and_implementation/internal/file"
+)
+
+// Every fragment is framed by its length and a CRC32C of the length and the
+// data, so that a record torn by a crash is detected instead of read:
+//
+//	[len int32][crc uint32][data]
+//
+// A record that does not fit in a log block is split into fragments stored in
+// consecutive blocks. The top two bits of the length in front of every
+// fragment say which part of a record it holds:
+//
+//	fragFull    a whole record
+//	fragFirst   the start of a record, the newest fragment in its block
+//	fragMiddle  a part that fills a block on its own
+//	fragLast    the end of a record, the oldest fragment in its block
+//
+// The LSN of a split record is the LSN of its last fragment, so a record is
+// durable once the block holding its end has been flushed.
+const (
+	fragFull   uint32 = 0
+	fragFirst  uint32 = 1 << 30
+	fragMiddle uint32 = 2 << 30
+	fragLast   uint32 = 3 << 30
+	fragMask   uint32 = 3 << 30
+)
+
+// MaxRecordSize is the size of the largest log record.
+const MaxRecordSize = 1<<30 - 1
+
+// fragHeaderSize is the size of the length and CRC in front of a fragment.
+const fragHeaderSize = 2 * file.IntSize
+
+// ErrCorruptRecord is returned when a log record fails its CRC check.
+var ErrCorruptRecord = errors.New("corrupt log record")
+
+// castagnoli is the CRC32C table used for log records.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// fragmentName returns a readable name for a fragment kind.
+func fragmentName(kind uint32) string {
+	switch kind {
+	case fragFull:
+		return "whole record"
+	case fragFirst:
+		return "first fragment"
+	case fragMiddle:
+		return "middle fragment"
+	}
+	return "last fragment"
+}
+
+// readFragment returns the kind and the data of the fragment stored at pos in
+// a log page, checking its CRC. The data shares memory with the page.
+func readFragment(p *file.Page, pos int, blk file.BlockId) (uint32, []byte, error) {
+	b := p.Contents()
+	if pos < 0 || pos+fragHeaderSize > len(b) {
+		return 0, nil, fmt.Errorf("record offset %d is out of range in log block %s", pos, blk)
+	}
+	hdr := binary.BigEndian.Uint32(b[pos:])
+	kind, n := hdr&fragMask, int(hdr&^fragMask)
+	if pos+fragHeaderSize+n > len(b) {
+		return 0, nil, fmt.Errorf("%w: invalid length %d at offset %d in log block %s", ErrCorruptRecord, n, pos, blk)
+	}
+	data := b[pos+fragHeaderSize : pos+fragHeaderSize+n]
+	if binary.BigEndian.Uint32(b[pos+file.IntSize:]) != fragmentCRC(hdr, data) {
+		return 0, nil, fmt.Errorf("%w: CRC mismatch at offset %d in log block %s", ErrCorruptRecord, pos, blk)
+	}
+	return kind, data, nil
+}
+
+// writeFragment stores a fragment at pos in a log page.
+func writeFragment(p *file.Page, pos int, kind uint32, data []byte) error {
+	b := p.Contents()
+	if pos < 0 || pos+fragHeaderSize+len(data) > len(b) {
+		return fmt.Errorf("log record of %d bytes does not fit at offset %d", len(data), pos)
+	}
+	hdr := kind | uint32(len(data))
+	binary.BigEndian.PutUint32(b[pos:], hdr)
+	binary.BigEndian.PutUint32(b[pos+file.IntSize:], fragmentCRC(hdr, data))
+	copy(b[pos+fragHeaderSize:], data)
+	return nil
+}
+
+// fragmentCRC returns the CRC32C of a fragment header and its data.
+func fragmentCRC(hdr uint32, data []byte) uint32 {
+	var h [file.IntSize]byte
+	binary.BigEndian.PutUint32(h[:], hdr)
+	return crc32.Update(crc32.Checksum(h[:], castagnoli), castagnoli, data)
+}
+
+// Fragment describes a fragment stored in a log block. It is meant for tools
+// that inspect the log; iterators reassemble fragments into records.
+type Fragment struct {
+	Offset int
+	Kind   string
+	Size   int
+}
+
+// Fragments returns the boundary of a log block read into p and the
+// fragments stored between the boundary and the end of the block, newest
+// first. If a fragment fails its CRC check, the fragments before it are
+// returned with the error.
+func Fragments(p *file.Page, blk file.BlockId) (int, []Fragment, error) {
+	boundary, err := blockBoundary(p, blk)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var frags []Fragment
+	for pos := boundary; pos < len(p.Contents()); {
+		kind, data, err := readFragment(p, pos, blk)
+		if err != nil {
+			return boundary, frags, err
+		}
+		frags = append(frags, Fragment{Offset: pos, Kind: fragmentName(kind), Size: len(data)})
+		pos += fragHeaderSize + len(data)
+	}
+	return boundary, frags, nil
+}
+
+// blockBoundary returns the boundary of a log block read into p, the offset
+// of the most recently appended fragment in the block.
+func blockBoundary(p *file.Page, blk file.BlockId) (int, error) {
+	val, err := p.GetInt(0)
+	if err != nil {
+		return 0, fmt.Errorf("read boundary of log block %s: %w", blk, err)
+	}
+	boundary := int(val)
+
+	// A zeroed block was appended but never written, so it holds no records.
+	if boundary == 0 {
+		boundary = len(p.Contents())
+	}
+	if boundary < file.IntSize || boundary > len(p.Contents()) {
+		return 0, fmt.Errorf("invalid boundary %d in log block %s", boundary, blk)
+	}
+	return boundary, nil
+}
@@ -0,0 +1,251 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"database_design_and_implementation/internal/file"
+)
+
+// spanningRecord returns a record of n bytes that is easy to tell apart from others.
+func spanningRecord(i, n int) []byte {
+	rec := bytes.Repeat([]byte{byte('a' + i%26)}, n)
+	copy(rec, fmt.Sprintf("%02d", i))
+	return rec
+}
+
+// TestLogMgrSpanningRecords tests that records larger than a block are split
+// across blocks and read back whole in both directions.
+func TestLogMgrSpanningRecords(t *testing.T) {
+	blockSize := 64
+	st := file.NewMemStorage()
+	fm := newTestFileMgr(t, st, blockSize)
+	logMgr := newTestLogMgr(t, fm, "logfile-spanning")
+
+	// Records that fit exactly, one byte too many for an empty block, and
+	// several blocks long, mixed with small ones.
+	sizes := []int{8, 300, 10, blockSize - file.IntSize - fragHeaderSize, blockSize - file.IntSize - fragHeaderSize + 1, 5, 1000, 0, 120}
+	recs := make([][]byte, len(sizes))
+	lsns := make([]int, len(sizes))
+	for i, n := range sizes {
+		recs[i] = spanningRecord(i, n)
+		lsn, err := logMgr.Append(recs[i])
+		if err != nil {
+			t.Fatalf("Failed to append record %d of %d bytes: %v", i, n, err)
+		}
+		if i > 0 && lsn <= lsns[i-1] {
+			t.Fatalf("Expected increasing LSNs, got %d after %d", lsn, lsns[i-1])
+		}
+		lsns[i] = lsn
+	}
+
+	t.Run("Reverse", func(t *testing.T) {
+		iter, err := logMgr.Iterator()
+		if err != nil {
+			t.Fatalf("Failed to create LogIterator: %v", err)
+		}
+		for i := len(recs) - 1; i >= 0; i-- {
+			rec, err := iter.Next()
+			if err != nil {
+				t.Fatalf("Failed to read record %d: %v", i, err)
+			}
+			if !bytes.Equal(rec, recs[i]) {
+				t.Fatalf("Mismatch for record %d: expected %d bytes, got %d", i, len(recs[i]), len(rec))
+			}
+			if iter.LSN() != lsns[i] {
+				t.Fatalf("Expected LSN %d for record %d, got %d", lsns[i], i, iter.LSN())
+			}
+		}
+		if iter.HasNext() {
+			t.Fatalf("Expected no more records, but iterator has next element")
+		}
+	})
+
+	t.Run("Forward", func(t *testing.T) {
+		iter, err := logMgr.ForwardIterator(0)
+		if err != nil {
+			t.Fatalf("Failed to create ForwardLogIterator: %v", err)
+		}
+		for i := range recs {
+			rec, err := iter.Next()
+			if err != nil {
+				t.Fatalf("Failed to read record %d: %v", i, err)
+			}
+			if !bytes.Equal(rec, recs[i]) || iter.LSN() != lsns[i] {
+				t.Fatalf("Mismatch for record %d: got %d bytes at LSN %d, expected %d bytes at LSN %d",
+					i, len(rec), iter.LSN(), len(recs[i]), lsns[i])
+			}
+		}
+		if iter.HasNext() {
+			t.Fatalf("Expected no more records, but iterator has next element")
+		}
+	})
+
+	t.Run("Forward from the middle of a record", func(t *testing.T) {
+		// The 1000-byte record ends in the block of its LSN and starts earlier.
+		iter, err := logMgr.ForwardIterator(lsns[6]/blockSize - 1)
+		if err != nil {
+			t.Fatalf("Failed to create ForwardLogIterator: %v", err)
+		}
+		rec, err := iter.Next()
+		if err != nil || !bytes.Equal(rec, recs[6]) {
+			t.Fatalf("Expected the iterator to back up to the start of record 6, got %d bytes (err %v)", len(rec), err)
+		}
+	})
+
+	t.Run("SeekLSN", func(t *testing.T) {
+		for i, lsn := range lsns {
+			iter, err := logMgr.SeekLSN(lsn)
+			if err != nil {
+				t.Fatalf("SeekLSN(%d) failed: %v", lsn, err)
+			}
+			rec, err := iter.Next()
+			if err != nil || !bytes.Equal(rec, recs[i]) {
+				t.Fatalf("SeekLSN(%d) did not return record %d (err %v)", lsn, i, err)
+			}
+		}
+	})
+
+	t.Run("Reopen", func(t *testing.T) {
+		if err := logMgr.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		logMgr := newTestLogMgr(t, newTestFileMgr(t, st, blockSize), "logfile-spanning")
+		if logMgr.LatestLSN() != lsns[len(lsns)-1] {
+			t.Fatalf("Expected latest LSN %d after reopen, got %d", lsns[len(lsns)-1], logMgr.LatestLSN())
+		}
+		big := spanningRecord(99, 200)
+		if _, err := logMgr.Append(big); err != nil {
+			t.Fatalf("Failed to append after reopen: %v", err)
+		}
+		iter, err := logMgr.Iterator()
+		if err != nil {
+			t.Fatalf("Failed to create LogIterator: %v", err)
+		}
+		for _, want := range [][]byte{big, recs[len(recs)-1]} {
+			rec, err := iter.Next()
+			if err != nil || !bytes.Equal(rec, want) {
+				t.Fatalf("Expected a record of %d bytes after reopen, got %d (err %v)", len(want), len(rec), err)
+			}
+		}
+	})
+}
+
+// TestLogMgrKeepsBoundary tests that a record never overwrites the boundary
+// at the start of its block.
+func TestLogMgrKeepsBoundary(t *testing.T) {
+	blockSize := 64
+	fm := newTestFileMgr(t, file.NewMemStorage(), blockSize)
+	logMgr := newTestLogMgr(t, fm, "logfile-boundary")
+
+	// Without the boundary check, a record of this size would start at
+	// offset 2 of a fresh block.
+	rec := spanningRecord(0, blockSize-fragHeaderSize-2)
+	lsn, err := logMgr.Append(rec)
+	if err != nil {
+		t.Fatalf("Failed to append log record: %v", err)
+	}
+	if err := logMgr.Flush(lsn); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	page := file.NewPage(blockSize)
+	if _, err := readLogBlock(fm, file.NewBlockId(SegmentName("logfile-boundary", 0), 0), page); err != nil {
+		t.Fatalf("The first log block is unreadable: %v", err)
+	}
+	iter, err := logMgr.Iterator()
+	if err != nil {
+		t.Fatalf("Failed to create LogIterator: %v", err)
+	}
+	got, err := iter.Next()
+	if err != nil || !bytes.Equal(got, rec) {
+		t.Fatalf("Expected the record back, got %d bytes (err %v)", len(got), err)
+	}
+}
+
+// TestFragments tests that the fragments of a log block are listed newest
+// first, up to the first one that fails its CRC check.
+func TestFragments(t *testing.T) {
+	blockSize := 64
+	fm := newTestFileMgr(t, file.NewMemStorage(), blockSize)
+	logMgr := newTestLogMgr(t, fm, "logfile-fragments")
+
+	// Two whole records, then the first fragment of a record that spans blocks.
+	for _, rec := range [][]byte{[]byte("one"), []byte("two"), spanningRecord(0, blockSize)} {
+		if _, err := logMgr.Append(rec); err != nil {
+			t.Fatalf("Failed to append log record: %v", err)
+		}
+	}
+	if err := logMgr.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	blk := file.NewBlockId(SegmentName("logfile-fragments", 0), 0)
+	page := file.NewPage(blockSize)
+	if err := fm.Read(blk, page.Contents()); err != nil {
+		t.Fatalf("Failed to read log block: %v", err)
+	}
+	boundary, frags, err := Fragments(page, blk)
+	if err != nil {
+		t.Fatalf("Fragments failed: %v", err)
+	}
+	if boundary != file.IntSize || len(frags) != 3 {
+		t.Fatalf("Expected 3 fragments from offset %d, got %+v from %d", file.IntSize, frags, boundary)
+	}
+	want := []Fragment{
+		{Offset: file.IntSize, Kind: "first fragment", Size: blockSize - 2*(fragHeaderSize+3) - file.IntSize - fragHeaderSize},
+		{Offset: blockSize - 2*(fragHeaderSize+3), Kind: "whole record", Size: 3},
+		{Offset: blockSize - fragHeaderSize - 3, Kind: "whole record", Size: 3},
+	}
+	for i := range want {
+		if frags[i] != want[i] {
+			t.Fatalf("Expected fragment %+v, got %+v", want[i], frags[i])
+		}
+	}
+
+	page.Contents()[want[1].Offset+fragHeaderSize] ^= 0xff
+	_, frags, err = Fragments(page, blk)
+	if !errors.Is(err, ErrCorruptRecord) || len(frags) != 1 {
+		t.Fatalf("Expected ErrCorruptRecord after 1 fragment, got %d fragments (err %v)", len(frags), err)
+	}
+}
+
+// TestBlockBoundary tests that a zeroed block reads as empty and that a
+// boundary outside the block is refused.
+func TestBlockBoundary(t *testing.T) {
+	blockSize := 64
+	blk := file.NewBlockId("logfile-boundaries", 0)
+	for _, tc := range []struct {
+		stored int32
+		want   int
+	}{
+		{0, blockSize},
+		{file.IntSize, file.IntSize},
+		{int32(blockSize), blockSize},
+		{2, -1},
+		{int32(blockSize) + 1, -1},
+	} {
+		page := file.NewPage(blockSize)
+		if err := page.SetInt(0, tc.stored); err != nil {
+			t.Fatalf("Failed to set boundary: %v", err)
+		}
+		got, err := blockBoundary(page, blk)
+		if tc.want < 0 {
+			if err == nil {
+				t.Fatalf("Expected an error for boundary %d, got %d", tc.stored, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Fatalf("Expected boundary %d for stored %d, got %d (err %v)", tc.want, tc.stored, got, err)
+		}
+		if tc.want != blockSize {
+			continue
+		}
+		if boundary, frags, err := Fragments(page, blk); err != nil || boundary != blockSize || len(frags) != 0 {
+			t.Fatalf("Expected an empty block for stored %d, got %+v from %d (err %v)", tc.stored, frags, boundary, err)
+		}
+	}
+}
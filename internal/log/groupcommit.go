@@ -0,0 +1,103 @@
+package log
+
+import "time"
+
+// GroupCommitConfig configures group commit in LogMgr. Concurrent Flush
+// callers are batched behind a leader, which waits for more callers to join
+// and then writes the log page once on behalf of the whole batch.
+type GroupCommitConfig struct {
+	// MaxDelay is how long a leader waits for more callers before writing.
+	MaxDelay time.Duration
+	// MaxBatch is the batch size at which the leader writes without waiting
+	// for MaxDelay to pass. A value of zero or less means no limit.
+	MaxBatch int
+}
+
+// GroupCommitStats counts the log writes made by group commit leaders.
+type GroupCommitStats struct {
+	// Batches is the number of batches written.
+	Batches int64
+	// Requests is the number of Flush calls served by those batches.
+	Requests int64
+}
+
+// AvgBatchSize returns the average number of Flush calls served by one write.
+func (s GroupCommitStats) AvgBatchSize() float64 {
+	if s.Batches == 0 {
+		return 0
+	}
+	return float64(s.Requests) / float64(s.Batches)
+}
+
+// commitBatch is a group of Flush callers waiting for the same write.
+type commitBatch struct {
+	size   int
+	maxLSN int
+	full   chan struct{}
+	done   chan struct{}
+	err    error
+}
+
+// EnableGroupCommit turns on group commit with the given configuration.
+func (lm *LogMgr) EnableGroupCommit(cfg GroupCommitConfig) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.groupCommit = &cfg
+}
+
+// GroupCommitStats returns the group commit counters.
+func (lm *LogMgr) GroupCommitStats() GroupCommitStats {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.gcStats
+}
+
+// groupFlush joins the pending batch, or starts one and leads it. It is called
+// with lm.mu held and returns with it released.
+func (lm *LogMgr) groupFlush(lsn int) error {
+	b := lm.batch
+	leader := b == nil
+	if leader {
+		b = &commitBatch{full: make(chan struct{}), done: make(chan struct{})}
+		lm.batch = b
+	}
+	b.size++
+	if lsn > b.maxLSN {
+		b.maxLSN = lsn
+	}
+	if b.size == lm.groupCommit.MaxBatch {
+		close(b.full)
+	}
+	delay := lm.groupCommit.MaxDelay
+	lm.mu.Unlock()
+
+	if !leader {
+		<-b.done
+		return b.err
+	}
+
+	timer := time.NewTimer(delay)
+	select {
+	case <-timer.C:
+	case <-b.full:
+		timer.Stop()
+	}
+
+	lm.mu.Lock()
+	// Callers arriving from now on start the next batch.
+	lm.batch = nil
+	switch {
+	case lm.closed:
+		// The log was closed while the leader waited, and must not be
+		// written again.
+		b.err = ErrClosed
+	case b.maxLSN > lm.lastSavedLSN:
+		b.err = lm.flush()
+	}
+	lm.gcStats.Batches++
+	lm.gcStats.Requests += int64(b.size)
+	lm.mu.Unlock()
+
+	close(b.done)
+	return b.err
+}
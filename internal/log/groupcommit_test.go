@@ -0,0 +1,146 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"database_design_and_implementation/internal/file"
+)
+
+// TestGroupCommitBatchesFlushes tests that concurrent flushes share one write.
+func TestGroupCommitBatchesFlushes(t *testing.T) {
+	fm := newTestFileMgr(t, file.NewMemStorage(), 1024)
+
+	logMgr := newTestLogMgr(t, fm, "logfile-groupcommit")
+	numCallers := 8
+	logMgr.EnableGroupCommit(GroupCommitConfig{MaxDelay: 5 * time.Second, MaxBatch: numCallers})
+
+	lsns := make([]int, numCallers)
+	for i := range lsns {
+		lsn, err := logMgr.Append([]byte(fmt.Sprintf("commit%d", i)))
+		if err != nil {
+			t.Fatalf("Failed to append log record: %v", err)
+		}
+		lsns[i] = lsn
+	}
+
+	writesBefore := fm.GetWriteCount()
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, numCallers)
+	for _, lsn := range lsns {
+		wg.Add(1)
+		go func(lsn int) {
+			defer wg.Done()
+			errCh <- logMgr.Flush(lsn)
+		}(lsn)
+	}
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		if err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed >= 5*time.Second {
+		t.Fatalf("Expected a full batch to be written before MaxDelay, took %v", elapsed)
+	}
+	if writes := fm.GetWriteCount() - writesBefore; writes != 1 {
+		t.Fatalf("Expected 1 log write for the batch, got %d", writes)
+	}
+
+	stats := logMgr.GroupCommitStats()
+	if stats.Batches != 1 || stats.Requests != int64(numCallers) {
+		t.Fatalf("Expected 1 batch of %d requests, got %+v", numCallers, stats)
+	}
+	if avg := stats.AvgBatchSize(); avg != float64(numCallers) {
+		t.Fatalf("Expected average batch size %d, got %v", numCallers, avg)
+	}
+
+	// Already durable LSNs do not start a new batch.
+	if err := logMgr.Flush(lsns[0]); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if stats := logMgr.GroupCommitStats(); stats.Batches != 1 {
+		t.Fatalf("Expected no new batch for a durable LSN, got %+v", stats)
+	}
+}
+
+// TestGroupCommitMaxDelay tests that a lone caller is written after MaxDelay.
+func TestGroupCommitMaxDelay(t *testing.T) {
+	fm := newTestFileMgr(t, file.NewMemStorage(), 1024)
+
+	logMgr := newTestLogMgr(t, fm, "logfile-groupcommit-delay")
+	maxDelay := 20 * time.Millisecond
+	logMgr.EnableGroupCommit(GroupCommitConfig{MaxDelay: maxDelay, MaxBatch: 100})
+
+	lsn, err := logMgr.Append([]byte("commit"))
+	if err != nil {
+		t.Fatalf("Failed to append log record: %v", err)
+	}
+	start := time.Now()
+	if err := logMgr.Flush(lsn); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < maxDelay {
+		t.Fatalf("Expected the leader to wait around %v, but it returned in %v", maxDelay, elapsed)
+	}
+
+	iter, err := logMgr.Iterator()
+	if err != nil {
+		t.Fatalf("Failed to create LogIterator: %v", err)
+	}
+	rec, err := iter.Next()
+	if err != nil || string(rec) != "commit" {
+		t.Fatalf("Expected flushed record %q, got %q (err %v)", "commit", rec, err)
+	}
+
+	stats := logMgr.GroupCommitStats()
+	if stats.Batches != 1 || stats.AvgBatchSize() != 1 {
+		t.Fatalf("Expected a single batch of one request, got %+v", stats)
+	}
+}
+
+// TestGroupCommitClosedWhileWaiting tests that a leader whose log is closed
+// while it waits reports ErrClosed and does not write the log.
+func TestGroupCommitClosedWhileWaiting(t *testing.T) {
+	fm := newTestFileMgr(t, file.NewMemStorage(), 1024)
+
+	logMgr := newTestLogMgr(t, fm, "logfile-groupcommit-closed")
+	logMgr.EnableGroupCommit(GroupCommitConfig{MaxDelay: 200 * time.Millisecond, MaxBatch: 100})
+
+	lsn, err := logMgr.Append([]byte("commit"))
+	if err != nil {
+		t.Fatalf("Failed to append log record: %v", err)
+	}
+	errCh := make(chan error, 1)
+	go func() { errCh <- logMgr.Flush(lsn) }()
+
+	// Wait for the leader to start its batch.
+	for {
+		logMgr.mu.Lock()
+		waiting := logMgr.batch != nil
+		logMgr.mu.Unlock()
+		if waiting {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := logMgr.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	writes := fm.GetWriteCount()
+
+	if err := <-errCh; !errors.Is(err, ErrClosed) {
+		t.Fatalf("Expected ErrClosed from a leader whose log was closed, got %v", err)
+	}
+	if got := fm.GetWriteCount(); got != writes {
+		t.Fatalf("Expected no log write after Close, got %d", got-writes)
+	}
+}
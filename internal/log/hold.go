@@ -0,0 +1,50 @@
+package log
+
+// Hold keeps Truncate from removing the records of a log from an LSN on, for
+// a reader such as a change data capture consumer that has yet to read them.
+// A Hold lasts until it is released.
+type Hold struct {
+	lm  *LogMgr
+	lsn int
+}
+
+// Hold returns a hold on the records with an LSN of lsn or more. It waits for
+// a Truncate that is running to finish.
+func (lm *LogMgr) Hold(lsn int) *Hold {
+	lm.truncMu.Lock()
+	defer lm.truncMu.Unlock()
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	h := &Hold{lm: lm, lsn: lsn}
+	if lm.holds == nil {
+		lm.holds = make(map[*Hold]struct{})
+	}
+	lm.holds[h] = struct{}{}
+	return h
+}
+
+// Advance releases the records below lsn. A hold never moves back.
+func (h *Hold) Advance(lsn int) {
+	h.lm.mu.Lock()
+	defer h.lm.mu.Unlock()
+	h.lsn = max(h.lsn, lsn)
+}
+
+// Release releases the hold. Releasing it again has no effect.
+func (h *Hold) Release() {
+	h.lm.mu.Lock()
+	defer h.lm.mu.Unlock()
+	delete(h.lm.holds, h)
+}
+
+// heldBefore returns lsn, or the lowest LSN held if that is lower.
+func (lm *LogMgr) heldBefore(lsn int) int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	for h := range lm.holds {
+		lsn = min(lsn, h.lsn)
+	}
+	return lsn
+}
@@ -1,78 +1,181 @@
 package log
 
 import (
-	"errors"
 	"fmt"
 
 	"database_design_and_implementation/internal/file"
 )
 
 // LogIterator provides a way to iterate over log records in reverse order.
+// It starts at the given block and walks backwards through every earlier
+// block of the log down to the first one.
 type LogIterator struct {
-	fm         *file.FileMgr
-	blk        *file.BlockId
+	lf         *logFile
+	blknum     int
+	first      int
 	p          *file.Page
 	currentPos int
 	boundary   int
+	lsn        int
+	tail       *logTail
+	// err is a failure to read an earlier block while looking for records,
+	// returned by the next call to Next.
+	err error
 }
 
-// NewLogIterator creates a new LogIterator for the given file manager and block ID.
-func NewLogIterator(fm *file.FileMgr, blk *file.BlockId) *LogIterator {
-	blockSize := fm.BlockSize()
-	p := file.NewPage(blockSize)
+// logTail is a copy of the tail block of a log, taken under the LogMgr's lock
+// when an iterator is created. Iterators read the tail from it rather than
+// from disk, where appends may be rewriting the block as it is read.
+type logTail struct {
+	blknum   int
+	contents []byte
+}
+
+// NewLogIterator creates a new LogIterator for a log kept in the single file
+// of the given block, starting at that block.
+func NewLogIterator(fm *file.FileMgr, blk *file.BlockId) (*LogIterator, error) {
+	return newLogIterator(singleLogFile(fm, blk.Filename), blk.Blknum, 0, nil)
+}
 
+// newLogIterator creates a new LogIterator that starts at block blknum of a
+// log and stops after block first. If tail is not nil, the tail block is read
+// from it.
+func newLogIterator(lf *logFile, blknum, first int, tail *logTail) (*LogIterator, error) {
 	iterator := &LogIterator{
-		fm:  fm,
-		blk: blk,
-		p:   p,
+		lf:    lf,
+		first: first,
+		p:     file.NewPage(lf.fm.BlockSize()),
+		tail:  tail,
 	}
 
-	iterator.moveToBlock(blk)
-	return iterator
+	if err := iterator.moveToBlock(blknum); err != nil {
+		return nil, err
+	}
+	return iterator, nil
 }
 
-// HasNext returns true if there are more log records to read.
+// HasNext returns true if there are more log records to read, either in the
+// current block or in an earlier one. Blocks that hold no records are skipped,
+// so HasNext only returns true if Next has a record or an error to return.
 func (it *LogIterator) HasNext() bool {
-	return it.currentPos >= 0 && it.currentPos < it.fm.BlockSize()
+	if it.err == nil {
+		it.err = it.skipEmptyBlocks()
+	}
+	return it.err != nil || it.currentPos < it.lf.fm.BlockSize()
 }
 
-// Next reads the next log record from the log file.
-func (it *LogIterator) Next() ([]byte, error) {
-	if !it.HasNext() {
-		return nil, errors.New("no more records")
+// skipEmptyBlocks moves back from a block whose records have all been read to
+// the nearest earlier block that holds records, stopping at the first block.
+func (it *LogIterator) skipEmptyBlocks() error {
+	for it.currentPos >= it.lf.fm.BlockSize() && it.blknum > it.first {
+		if err := it.moveToBlock(it.blknum - 1); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	rec, err := it.p.GetBytes(it.currentPos)
+// Next reads the next log record from the log file, moving to the previous
+// block once the current one is exhausted. A record split across blocks is
+// read from its last fragment back to its first and returned whole.
+func (it *LogIterator) Next() ([]byte, error) {
+	kind, data, err := it.nextFragment()
 	if err != nil {
 		return nil, err
 	}
+	switch kind {
+	case fragFull:
+		return data, nil
+	case fragLast:
+	default:
+		return nil, fmt.Errorf("%s at LSN %d is not followed by the end of its record", fragmentName(kind), it.lsn)
+	}
 
-	nextPos := it.currentPos + file.IntSize + len(rec)
-
-	if nextPos >= it.fm.BlockSize() {
-		it.currentPos = -1
-	} else {
-		it.currentPos = nextPos
+	lsn := it.lsn
+	parts := [][]byte{append([]byte(nil), data...)}
+	size := len(data)
+	for kind != fragFirst {
+		if !it.HasNext() {
+			return nil, fmt.Errorf("log record at LSN %d has no first fragment", lsn)
+		}
+		if kind, data, err = it.nextFragment(); err != nil {
+			return nil, err
+		}
+		if kind != fragMiddle && kind != fragFirst {
+			return nil, fmt.Errorf("log record at LSN %d is interrupted by a %s", lsn, fragmentName(kind))
+		}
+		parts = append(parts, append([]byte(nil), data...))
+		size += len(data)
 	}
 
+	rec := make([]byte, 0, size)
+	for i := len(parts) - 1; i >= 0; i-- {
+		rec = append(rec, parts[i]...)
+	}
+	it.lsn = lsn
 	return rec, nil
 }
 
-// moveToBlock reads the specified block and sets the iterator's boundary and current position.
-func (it *LogIterator) moveToBlock(blk *file.BlockId) {
-	it.fm.Read(*blk, it.p.Contents())
+// nextFragment reads the next fragment in reverse order and sets the LSN to
+// its position.
+func (it *LogIterator) nextFragment() (uint32, []byte, error) {
+	if !it.HasNext() {
+		return 0, nil, ErrNoMoreRecords
+	}
+	if it.err != nil {
+		return 0, nil, it.err
+	}
 
-	val, err := it.p.GetInt(0)
+	kind, data, err := readFragment(it.p, it.currentPos, it.lf.block(it.blknum))
 	if err != nil {
-		panic(err)
+		return 0, nil, err
 	}
-	it.boundary = int(val)
 
-	fmt.Printf("moveToBlock: boundary = %d, block = %s\n", it.boundary, blk.String())
+	it.lsn = lsnAt(it.lf.fm.BlockSize(), it.blknum, it.currentPos)
+	it.currentPos += fragHeaderSize + len(data)
+	return kind, data, nil
+}
+
+// LSN returns the LSN of the record most recently returned by Next.
+func (it *LogIterator) LSN() int {
+	return it.lsn
+}
+
+// moveToBlock reads the specified block and sets the iterator's boundary and current position.
+func (it *LogIterator) moveToBlock(blknum int) error {
+	boundary, err := it.lf.read(blknum, it.p, it.tail)
+	if err != nil {
+		return err
+	}
+
+	it.blknum = blknum
+	it.boundary = boundary
+	it.currentPos = boundary
+	return nil
+}
+
+// read reads a block of the log into p and returns its boundary, taking the
+// tail block from its copy if there is one. It fails with ErrLSNTruncated if
+// the block has been removed by Truncate since the iterator was created.
+func (lf *logFile) read(blknum int, p *file.Page, tail *logTail) (int, error) {
+	lf.mu.RLock()
+	defer lf.mu.RUnlock()
+
+	if blknum < lf.removed {
+		return 0, fmt.Errorf("%w: log block %d was removed while it was being read", ErrLSNTruncated, blknum)
+	}
+	if tail != nil && blknum == tail.blknum {
+		copy(p.Contents(), tail.contents)
+		return blockBoundary(p, lf.block(blknum))
+	}
+	return readLogBlock(lf.fm, lf.block(blknum), p)
+}
 
-	if it.boundary == 0 {
-		it.currentPos = 0
-	} else {
-		it.currentPos = it.boundary
+// readLogBlock reads a log block into p and returns its boundary, the offset
+// of the most recently appended record in the block.
+func readLogBlock(fm *file.FileMgr, blk file.BlockId, p *file.Page) (int, error) {
+	if err := fm.Read(blk, p.Contents()); err != nil {
+		return 0, fmt.Errorf("%w: read log block %s: %w", ErrReadFailed, blk, err)
 	}
+	return blockBoundary(p, blk)
 }
@@ -10,12 +10,9 @@ import (
 // TestLogIterator tests the log iterator functionality.
 func TestLogIterator(t *testing.T) {
 	blockSize := 1024
-	fm, err := file.NewFileMgr("../../temp", blockSize)
-	if err != nil {
-		t.Fatalf("Failed to create FileMgr: %v", err)
-	}
+	fm := newTestFileMgr(t, file.NewMemStorage(), blockSize)
 
-	blk := file.NewBlockId("logfile", 1)
+	blk := file.NewBlockId("logfile", 0)
 	page := file.NewPage(blockSize)
 
 	logData := [][]byte{
@@ -26,11 +23,11 @@ func TestLogIterator(t *testing.T) {
 
 	boundary := blockSize
 	for i := len(logData) - 1; i >= 0; i-- {
-		boundary -= file.IntSize + len(logData[i])
+		boundary -= fragHeaderSize + len(logData[i])
 		writeLogRecord(page, boundary, logData[i])
 	}
 
-	err = page.SetInt(0, int32(boundary))
+	err := page.SetInt(0, int32(boundary))
 	if err != nil {
 		t.Fatalf("Failed to write boundary to page: %v", err)
 	}
@@ -43,7 +40,7 @@ func TestLogIterator(t *testing.T) {
 	t.Logf("Final boundary position: %d", boundary)
 	t.Logf("Page Contents: %v", page.Contents())
 
-	bytesData, err := page.GetBytes(boundary)
+	_, bytesData, err := readFragment(page, boundary, blk)
 	if err != nil {
 		t.Fatalf("Failed to retrieve written bytes: %v", err)
 	}
@@ -51,7 +48,10 @@ func TestLogIterator(t *testing.T) {
 
 	fm.Write(blk, page.Contents())
 
-	iter := NewLogIterator(fm, &blk)
+	iter, err := NewLogIterator(fm, &blk)
+	if err != nil {
+		t.Fatalf("Failed to create LogIterator: %v", err)
+	}
 	t.Log("Created LogIterator.")
 
 	for i := 0; i < len(logData); i++ {
@@ -83,10 +83,53 @@ func TestLogIterator(t *testing.T) {
 	t.Log("TestLogIterator completed successfully.")
 }
 
-// writeLogRecord writes the given data to the specified position in the page.
+// writeLogRecord writes the given data as a whole record to the specified position in the page.
 func writeLogRecord(p *file.Page, pos int, data []byte) {
-	err := p.SetBytes(pos, data)
+	err := writeFragment(p, pos, fragFull, data)
 	if err != nil {
 		panic("Failed to write bytes to page")
 	}
 }
+
+// TestLogIteratorSkipsEmptyBlocks tests that HasNext does not report records
+// in blocks that were appended but never written, so that it agrees with Next.
+func TestLogIteratorSkipsEmptyBlocks(t *testing.T) {
+	blockSize := 64
+	fm := newTestFileMgr(t, file.NewMemStorage(), blockSize)
+
+	// Block 0 and the tail block 2 are empty; only block 1 holds a record.
+	for i := 0; i < 3; i++ {
+		if _, err := fm.Append("logfile-empty"); err != nil {
+			t.Fatalf("Failed to append block: %v", err)
+		}
+	}
+	page := file.NewPage(blockSize)
+	boundary := blockSize - fragHeaderSize - len("record")
+	writeLogRecord(page, boundary, []byte("record"))
+	if err := page.SetInt(0, int32(boundary)); err != nil {
+		t.Fatalf("Failed to write boundary to page: %v", err)
+	}
+	if err := fm.Write(file.NewBlockId("logfile-empty", 1), page.Contents()); err != nil {
+		t.Fatalf("Failed to write block: %v", err)
+	}
+
+	tail := file.NewBlockId("logfile-empty", 2)
+	iter, err := NewLogIterator(fm, &tail)
+	if err != nil {
+		t.Fatalf("Failed to create LogIterator: %v", err)
+	}
+	if !iter.HasNext() {
+		t.Fatalf("Expected the record in block 1 past the empty tail block")
+	}
+	rec, err := iter.Next()
+	if err != nil || string(rec) != "record" {
+		t.Fatalf("Expected record %q, got %q (err %v)", "record", rec, err)
+	}
+	if iter.HasNext() {
+		_, err := iter.Next()
+		t.Fatalf("Expected no more records before the empty first block, Next returned %v", err)
+	}
+	if _, err := iter.Next(); err != ErrNoMoreRecords {
+		t.Fatalf("Expected ErrNoMoreRecords, got %v", err)
+	}
+}
@@ -1,94 +1,503 @@
 package log
 
 import (
+	"errors"
+	"fmt"
+	"sync"
+
 	"database_design_and_implementation/internal/file"
 )
 
-// LogMgr manages the writing and retrieval of log records.
+var (
+	// ErrClosed is returned by operations on a LogMgr that has been closed.
+	ErrClosed = errors.New("log manager is closed")
+	// ErrRecordTooLarge is returned by Append for a record larger than MaxRecordSize.
+	ErrRecordTooLarge = errors.New("log record is too large")
+	// ErrInvalidLSN is returned for an LSN that no record can have.
+	ErrInvalidLSN = errors.New("invalid LSN")
+	// ErrNoMoreRecords is returned by an iterator that has no more records.
+	ErrNoMoreRecords = errors.New("no more log records")
+	// ErrWriteFailed wraps the error of a failed write of the log to disk.
+	ErrWriteFailed = errors.New("log write failed")
+	// ErrReadFailed wraps the error of a failed read of the log from disk.
+	ErrReadFailed = errors.New("log read failed")
+	// ErrLSNTruncated is returned for an LSN whose records have been removed
+	// by Truncate.
+	ErrLSNTruncated = errors.New("log truncated")
+	// ErrSegmentSizeMismatch is matched by the error returned when a log is
+	// opened with a segment size other than the one it was created with.
+	ErrSegmentSizeMismatch = errors.New("log segment size mismatch")
+)
+
+// framedFormatVersion is the first database format version whose log records
+// are framed with a CRC.
+const framedFormatVersion = 2
+
+// Options configures a LogMgr.
+type Options struct {
+	// SegmentBlocks is the number of blocks in each segment file of a new
+	// log. The size is recorded when the log is created; if SegmentBlocks is
+	// zero, the recorded size is used, or DefaultSegmentBlocks for a new log.
+	// Opening an existing log with a different nonzero size fails with
+	// ErrSegmentSizeMismatch.
+	SegmentBlocks int
+	// Archive is a storage to which Truncate copies segments before it
+	// removes them. If nil, segments are removed without a copy.
+	Archive file.Storage
+}
+
+// LogMgr manages the writing and retrieval of log records. The log is stored
+// in segment files named by SegmentName, so that the part of it that recovery
+// no longer needs can be removed with Truncate. A LogMgr is safe for
+// concurrent use: records are appended one at a time, and their LSNs increase
+// in the order in which Append returns them.
 type LogMgr struct {
 	fm           *file.FileMgr
-	logfile      string
+	lf           *logFile
+	archive      file.Storage
 	logpage      *file.Page
-	currentblk   *file.BlockId
+	currentblk   int
 	latestLSN    int
 	lastSavedLSN int
+	discarded    int
+
+	// mu guards the log page and LSNs against concurrent Append and Flush
+	// calls, and the state below.
+	mu          sync.Mutex
+	closed      bool
+	groupCommit *GroupCommitConfig
+	batch       *commitBatch
+	gcStats     GroupCommitStats
+	holds       map[*Hold]struct{}
+
+	// truncMu serializes Truncate calls, and new holds with them, so that
+	// a segment is archived and removed by one Truncate only.
+	truncMu sync.Mutex
+}
+
+// NewLogMgr initializes the log manager with the default options. An existing
+// log is cut back to its last complete record; see DiscardedBytes.
+func NewLogMgr(fm *file.FileMgr, logfile string) (*LogMgr, error) {
+	return NewLogMgrWithOptions(fm, logfile, Options{})
 }
 
-// NewLogMgr initializes the log manager.
-func NewLogMgr(fm *file.FileMgr, logfile string) *LogMgr {
+// NewLogMgrWithOptions initializes the log manager with the given options.
+func NewLogMgrWithOptions(fm *file.FileMgr, logfile string, opts Options) (*LogMgr, error) {
+	// Without CRCs every record of an older log would look torn, and the
+	// repair of the tail would remove them, so such a log is not touched.
+	if v := fm.Superblock().FormatVersion; v < framedFormatVersion {
+		return nil, fmt.Errorf("%w: log %s is in format version %d, whose records have no CRC, and must be converted before it is opened",
+			file.ErrIncompatibleDatabase, logfile, v)
+	}
 	blockSize := fm.BlockSize()
 	logpage := file.NewPage(blockSize)
 
-	logsize, err := fm.Length(logfile)
+	lf, err := openLogFile(fm, logfile, max(opts.SegmentBlocks, 0))
+	if err != nil {
+		return nil, err
+	}
+	first, length, err := lf.bounds()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	var currentblk *file.BlockId
-	if logsize == 0 {
-		currentblk = appendNewBlock(fm, logfile, logpage)
-	} else {
-		blk := file.NewBlockId(logfile, logsize-1)
-		currentblk = &blk
-		fm.Read(*currentblk, logpage.Contents())
+	var currentblk, latestLSN, discarded int
+	switch {
+	case length == 0 && fm.ReadOnly():
+		// A missing log reads as an empty one.
+		if err := logpage.SetInt(0, int32(blockSize)); err != nil {
+			return nil, err
+		}
+	case length == 0:
+		if err := appendNewBlock(lf, 0, logpage); err != nil {
+			return nil, err
+		}
+	default:
+		blknum, boundary, n, err := repairTail(lf, first, length, logpage)
+		if err != nil {
+			return nil, err
+		}
+		if err := logpage.SetInt(0, int32(boundary)); err != nil {
+			return nil, err
+		}
+		currentblk = blknum
+		discarded = n
+		latestLSN = lsnAt(blockSize, blknum, boundary)
 	}
 
 	return &LogMgr{
-		fm:         fm,
-		logfile:    logfile,
-		logpage:    logpage,
-		currentblk: currentblk,
-	}
+		fm:           fm,
+		lf:           lf,
+		archive:      opts.Archive,
+		logpage:      logpage,
+		currentblk:   currentblk,
+		latestLSN:    latestLSN,
+		lastSavedLSN: latestLSN,
+		discarded:    discarded,
+	}, nil
+}
+
+// DiscardedBytes returns the number of bytes of torn or unfinished records
+// that were cut from the tail of the log when it was opened.
+func (lm *LogMgr) DiscardedBytes() int {
+	return lm.discarded
 }
 
 // Flush ensures that the log record corresponding to the given LSN is written to disk.
-func (lm *LogMgr) Flush(lsn int) {
-	if lsn > lm.lastSavedLSN {
-		lm.flush()
+// With group commit enabled, concurrent callers share a single write, and a
+// batch still waiting when the LogMgr is closed fails with ErrClosed. Records
+// that were written before the LogMgr was closed are reported as flushed.
+func (lm *LogMgr) Flush(lsn int) error {
+	lm.mu.Lock()
+	if lsn <= lm.lastSavedLSN {
+		lm.mu.Unlock()
+		return nil
+	}
+	if lm.closed {
+		lm.mu.Unlock()
+		return ErrClosed
+	}
+	if lm.groupCommit != nil {
+		return lm.groupFlush(lsn)
+	}
+	defer lm.mu.Unlock()
+	return lm.flush()
+}
+
+// Iterator returns an iterator for reading the whole log in reverse order,
+// starting with the most recent record.
+func (lm *LogMgr) Iterator() (*LogIterator, error) {
+	first, tail, err := lm.flushForRead()
+	if err != nil {
+		return nil, err
+	}
+	return newLogIterator(lm.lf, tail.blknum, first, tail)
+}
+
+// ForwardIterator returns an iterator for reading the log in append order,
+// starting with the first record of the given block. Blocks are numbered
+// from the start of the log, across segments.
+func (lm *LogMgr) ForwardIterator(blknum int) (*ForwardLogIterator, error) {
+	first, tail, err := lm.flushForRead()
+	if err != nil {
+		return nil, err
 	}
+	return newForwardLogIterator(lm.lf, blknum, first, tail.blknum, tail)
 }
 
-// Iterator returns an iterator for reading the log in reverse order.
-func (lm *LogMgr) Iterator() *LogIterator {
-	lm.flush()
-	return NewLogIterator(lm.fm, lm.currentblk)
+// FirstLSN returns the LSN from which the log can be read: the records with
+// lower LSNs have been removed by Truncate.
+func (lm *LogMgr) FirstLSN() (int, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if lm.closed {
+		return 0, ErrClosed
+	}
+	first, _, err := lm.lf.bounds()
+	if err != nil {
+		return 0, err
+	}
+	return first*lm.fm.BlockSize() + 1, nil
+}
+
+// SeekLSN returns a forward iterator whose first record is the first one with
+// an LSN greater than or equal to lsn. If there is no such record, the
+// iterator is positioned at the tail of the log. If the records before lsn
+// have been removed by Truncate, so that the ones from lsn on cannot be told
+// apart from them, SeekLSN fails with ErrLSNTruncated; FirstLSN returns the
+// first LSN it accepts.
+func (lm *LogMgr) SeekLSN(lsn int) (*ForwardLogIterator, error) {
+	if lsn < 1 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidLSN, lsn)
+	}
+	first, tail, err := lm.flushForRead()
+	if err != nil {
+		return nil, err
+	}
+	return lm.seek(lsn, first, tail)
+}
+
+// SeekFlushedLSN is SeekLSN for a reader that must only see durable records,
+// such as change data capture. Rather than flush the log, which would sync it
+// on every call and defeat group commit, it reads the log as it was last
+// flushed: the iterator stops after the last record on disk.
+func (lm *LogMgr) SeekFlushedLSN(lsn int) (*ForwardLogIterator, error) {
+	if lsn < 1 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidLSN, lsn)
+	}
+	first, tail, err := lm.flushedForRead()
+	if err != nil {
+		return nil, err
+	}
+	return lm.seek(lsn, first, tail)
+}
+
+// seek returns a forward iterator at the first record with an LSN of at least
+// lsn in a log whose blocks run from first to the given tail.
+func (lm *LogMgr) seek(lsn, first int, tail *logTail) (*ForwardLogIterator, error) {
+	blockSize := lm.fm.BlockSize()
+	if lsn/blockSize < first {
+		return nil, fmt.Errorf("%w: LSN %d is before the first LSN %d of the log", ErrLSNTruncated, lsn, first*blockSize+1)
+	}
+	blknum := min(lsn/blockSize, tail.blknum)
+	it, err := newForwardLogIterator(lm.lf, blknum, first, tail.blknum, tail)
+	if err != nil {
+		return nil, err
+	}
+	if err := it.skipBefore(lsn); err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+// Truncate removes the segments of the log that hold only records with an
+// LSN below beforeLSN, such as the records before a checkpoint. A record that
+// spans segments is kept whole, and the segment holding the tail of the log is
+// never removed, nor is a log kept in a single file. With an archive
+// storage, each segment is copied there before it is removed. Records
+// under a Hold are kept, and an open iterator that reaches a removed segment
+// fails with ErrLSNTruncated.
+func (lm *LogMgr) Truncate(beforeLSN int) error {
+	lm.truncMu.Lock()
+	defer lm.truncMu.Unlock()
+
+	it, err := lm.SeekLSN(max(lm.heldBefore(beforeLSN), 1))
+	if errors.Is(err, ErrLSNTruncated) {
+		// The log has already been truncated past beforeLSN.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// The iterator is at the block in which the first kept record starts, or
+	// at the tail if there is none. If that block begins with the end of an
+	// earlier record, the block holding the start of that record is kept too,
+	// so that the log never begins in the middle of a record.
+	if err := it.backUpToRecordStart(); err != nil {
+		return err
+	}
+	keepFrom := it.blknum
+
+	segs, err := lm.lf.segments()
+	if err != nil {
+		return err
+	}
+	for _, seg := range segs {
+		if (seg+1)*lm.lf.segBlocks > keepFrom {
+			break
+		}
+		name := SegmentName(lm.lf.name, seg)
+		if lm.archive != nil {
+			if err := lm.fm.ArchiveFile(name, lm.archive); err != nil {
+				return fmt.Errorf("failed to archive log segment %s: %w", name, err)
+			}
+		}
+		if err := lm.lf.removeSegment(seg); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// Append writes a log record to the log buffer.
-func (lm *LogMgr) Append(logrec []byte) int {
-	boundaryInt, _ := lm.logpage.GetInt(0)
+// Append writes a log record to the log buffer and returns its LSN. A record
+// that does not fit in the rest of the current block is moved to a new block,
+// and one that does not fit in an empty block either is split across as many
+// blocks as it needs.
+func (lm *LogMgr) Append(logrec []byte) (int, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if lm.closed {
+		return 0, ErrClosed
+	}
+	if lm.fm.ReadOnly() {
+		return 0, file.ErrReadOnly
+	}
+	if len(logrec) > MaxRecordSize {
+		return 0, fmt.Errorf("%w: %d bytes exceeds the maximum of %d", ErrRecordTooLarge, len(logrec), MaxRecordSize)
+	}
+
+	blockSize := lm.fm.BlockSize()
+	boundaryInt, err := lm.logpage.GetInt(0)
+	if err != nil {
+		return 0, err
+	}
 	boundary := int(boundaryInt)
-	recsize := len(logrec)
-	bytesneeded := recsize + file.IntSize
+	bytesneeded := len(logrec) + fragHeaderSize
+
+	// The boundary takes the first IntSize bytes of the block.
+	if boundary-bytesneeded < file.IntSize {
+		if bytesneeded <= blockSize-file.IntSize || boundary-file.IntSize-fragHeaderSize <= 0 {
+			if err := lm.nextBlock(); err != nil {
+				return 0, err
+			}
+			boundary = blockSize
+		}
+	}
+	if boundary-bytesneeded >= file.IntSize {
+		if err := lm.appendFragment(boundary-bytesneeded, fragFull, logrec); err != nil {
+			return 0, err
+		}
+		return lm.latestLSN, nil
+	}
+
+	if blockSize <= file.IntSize+fragHeaderSize {
+		return 0, fmt.Errorf("log block size %d is too small to split records", blockSize)
+	}
+	rest, kind := logrec, fragFirst
+	for {
+		room := boundary - file.IntSize - fragHeaderSize
+		if len(rest) <= room {
+			if err := lm.appendFragment(boundary-fragHeaderSize-len(rest), fragLast, rest); err != nil {
+				return 0, err
+			}
+			return lm.latestLSN, nil
+		}
+		if err := lm.appendFragment(file.IntSize, kind, rest[:room]); err != nil {
+			return 0, err
+		}
+		rest, kind = rest[room:], fragMiddle
+		if err := lm.nextBlock(); err != nil {
+			return 0, err
+		}
+		boundary = blockSize
+	}
+}
+
+// appendFragment writes a fragment at pos in the log page and moves the
+// boundary to it. A fragment that ends a record sets the latest LSN.
+func (lm *LogMgr) appendFragment(pos int, kind uint32, data []byte) error {
+	if err := writeFragment(lm.logpage, pos, kind, data); err != nil {
+		return err
+	}
+	if err := lm.logpage.SetInt(0, int32(pos)); err != nil {
+		return err
+	}
+	if kind == fragFull || kind == fragLast {
+		lm.latestLSN = lsnAt(lm.fm.BlockSize(), lm.currentblk, pos)
+	}
+	return nil
+}
+
+// nextBlock flushes the log page and starts a new block, which begins a new
+// segment when the current one is full.
+func (lm *LogMgr) nextBlock() error {
+	if err := lm.flush(); err != nil {
+		return err
+	}
+	if err := appendNewBlock(lm.lf, lm.currentblk+1, lm.logpage); err != nil {
+		return err
+	}
+	lm.currentblk++
+	return nil
+}
 
-	if boundary-bytesneeded < 0 {
-		lm.flush()
-		lm.currentblk = appendNewBlock(lm.fm, lm.logfile, lm.logpage)
-		boundaryInt, _ = lm.logpage.GetInt(0)
-		boundary = int(boundaryInt)
+// Close flushes the tail of the log to disk. Any later call that appends to or
+// reads the log fails with ErrClosed.
+func (lm *LogMgr) Close() error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if lm.closed {
+		return ErrClosed
+	}
+	if err := lm.flush(); err != nil {
+		return err
 	}
+	lm.closed = true
+	return nil
+}
+
+// appendNewBlock initializes block blknum, the next block of the log, for log
+// storage.
+func appendNewBlock(lf *logFile, blknum int, logpage *file.Page) error {
+	blk, err := lf.appendBlock(blknum)
+	if err != nil {
+		return fmt.Errorf("%w: append log block %d: %w", ErrWriteFailed, blknum, err)
+	}
+
+	// Clear the records of the previous block, so that they cannot be
+	// mistaken for records of this one when a torn tail is repaired.
+	clear(logpage.Contents())
+	if err := logpage.SetInt(0, int32(lf.fm.BlockSize())); err != nil {
+		return err
+	}
+	if err := lf.fm.Write(blk, logpage.Contents()); err != nil {
+		return fmt.Errorf("%w: write log block %s: %w", ErrWriteFailed, blk, err)
+	}
+	return nil
+}
+
+// flushForRead flushes the log so that iterators see every record, and
+// returns the first block of the log and a copy of the current tail block.
+func (lm *LogMgr) flushForRead() (int, *logTail, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
 
-	recpos := boundary - bytesneeded
-	lm.logpage.SetBytes(recpos, logrec)
-	lm.logpage.SetInt(0, int32(recpos))
-	lm.latestLSN++
-	return lm.latestLSN
+	if lm.closed {
+		return 0, nil, ErrClosed
+	}
+	if err := lm.flush(); err != nil {
+		return 0, nil, err
+	}
+	first, _, err := lm.lf.bounds()
+	if err != nil {
+		return 0, nil, err
+	}
+	tail := &logTail{
+		blknum:   lm.currentblk,
+		contents: append([]byte(nil), lm.logpage.Contents()...),
+	}
+	return first, tail, nil
 }
 
-// appendNewBlock initializes a new block for log storage.
-func appendNewBlock(fm *file.FileMgr, logfile string, logpage *file.Page) *file.BlockId {
-	blk, err := fm.Append(logfile)
+// flushedForRead returns the first block of the log and a copy of the block
+// holding the last flushed record, cut back so that it ends with that record.
+// The records after it are either in the log buffer or in a block written
+// ahead of the rest of a record that spans blocks.
+func (lm *LogMgr) flushedForRead() (int, *logTail, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if lm.closed {
+		return 0, nil, ErrClosed
+	}
+	first, _, err := lm.lf.bounds()
 	if err != nil {
-		panic(err)
+		return 0, nil, err
+	}
+	blockSize := lm.fm.BlockSize()
+	blknum, boundary := lm.lastSavedLSN/blockSize, blockSize-lm.lastSavedLSN%blockSize
+	if blknum < first {
+		blknum, boundary = first, blockSize
 	}
 
-	logpage.SetInt(0, int32(fm.BlockSize()))
-	fm.Write(blk, logpage.Contents())
-	return &blk
+	p := file.NewPage(blockSize)
+	if blknum == lm.currentblk {
+		copy(p.Contents(), lm.logpage.Contents())
+	} else if _, err := lm.lf.read(blknum, p, nil); err != nil {
+		return 0, nil, err
+	}
+	if err := p.SetInt(0, int32(boundary)); err != nil {
+		return 0, nil, err
+	}
+	return first, &logTail{blknum: blknum, contents: p.Contents()}, nil
 }
 
-// flush writes the current log buffer to disk.
-func (lm *LogMgr) flush() {
-	lm.fm.Write(*lm.currentblk, lm.logpage.Contents())
+// flush writes the current log buffer to disk and makes it durable according
+// to the sync policy of the file manager. A read-only log has nothing to write.
+func (lm *LogMgr) flush() error {
+	if lm.fm.ReadOnly() {
+		return nil
+	}
+	blk := lm.lf.block(lm.currentblk)
+	if err := lm.fm.Write(blk, lm.logpage.Contents()); err != nil {
+		return fmt.Errorf("%w: write log block %s: %w", ErrWriteFailed, blk, err)
+	}
+	if err := lm.fm.Sync(blk.Filename); err != nil {
+		return fmt.Errorf("%w: sync %s: %w", ErrWriteFailed, blk.Filename, err)
+	}
 	lm.lastSavedLSN = lm.latestLSN
+	return nil
 }
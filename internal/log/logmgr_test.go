@@ -2,20 +2,23 @@ package log
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
 
 	"database_design_and_implementation/internal/file"
+	"database_design_and_implementation/internal/file/faultfs"
 )
 
 // TestLogMgr tests the log manager functionality.
 func TestLogMgr(t *testing.T) {
 	blockSize := 1024
-	fm, err := file.NewFileMgr("../../temp", blockSize)
-	if err != nil {
-		t.Fatalf("Failed to create FileMgr: %v", err)
-	}
+	fm := newTestFileMgr(t, file.NewMemStorage(), blockSize)
 
-	logMgr := NewLogMgr(fm, "logfile-logmgr")
+	logMgr := newTestLogMgr(t, fm, "logfile-logmgr")
 
 	logData := [][]byte{
 		[]byte("record1"),
@@ -25,14 +28,21 @@ func TestLogMgr(t *testing.T) {
 
 	lsns := make([]int, len(logData))
 	for i, data := range logData {
-		lsns[i] = logMgr.Append(data)
+		lsn, err := logMgr.Append(data)
+		if err != nil {
+			t.Fatalf("Failed to append log record: %v", err)
+		}
+		lsns[i] = lsn
 		t.Logf("Appended log record: %s (LSN: %d)", data, lsns[i])
 	}
 
 	logMgr.Flush(lsns[len(lsns)-1])
 	t.Log("Flushed logs up to latest LSN.")
 
-	iter := logMgr.Iterator()
+	iter, err := logMgr.Iterator()
+	if err != nil {
+		t.Fatalf("Failed to create LogIterator: %v", err)
+	}
 	t.Log("Created LogIterator.")
 
 	for i := len(logData) - 1; i >= 0; i-- {
@@ -56,3 +66,370 @@ func TestLogMgr(t *testing.T) {
 
 	t.Log("TestLogMgr completed successfully.")
 }
+
+// TestLogMgrIteratorAcrossBlocks tests that the iterator walks back through every log block.
+func TestLogMgrIteratorAcrossBlocks(t *testing.T) {
+	blockSize := 64
+	fm := newTestFileMgr(t, file.NewMemStorage(), blockSize)
+
+	logMgr := newTestLogMgr(t, fm, "logfile-multiblock")
+
+	numRecords := 20
+	for i := 0; i < numRecords; i++ {
+		if _, err := logMgr.Append([]byte(fmt.Sprintf("record%02d", i))); err != nil {
+			t.Fatalf("Failed to append log record: %v", err)
+		}
+	}
+
+	logsize, err := fm.Length(SegmentName("logfile-multiblock", 0))
+	if err != nil {
+		t.Fatalf("Failed to get log length: %v", err)
+	}
+	if logsize < 3 {
+		t.Fatalf("Expected the log to span several blocks, got %d", logsize)
+	}
+
+	iter, err := logMgr.Iterator()
+	if err != nil {
+		t.Fatalf("Failed to create LogIterator: %v", err)
+	}
+
+	for i := numRecords - 1; i >= 0; i-- {
+		if !iter.HasNext() {
+			t.Fatalf("Expected more records, but iterator has no next element at index %d", i)
+		}
+		rec, err := iter.Next()
+		if err != nil {
+			t.Fatalf("Failed to read log record %d: %v", i, err)
+		}
+		if want := fmt.Sprintf("record%02d", i); string(rec) != want {
+			t.Fatalf("Mismatch: expected %s, but got %s", want, rec)
+		}
+	}
+
+	if iter.HasNext() {
+		t.Fatalf("Expected no more records, but iterator has next element")
+	}
+}
+
+// TestLogIteratorReadError tests that a block that cannot be read is reported as an error.
+func TestLogIteratorReadError(t *testing.T) {
+	fm := newTestFileMgr(t, file.NewMemStorage(), 64)
+
+	blk := file.NewBlockId("logfile-missing", 3)
+	if _, err := NewLogIterator(fm, &blk); err == nil {
+		t.Fatalf("Expected an error for a block past the end of the log")
+	}
+}
+
+// TestLogMgrLSNsSurviveRestart tests that LSNs keep increasing after the log is reopened.
+func TestLogMgrLSNsSurviveRestart(t *testing.T) {
+	st := file.NewMemStorage()
+	blockSize := 64
+	fm := newTestFileMgr(t, st, blockSize)
+
+	logMgr := newTestLogMgr(t, fm, "logfile-restart")
+	var lastLSN int
+	for i := 0; i < 10; i++ {
+		lsn, err := logMgr.Append([]byte(fmt.Sprintf("record%02d", i)))
+		if err != nil {
+			t.Fatalf("Failed to append log record: %v", err)
+		}
+		lastLSN = lsn
+	}
+	logMgr.Flush(lastLSN)
+
+	fm = newTestFileMgr(t, st, blockSize)
+	logMgr = newTestLogMgr(t, fm, "logfile-restart")
+	if logMgr.LatestLSN() != lastLSN {
+		t.Fatalf("Expected latest LSN %d after restart, got %d", lastLSN, logMgr.LatestLSN())
+	}
+
+	lsn, err := logMgr.Append([]byte("after-restart"))
+	if err != nil {
+		t.Fatalf("Failed to append log record: %v", err)
+	}
+	if lsn <= lastLSN {
+		t.Fatalf("Expected LSN greater than %d after restart, got %d", lastLSN, lsn)
+	}
+
+	blk, offset, err := logMgr.Locate(lsn)
+	if err != nil {
+		t.Fatalf("Locate(%d) failed: %v", lsn, err)
+	}
+	logMgr.Flush(lsn)
+
+	page := file.NewPage(blockSize)
+	if err := fm.Read(blk, page.Contents()); err != nil {
+		t.Fatalf("Failed to read log block %s: %v", blk, err)
+	}
+	_, rec, err := readFragment(page, offset, blk)
+	if err != nil {
+		t.Fatalf("Failed to read record at offset %d: %v", offset, err)
+	}
+	if string(rec) != "after-restart" {
+		t.Fatalf("Locate(%d) returned %s offset %d holding %q", lsn, blk, offset, rec)
+	}
+}
+
+// TestLocateInvalidLSN tests that LSNs no record can have are rejected.
+func TestLocateInvalidLSN(t *testing.T) {
+	fm := newTestFileMgr(t, file.NewMemStorage(), 64)
+	logMgr := newTestLogMgr(t, fm, "logfile-locate")
+
+	for _, lsn := range []int{0, -1, 64, 128, 61} {
+		if _, _, err := logMgr.Locate(lsn); !errors.Is(err, ErrInvalidLSN) {
+			t.Errorf("Expected ErrInvalidLSN for LSN %d, got %v", lsn, err)
+		}
+	}
+}
+
+// TestLogMgrWriteError tests that a failed write of the log is returned
+// instead of crashing the process.
+func TestLogMgrWriteError(t *testing.T) {
+	st, err := faultfs.New(file.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create fault storage: %v", err)
+	}
+	fm, err := file.NewFileMgrWithOptions("testdb", 64, file.Options{Storage: st})
+	if err != nil {
+		t.Fatalf("Failed to create FileMgr: %v", err)
+	}
+
+	st.FailWrite(1)
+	if _, err := NewLogMgr(fm, "logfile-eio"); !errors.Is(err, ErrWriteFailed) || !errors.Is(err, syscall.EIO) {
+		t.Fatalf("Expected ErrWriteFailed wrapping EIO from NewLogMgr, got %v", err)
+	}
+
+	logMgr := newTestLogMgr(t, fm, "logfile-eio")
+	lsn, err := logMgr.Append([]byte("record"))
+	if err != nil {
+		t.Fatalf("Failed to append log record: %v", err)
+	}
+	st.FailWrite(1)
+	if err := logMgr.Flush(lsn); !errors.Is(err, ErrWriteFailed) || !errors.Is(err, syscall.EIO) {
+		t.Fatalf("Expected ErrWriteFailed wrapping EIO from Flush, got %v", err)
+	}
+	if err := logMgr.Flush(lsn); err != nil {
+		t.Fatalf("Expected a retried flush to succeed, got %v", err)
+	}
+
+	iter, err := logMgr.Iterator()
+	if err != nil {
+		t.Fatalf("Failed to create LogIterator: %v", err)
+	}
+	if _, err := iter.Next(); err != nil {
+		t.Fatalf("Failed to read log record: %v", err)
+	}
+	if _, err := iter.Next(); !errors.Is(err, ErrNoMoreRecords) {
+		t.Fatalf("Expected ErrNoMoreRecords after the last record, got %v", err)
+	}
+}
+
+// TestLogMgrClose tests that Close flushes the tail and rejects later calls.
+func TestLogMgrClose(t *testing.T) {
+	st := file.NewMemStorage()
+	fm := newTestFileMgr(t, st, 64)
+
+	logMgr := newTestLogMgr(t, fm, "logfile-close")
+	lsn, err := logMgr.Append([]byte("last"))
+	if err != nil {
+		t.Fatalf("Failed to append log record: %v", err)
+	}
+	if err := logMgr.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if _, err := logMgr.Append([]byte("too late")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Expected ErrClosed from Append, got %v", err)
+	}
+	if _, err := logMgr.Iterator(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Expected ErrClosed from Iterator, got %v", err)
+	}
+	if _, err := logMgr.ForwardIterator(0); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Expected ErrClosed from ForwardIterator, got %v", err)
+	}
+	if err := logMgr.Flush(lsn + 1); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Expected ErrClosed from Flush, got %v", err)
+	}
+	if err := logMgr.Flush(lsn); err != nil {
+		t.Fatalf("Expected a record written before Close to be flushed, got %v", err)
+	}
+	if err := logMgr.Close(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Expected ErrClosed from a second Close, got %v", err)
+	}
+
+	// The record appended before Close is on disk.
+	reopened := newTestFileMgr(t, st, 64)
+	iter, err := newTestLogMgr(t, reopened, "logfile-close").Iterator()
+	if err != nil {
+		t.Fatalf("Failed to create LogIterator: %v", err)
+	}
+	rec, err := iter.Next()
+	if err != nil || string(rec) != "last" {
+		t.Fatalf("Expected record %q after reopen, got %q (err %v)", "last", rec, err)
+	}
+}
+
+// TestLogMgrConcurrentAppends tests that concurrent writers get increasing
+// LSNs for their records while readers iterate over the log. Run it with the
+// race detector.
+func TestLogMgrConcurrentAppends(t *testing.T) {
+	fm := newTestFileMgr(t, file.NewMemStorage(), 128)
+	logMgr := newTestLogMgrWithOptions(t, fm, "logfile-concurrent", Options{SegmentBlocks: 4})
+
+	numWriters, perWriter := 8, 100
+	lsns := make([]map[int]string, numWriters)
+	errCh := make(chan error, numWriters+2)
+
+	var writers sync.WaitGroup
+	for w := 0; w < numWriters; w++ {
+		lsns[w] = make(map[int]string)
+		writers.Add(1)
+		go func(w int) {
+			defer writers.Done()
+			prev := 0
+			for i := 0; i < perWriter; i++ {
+				rec := fmt.Sprintf("writer%d-%03d", w, i)
+				// Some records are split across blocks.
+				if i%17 == 0 {
+					rec += strings.Repeat(".", 300)
+				}
+				lsn, err := logMgr.Append([]byte(rec))
+				if err != nil {
+					errCh <- err
+					return
+				}
+				if lsn <= prev {
+					errCh <- fmt.Errorf("writer %d got LSN %d after %d", w, lsn, prev)
+					return
+				}
+				prev = lsn
+				lsns[w][lsn] = rec
+				if i%5 == 0 {
+					if err := logMgr.Flush(lsn); err != nil {
+						errCh <- err
+						return
+					}
+				}
+			}
+		}(w)
+	}
+
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for r := 0; r < 2; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if err := checkLSNOrder(logMgr); err != nil {
+					errCh <- err
+					return
+				}
+			}
+		}()
+	}
+
+	writers.Wait()
+	close(done)
+	readers.Wait()
+	close(errCh)
+	for err := range errCh {
+		t.Fatalf("Concurrent use failed: %v", err)
+	}
+
+	want := make(map[int]string)
+	for _, m := range lsns {
+		for lsn, rec := range m {
+			if other, ok := want[lsn]; ok {
+				t.Fatalf("LSN %d was given to both %.14s and %.14s", lsn, other, rec)
+			}
+			want[lsn] = rec
+		}
+	}
+	iter, err := logMgr.Iterator()
+	if err != nil {
+		t.Fatalf("Failed to create LogIterator: %v", err)
+	}
+	n := 0
+	for iter.HasNext() {
+		rec, err := iter.Next()
+		if err != nil {
+			t.Fatalf("Failed to read log record: %v", err)
+		}
+		if want[iter.LSN()] != string(rec) {
+			t.Fatalf("Expected %.14q at LSN %d, got %.14q", want[iter.LSN()], iter.LSN(), rec)
+		}
+		n++
+	}
+	if n != numWriters*perWriter {
+		t.Fatalf("Expected %d records, got %d", numWriters*perWriter, n)
+	}
+}
+
+// checkLSNOrder reads the whole log in both directions and checks that the
+// LSNs of its records are in order.
+func checkLSNOrder(logMgr *LogMgr) error {
+	iter, err := logMgr.Iterator()
+	if err != nil {
+		return err
+	}
+	prev := 0
+	for iter.HasNext() {
+		if _, err := iter.Next(); err != nil {
+			return err
+		}
+		if prev != 0 && iter.LSN() >= prev {
+			return fmt.Errorf("reverse iterator returned LSN %d after %d", iter.LSN(), prev)
+		}
+		prev = iter.LSN()
+	}
+
+	fwd, err := logMgr.SeekLSN(1)
+	if err != nil {
+		return err
+	}
+	prev = 0
+	for fwd.HasNext() {
+		if _, err := fwd.Next(); err != nil {
+			return err
+		}
+		if fwd.LSN() <= prev {
+			return fmt.Errorf("forward iterator returned LSN %d after %d", fwd.LSN(), prev)
+		}
+		prev = fwd.LSN()
+	}
+	return nil
+}
+
+// newTestLogMgr opens a log with the default options.
+func newTestLogMgr(t *testing.T, fm *file.FileMgr, logfile string) *LogMgr {
+	t.Helper()
+	return newTestLogMgrWithOptions(t, fm, logfile, Options{})
+}
+
+// newTestLogMgrWithOptions opens a log with the given options.
+func newTestLogMgrWithOptions(t *testing.T, fm *file.FileMgr, logfile string, opts Options) *LogMgr {
+	t.Helper()
+	logMgr, err := NewLogMgrWithOptions(fm, logfile, opts)
+	if err != nil {
+		t.Fatalf("Failed to create LogMgr: %v", err)
+	}
+	return logMgr
+}
+
+// newTestFileMgr creates a FileMgr whose files are kept in the given memory storage.
+func newTestFileMgr(t *testing.T, st *file.MemStorage, blockSize int) *file.FileMgr {
+	t.Helper()
+	fm, err := file.NewFileMgrWithOptions("testdb", blockSize, file.Options{Storage: st})
+	if err != nil {
+		t.Fatalf("Failed to create FileMgr: %v", err)
+	}
+	return fm
+}
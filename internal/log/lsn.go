@@ -0,0 +1,42 @@
+package log
+
+import (
+	"fmt"
+
+	"database_design_and_implementation/internal/file"
+)
+
+// LSNs are derived from where a record is stored in the log, so they keep
+// increasing across restarts without being saved anywhere. Records are written
+// from the end of each block towards its boundary, and the LSN of a record
+// counts the log bytes up to and including it:
+//
+//	lsn = blknum*blockSize + (blockSize - offset)
+//
+// The boundary occupies the first IntSize bytes of every block, so a record
+// offset is never 0 and the block and offset can be recovered from the LSN.
+// Blocks are numbered across segments, so removing old segments does not
+// change the LSNs of the records that remain.
+
+// lsnAt returns the LSN of the record stored at the given offset of a log block.
+func lsnAt(blockSize, blknum, offset int) int {
+	return blknum*blockSize + blockSize - offset
+}
+
+// Locate returns the block of the log segment holding the record with the
+// given LSN, and the offset of the record within it.
+func (lm *LogMgr) Locate(lsn int) (file.BlockId, int, error) {
+	blockSize := lm.fm.BlockSize()
+	offset := blockSize - lsn%blockSize
+	if lsn < 1 || offset < file.IntSize || offset >= blockSize {
+		return file.BlockId{}, 0, fmt.Errorf("%w: %d", ErrInvalidLSN, lsn)
+	}
+	return lm.lf.block(lsn / blockSize), offset, nil
+}
+
+// LatestLSN returns the LSN of the most recently appended log record.
+func (lm *LogMgr) LatestLSN() int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.latestLSN
+}
@@ -0,0 +1,272 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"database_design_and_implementation/internal/file"
+)
+
+// DefaultSegmentBlocks is the number of blocks in a log segment unless
+// Options says otherwise.
+const DefaultSegmentBlocks = 1024
+
+// logHeaderMagic identifies the header file of a log ("SDBL").
+const logHeaderMagic = 0x5344424c
+
+// SegmentName returns the name of a segment file of a log.
+func SegmentName(logfile string, seg int) string {
+	return fmt.Sprintf("%s.%06d", logfile, seg)
+}
+
+// logFile locates the blocks of a log, which is either a single file or a
+// sequence of segment files of segBlocks blocks each. Blocks are numbered
+// across the whole log, so LSNs do not depend on how the log is split, and a
+// block is stored in segment blknum/segBlocks.
+type logFile struct {
+	fm        *file.FileMgr
+	name      string
+	segBlocks int
+
+	// mu keeps segments from being removed while a block is read from them.
+	// removed is the number of blocks in the segments removed so far.
+	mu      sync.RWMutex
+	removed int
+}
+
+// singleLogFile returns a logFile for a log kept in a single file.
+func singleLogFile(fm *file.FileMgr, name string) *logFile {
+	return &logFile{fm: fm, name: name}
+}
+
+// openLogFile returns the logFile of the named log. A log written before logs
+// were split into segments is kept in a single file and is never truncated.
+//
+// The segment size of a log is recorded in its header file when the log is
+// created, since LSNs map to the wrong blocks if it changes. If segBlocks is
+// zero, the recorded size is used; otherwise it must match. A segmented log
+// written before headers existed gets one, with the size of its first segment
+// if another follows it.
+func openLogFile(fm *file.FileMgr, name string, segBlocks int) (*logFile, error) {
+	names, err := fm.ListFiles()
+	if err != nil {
+		return nil, err
+	}
+	hasHeader := false
+	for _, n := range names {
+		if n == name {
+			return singleLogFile(fm, name), nil
+		}
+		hasHeader = hasHeader || n == headerName(name)
+	}
+
+	stored := 0
+	if hasHeader {
+		if stored, err = readLogHeader(fm, name); err != nil {
+			return nil, err
+		}
+	}
+	lf := &logFile{fm: fm, name: name, segBlocks: stored}
+	if stored == 0 {
+		if lf.segBlocks, err = lf.guessSegmentBlocks(segBlocks); err != nil {
+			return nil, err
+		}
+	} else if segBlocks != 0 && segBlocks != stored {
+		return nil, fmt.Errorf("%w: log %s has %d blocks per segment, opened with %d",
+			ErrSegmentSizeMismatch, name, stored, segBlocks)
+	}
+	if stored == 0 && !fm.ReadOnly() {
+		if err := writeLogHeader(fm, name, lf.segBlocks); err != nil {
+			return nil, err
+		}
+	}
+	return lf, nil
+}
+
+// guessSegmentBlocks returns the segment size of a log that has no header.
+// Every segment but the last is full, so the first one gives the size if
+// another follows it. Otherwise segBlocks is used, or DefaultSegmentBlocks if
+// it is zero, provided the only segment fits in it.
+func (lf *logFile) guessSegmentBlocks(segBlocks int) (int, error) {
+	segs, err := lf.segments()
+	if err != nil {
+		return 0, err
+	}
+	length := 0
+	if len(segs) > 0 {
+		if length, err = lf.fm.Length(SegmentName(lf.name, segs[0])); err != nil {
+			return 0, err
+		}
+	}
+	if len(segs) > 1 && segBlocks == 0 {
+		return length, nil
+	}
+	if segBlocks == 0 {
+		segBlocks = DefaultSegmentBlocks
+	}
+	if (len(segs) > 1 && length != segBlocks) || length > segBlocks {
+		return 0, fmt.Errorf("%w: log %s has a segment of %d blocks, opened with %d",
+			ErrSegmentSizeMismatch, lf.name, length, segBlocks)
+	}
+	return segBlocks, nil
+}
+
+// headerName returns the name of the header file of a log.
+func headerName(logfile string) string {
+	return logfile + ".hdr"
+}
+
+// readLogHeader returns the segment size recorded in the header of a log, or
+// zero if the header was never written.
+func readLogHeader(fm *file.FileMgr, logfile string) (int, error) {
+	hdr := headerName(logfile)
+	length, err := fm.Length(hdr)
+	if err != nil || length == 0 {
+		return 0, err
+	}
+	p := file.NewPage(fm.BlockSize())
+	if err := fm.Read(file.NewBlockId(hdr, 0), p.Contents()); err != nil {
+		return 0, fmt.Errorf("%w: read log header %s: %w", ErrReadFailed, hdr, err)
+	}
+	magic, err := p.GetInt(0)
+	if err != nil {
+		return 0, err
+	}
+	segBlocks, err := p.GetInt(file.IntSize)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case magic == 0 && segBlocks == 0:
+		// A crash interrupted the creation of the header.
+		return 0, nil
+	case uint32(magic) != logHeaderMagic || segBlocks <= 0:
+		return 0, fmt.Errorf("%w: log header %s is corrupt", ErrReadFailed, hdr)
+	}
+	return int(segBlocks), nil
+}
+
+// writeLogHeader records the segment size of a log in its header and syncs it.
+func writeLogHeader(fm *file.FileMgr, logfile string, segBlocks int) error {
+	hdr := headerName(logfile)
+	length, err := fm.Length(hdr)
+	if err == nil && length == 0 {
+		_, err = fm.Append(hdr)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: create log header %s: %w", ErrWriteFailed, hdr, err)
+	}
+	p := file.NewPage(fm.BlockSize())
+	if err := p.SetInt(0, int32(logHeaderMagic)); err != nil {
+		return err
+	}
+	if err := p.SetInt(file.IntSize, int32(segBlocks)); err != nil {
+		return err
+	}
+	if err := fm.Write(file.NewBlockId(hdr, 0), p.Contents()); err != nil {
+		return fmt.Errorf("%w: write log header %s: %w", ErrWriteFailed, hdr, err)
+	}
+	if err := fm.Sync(hdr); err != nil {
+		return fmt.Errorf("%w: sync %s: %w", ErrWriteFailed, hdr, err)
+	}
+	return nil
+}
+
+// block returns the block that stores a block of the log.
+func (lf *logFile) block(blknum int) file.BlockId {
+	if lf.segBlocks == 0 {
+		return file.NewBlockId(lf.name, blknum)
+	}
+	return file.NewBlockId(SegmentName(lf.name, blknum/lf.segBlocks), blknum%lf.segBlocks)
+}
+
+// segments returns the numbers of the segment files of the log, in order.
+func (lf *logFile) segments() ([]int, error) {
+	names, err := lf.fm.ListFiles()
+	if err != nil {
+		return nil, err
+	}
+	prefix := lf.name + "."
+	var segs []int
+	for _, name := range names {
+		suffix, ok := strings.CutPrefix(name, prefix)
+		if !ok || len(suffix) < 6 {
+			continue
+		}
+		if seg, err := strconv.Atoi(suffix); err == nil && seg >= 0 {
+			segs = append(segs, seg)
+		}
+	}
+	sort.Ints(segs)
+	return segs, nil
+}
+
+// bounds returns the first block of the log that has not been truncated, and
+// the number of blocks up to the end of the log.
+func (lf *logFile) bounds() (int, int, error) {
+	if lf.segBlocks == 0 {
+		length, err := lf.fm.Length(lf.name)
+		return 0, length, err
+	}
+
+	segs, err := lf.segments()
+	if err != nil || len(segs) == 0 {
+		return 0, 0, err
+	}
+	for i := 1; i < len(segs); i++ {
+		if segs[i] != segs[i-1]+1 {
+			return 0, 0, fmt.Errorf("log %s is missing segment %d", lf.name, segs[i-1]+1)
+		}
+	}
+	last := segs[len(segs)-1]
+	length, err := lf.fm.Length(SegmentName(lf.name, last))
+	if err != nil {
+		return 0, 0, err
+	}
+	return segs[0] * lf.segBlocks, last*lf.segBlocks + length, nil
+}
+
+// appendBlock adds an empty block to the end of the log, which must be blknum.
+func (lf *logFile) appendBlock(blknum int) (file.BlockId, error) {
+	want := lf.block(blknum)
+	blk, err := lf.fm.Append(want.Filename)
+	if err != nil {
+		return file.BlockId{}, err
+	}
+	if blk != want {
+		return file.BlockId{}, fmt.Errorf("appended %s to the log, expected %s", blk, want)
+	}
+	return blk, nil
+}
+
+// removeSegment deletes a segment file from the start of the log. Iterators
+// that later try to read its blocks fail with ErrLSNTruncated.
+func (lf *logFile) removeSegment(seg int) error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	lf.removed = max(lf.removed, (seg+1)*lf.segBlocks)
+	return lf.fm.DeleteFile(SegmentName(lf.name, seg))
+}
+
+// truncate cuts the log back to its first length blocks.
+func (lf *logFile) truncate(length int) error {
+	last := lf.block(length - 1)
+	if lf.segBlocks > 0 {
+		segs, err := lf.segments()
+		if err != nil {
+			return err
+		}
+		for _, seg := range segs {
+			if seg > (length-1)/lf.segBlocks {
+				if err := lf.fm.DeleteFile(SegmentName(lf.name, seg)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return lf.fm.Truncate(last.Filename, last.Blknum+1)
+}
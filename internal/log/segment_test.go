@@ -0,0 +1,544 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"database_design_and_implementation/internal/file"
+	"database_design_and_implementation/internal/file/faultfs"
+)
+
+// appendRecords appends records first to first+n-1 to the log and returns their LSNs.
+func appendRecords(t *testing.T, logMgr *LogMgr, first, n int) []int {
+	t.Helper()
+	lsns := make([]int, n)
+	for i := range lsns {
+		lsn, err := logMgr.Append([]byte(fmt.Sprintf("record%02d", first+i)))
+		if err != nil {
+			t.Fatalf("Failed to append log record: %v", err)
+		}
+		lsns[i] = lsn
+	}
+	return lsns
+}
+
+// archivedSize returns the size of a segment copied to an archive, failing the
+// test if it is not there.
+func archivedSize(t *testing.T, archive file.Storage, name string) int {
+	t.Helper()
+	names, err := archive.List()
+	if err != nil {
+		t.Fatalf("Failed to list the archive: %v", err)
+	}
+	found := false
+	for _, n := range names {
+		found = found || n == name
+	}
+	if !found {
+		t.Fatalf("Expected %s to be archived, the archive holds %v", name, names)
+	}
+	f, err := archive.Open(name)
+	if err != nil {
+		t.Fatalf("Failed to open archived %s: %v", name, err)
+	}
+	defer f.Close()
+	size, err := f.Size()
+	if err != nil {
+		t.Fatalf("Failed to get the size of archived %s: %v", name, err)
+	}
+	return int(size)
+}
+
+// seekFirst returns a forward iterator at the first record kept in the log.
+func seekFirst(t *testing.T, logMgr *LogMgr) *ForwardLogIterator {
+	t.Helper()
+	lsn, err := logMgr.FirstLSN()
+	if err != nil {
+		t.Fatalf("FirstLSN failed: %v", err)
+	}
+	fwd, err := logMgr.SeekLSN(lsn)
+	if err != nil {
+		t.Fatalf("SeekLSN(%d) failed: %v", lsn, err)
+	}
+	return fwd
+}
+
+// expectRecordsFrom checks that the log holds exactly records first to n-1,
+// reading it in both directions.
+func expectRecordsFrom(t *testing.T, logMgr *LogMgr, first, n int) {
+	t.Helper()
+	iter, err := logMgr.Iterator()
+	if err != nil {
+		t.Fatalf("Failed to create LogIterator: %v", err)
+	}
+	for i := n - 1; i >= first; i-- {
+		rec, err := iter.Next()
+		if err != nil {
+			t.Fatalf("Failed to read record %d: %v", i, err)
+		}
+		if want := fmt.Sprintf("record%02d", i); string(rec) != want {
+			t.Fatalf("Mismatch: expected %s, but got %s", want, rec)
+		}
+	}
+	if iter.HasNext() {
+		t.Fatalf("Expected no more records after record %d", first)
+	}
+
+	fwd := seekFirst(t, logMgr)
+	for i := first; i < n; i++ {
+		rec, err := fwd.Next()
+		if err != nil {
+			t.Fatalf("Failed to read record %d forward: %v", i, err)
+		}
+		if want := fmt.Sprintf("record%02d", i); string(rec) != want {
+			t.Fatalf("Mismatch: expected %s, but got %s", want, rec)
+		}
+	}
+	if fwd.HasNext() {
+		t.Fatalf("Expected no more records after record %d", n-1)
+	}
+}
+
+// TestLogMgrSegments tests that the log is split into segment files and read
+// across them.
+func TestLogMgrSegments(t *testing.T) {
+	blockSize := 64
+	st := file.NewMemStorage()
+	fm := newTestFileMgr(t, st, blockSize)
+	opts := Options{SegmentBlocks: 2}
+
+	logMgr := newTestLogMgrWithOptions(t, fm, "logfile-segments", opts)
+	lsns := appendRecords(t, logMgr, 0, 40)
+	expectRecordsFrom(t, logMgr, 0, 40)
+
+	blk, _, err := logMgr.Locate(lsns[39])
+	if err != nil {
+		t.Fatalf("Locate failed: %v", err)
+	}
+	if blk.Filename == SegmentName("logfile-segments", 0) {
+		t.Fatalf("Expected the log to span several segments, the tail is in %s", blk.Filename)
+	}
+	for seg := 0; SegmentName("logfile-segments", seg) != blk.Filename; seg++ {
+		if n, err := fm.Length(SegmentName("logfile-segments", seg)); err != nil || n != opts.SegmentBlocks {
+			t.Fatalf("Expected segment %d to have %d blocks, got %d (err %v)", seg, opts.SegmentBlocks, n, err)
+		}
+	}
+
+	if err := logMgr.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	logMgr = newTestLogMgrWithOptions(t, fm, "logfile-segments", opts)
+	if got := logMgr.LatestLSN(); got != lsns[39] {
+		t.Fatalf("Expected latest LSN %d after reopening, got %d", lsns[39], got)
+	}
+	appendRecords(t, logMgr, 40, 10)
+	expectRecordsFrom(t, logMgr, 0, 50)
+}
+
+// TestLogMgrSegmentSize tests that the segment size of a log is recorded when
+// it is created, so that it is kept when the log is reopened without it and a
+// different size is refused.
+func TestLogMgrSegmentSize(t *testing.T) {
+	blockSize := 64
+	st := file.NewMemStorage()
+	fm := newTestFileMgr(t, st, blockSize)
+
+	logMgr := newTestLogMgrWithOptions(t, fm, "logfile-segsize", Options{SegmentBlocks: 2})
+	appendRecords(t, logMgr, 0, 40)
+	if err := logMgr.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	logMgr = newTestLogMgr(t, fm, "logfile-segsize")
+	if logMgr.lf.segBlocks != 2 {
+		t.Fatalf("Expected the recorded segment size 2, got %d", logMgr.lf.segBlocks)
+	}
+	expectRecordsFrom(t, logMgr, 0, 40)
+	if err := logMgr.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if _, err := NewLogMgrWithOptions(fm, "logfile-segsize", Options{SegmentBlocks: 3}); !errors.Is(err, ErrSegmentSizeMismatch) {
+		t.Fatalf("Expected ErrSegmentSizeMismatch, got %v", err)
+	}
+
+	// A log written before headers existed takes the size of its first segment.
+	if err := fm.DeleteFile(headerName("logfile-segsize")); err != nil {
+		t.Fatalf("Failed to delete the log header: %v", err)
+	}
+	if _, err := NewLogMgrWithOptions(fm, "logfile-segsize", Options{SegmentBlocks: 3}); !errors.Is(err, ErrSegmentSizeMismatch) {
+		t.Fatalf("Expected ErrSegmentSizeMismatch for a log without a header, got %v", err)
+	}
+	logMgr = newTestLogMgr(t, fm, "logfile-segsize")
+	expectRecordsFrom(t, logMgr, 0, 40)
+	if n, err := readLogHeader(fm, "logfile-segsize"); err != nil || n != 2 {
+		t.Fatalf("Expected the header to be written again with size 2, got %d (err %v)", n, err)
+	}
+}
+
+// TestLogMgrTruncate tests that truncation removes the segments before an
+// LSN, archives them, and leaves the rest of the log readable.
+func TestLogMgrTruncate(t *testing.T) {
+	blockSize := 64
+	st := file.NewMemStorage()
+	fm := newTestFileMgr(t, st, blockSize)
+	archive := file.NewMemStorage()
+	opts := Options{SegmentBlocks: 2, Archive: archive}
+
+	logMgr := newTestLogMgrWithOptions(t, fm, "logfile-truncate", opts)
+	lsns := appendRecords(t, logMgr, 0, 40)
+	keep, _, err := logMgr.Locate(lsns[30])
+	if err != nil {
+		t.Fatalf("Locate failed: %v", err)
+	}
+	if err := logMgr.Truncate(lsns[30]); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+
+	segs, err := logMgr.lf.segments()
+	if err != nil {
+		t.Fatalf("Failed to list segments: %v", err)
+	}
+	if SegmentName("logfile-truncate", segs[0]) != keep.Filename {
+		t.Fatalf("Expected the log to start at %s, it starts at segment %d", keep.Filename, segs[0])
+	}
+	for seg := 0; seg < segs[0]; seg++ {
+		name := SegmentName("logfile-truncate", seg)
+		if n := archivedSize(t, archive, name); n != opts.SegmentBlocks*blockSize {
+			t.Fatalf("Expected %d archived bytes of %s, got %d", opts.SegmentBlocks*blockSize, name, n)
+		}
+	}
+
+	// The records of the removed segments cannot be sought.
+	if _, err := logMgr.SeekLSN(lsns[0]); !errors.Is(err, ErrLSNTruncated) {
+		t.Fatalf("Expected ErrLSNTruncated seeking a removed record, got %v", err)
+	}
+	if firstLSN, err := logMgr.FirstLSN(); err != nil || firstLSN > lsns[30] {
+		t.Fatalf("Expected the first LSN to be at most %d, got %d (err %v)", lsns[30], firstLSN, err)
+	}
+	if err := logMgr.Truncate(lsns[0]); err != nil {
+		t.Fatalf("Truncating a truncated log failed: %v", err)
+	}
+
+	// The first record kept is the first one in its segment, which is not
+	// later than record 30.
+	fwd := seekFirst(t, logMgr)
+	rec, err := fwd.Next()
+	if err != nil {
+		t.Fatalf("Failed to read the first kept record: %v", err)
+	}
+	var first int
+	if _, err := fmt.Sscanf(string(rec), "record%02d", &first); err != nil || first == 0 || first > 30 {
+		t.Fatalf("Expected the first kept record to be between 1 and 30, got %s", rec)
+	}
+	expectRecordsFrom(t, logMgr, first, 40)
+
+	// Truncating up to the tail keeps the segment it is in.
+	if err := logMgr.Truncate(logMgr.LatestLSN() + 1); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	tail, _, err := logMgr.Locate(lsns[39])
+	if err != nil {
+		t.Fatalf("Locate failed: %v", err)
+	}
+	if n, err := fm.Length(tail.Filename); err != nil || n == 0 {
+		t.Fatalf("Expected the tail segment to be kept, it has %d blocks (err %v)", n, err)
+	}
+
+	if err := logMgr.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	logMgr = newTestLogMgrWithOptions(t, fm, "logfile-truncate", opts)
+	if got := logMgr.LatestLSN(); got != lsns[39] {
+		t.Fatalf("Expected latest LSN %d after reopening, got %d", lsns[39], got)
+	}
+	more := appendRecords(t, logMgr, 40, 5)
+	iter, err := logMgr.Iterator()
+	if err != nil {
+		t.Fatalf("Failed to create LogIterator: %v", err)
+	}
+	for i := len(more) - 1; iter.HasNext(); i-- {
+		if _, err := iter.Next(); err != nil {
+			t.Fatalf("Failed to read record: %v", err)
+		}
+		if i >= 0 && iter.LSN() != more[i] {
+			t.Fatalf("Expected LSN %d, got %d", more[i], iter.LSN())
+		}
+	}
+}
+
+// TestTruncateArchiveFaults tests that a segment is only removed once its
+// copy in the archive is durable.
+func TestTruncateArchiveFaults(t *testing.T) {
+	blockSize := 64
+	fm := newTestFileMgr(t, file.NewMemStorage(), blockSize)
+	archive, err := faultfs.New(file.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create the archive: %v", err)
+	}
+	opts := Options{SegmentBlocks: 2, Archive: archive}
+
+	logMgr := newTestLogMgrWithOptions(t, fm, "logfile-archive", opts)
+	lsns := appendRecords(t, logMgr, 0, 40)
+
+	// A failed copy leaves the log as it was.
+	archive.FailWrite(1)
+	if err := logMgr.Truncate(lsns[30]); err == nil {
+		t.Fatalf("Expected Truncate to fail when the archive cannot be written")
+	}
+	expectRecordsFrom(t, logMgr, 0, 40)
+
+	if err := logMgr.Truncate(lsns[30]); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	segs, err := logMgr.lf.segments()
+	if err != nil {
+		t.Fatalf("Failed to list segments: %v", err)
+	}
+	crashed, err := archive.Crash()
+	if err != nil {
+		t.Fatalf("Crash failed: %v", err)
+	}
+	for seg := 0; seg < segs[0]; seg++ {
+		name := SegmentName("logfile-archive", seg)
+		if n := archivedSize(t, crashed, name); n != opts.SegmentBlocks*blockSize {
+			t.Fatalf("Expected %d archived bytes of %s after a crash, got %d", opts.SegmentBlocks*blockSize, name, n)
+		}
+	}
+}
+
+// TestConcurrentTruncate tests that Truncate calls made at the same time
+// archive and remove each segment once.
+func TestConcurrentTruncate(t *testing.T) {
+	blockSize := 64
+	for round := 0; round < 10; round++ {
+		fm := newTestFileMgr(t, file.NewMemStorage(), blockSize)
+		archive := file.NewMemStorage()
+		opts := Options{SegmentBlocks: 1, Archive: archive}
+
+		logMgr := newTestLogMgrWithOptions(t, fm, "logfile-concurrent", opts)
+		appendRecords(t, logMgr, 0, 100)
+
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		errCh := make(chan error, 8)
+		for i := 0; i < cap(errCh); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				errCh <- logMgr.Truncate(logMgr.LatestLSN())
+			}()
+		}
+		close(start)
+		wg.Wait()
+		close(errCh)
+		for err := range errCh {
+			if err != nil {
+				t.Fatalf("Truncate failed: %v", err)
+			}
+		}
+
+		segs, err := logMgr.lf.segments()
+		if err != nil {
+			t.Fatalf("Failed to list segments: %v", err)
+		}
+		if segs[0] == 0 {
+			t.Fatalf("Expected segments to be removed")
+		}
+		for seg := 0; seg < segs[0]; seg++ {
+			name := SegmentName("logfile-concurrent", seg)
+			if n := archivedSize(t, archive, name); n != blockSize {
+				t.Fatalf("Expected %d archived bytes of %s, got %d", blockSize, name, n)
+			}
+		}
+		if _, err := seekFirst(t, logMgr).Next(); err != nil {
+			t.Fatalf("Failed to read the first kept record: %v", err)
+		}
+	}
+}
+
+// TestTruncateHold tests that Truncate keeps the records under a hold until
+// it is advanced or released.
+func TestTruncateHold(t *testing.T) {
+	blockSize := 64
+	fm := newTestFileMgr(t, file.NewMemStorage(), blockSize)
+	logMgr := newTestLogMgrWithOptions(t, fm, "logfile-truncate-hold", Options{SegmentBlocks: 1})
+	lsns := appendRecords(t, logMgr, 0, 40)
+
+	hold := logMgr.Hold(lsns[10])
+	if err := logMgr.Truncate(logMgr.LatestLSN()); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	if firstLSN, err := logMgr.FirstLSN(); err != nil || firstLSN > lsns[10] {
+		t.Fatalf("Expected the held record %d to be kept, the log starts at %d (err %v)", lsns[10], firstLSN, err)
+	}
+
+	hold.Advance(lsns[30])
+	hold.Advance(lsns[20])
+	if err := logMgr.Truncate(logMgr.LatestLSN()); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	if firstLSN, err := logMgr.FirstLSN(); err != nil || firstLSN <= lsns[10] || firstLSN > lsns[30] {
+		t.Fatalf("Expected the log to start after %d and by %d, it starts at %d (err %v)", lsns[10], lsns[30], firstLSN, err)
+	}
+
+	hold.Release()
+	hold.Release()
+	if err := logMgr.Truncate(logMgr.LatestLSN()); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	if firstLSN, err := logMgr.FirstLSN(); err != nil || firstLSN <= lsns[30] {
+		t.Fatalf("Expected the log to start after %d once released, it starts at %d (err %v)", lsns[30], firstLSN, err)
+	}
+}
+
+// TestTruncateOpenIterators tests that iterators opened before a truncation
+// report it when they reach a removed segment.
+func TestTruncateOpenIterators(t *testing.T) {
+	blockSize := 64
+	fm := newTestFileMgr(t, file.NewMemStorage(), blockSize)
+	logMgr := newTestLogMgrWithOptions(t, fm, "logfile-truncate-open", Options{SegmentBlocks: 2})
+	appendRecords(t, logMgr, 0, 40)
+
+	fwd := seekFirst(t, logMgr)
+	if _, err := fwd.Next(); err != nil {
+		t.Fatalf("Failed to read the first record: %v", err)
+	}
+	rev, err := logMgr.Iterator()
+	if err != nil {
+		t.Fatalf("Failed to create LogIterator: %v", err)
+	}
+	if err := logMgr.Truncate(logMgr.LatestLSN()); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+
+	for name, next := range map[string]func() ([]byte, error){"Forward": fwd.Next, "Reverse": rev.Next} {
+		for {
+			_, err := next()
+			if errors.Is(err, ErrLSNTruncated) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s iterator: expected ErrLSNTruncated, got %v", name, err)
+			}
+		}
+	}
+}
+
+// TestTruncateKeepsSpanningRecord tests that a record split across segments
+// is kept whole by truncation.
+func TestTruncateKeepsSpanningRecord(t *testing.T) {
+	blockSize := 64
+	fm := newTestFileMgr(t, file.NewMemStorage(), blockSize)
+	logMgr := newTestLogMgrWithOptions(t, fm, "logfile-truncate-span", Options{SegmentBlocks: 1})
+
+	appendRecords(t, logMgr, 0, 5)
+	big := bytes.Repeat([]byte("0123456789"), 15)
+	lsn, err := logMgr.Append(big)
+	if err != nil {
+		t.Fatalf("Failed to append log record: %v", err)
+	}
+	appendRecords(t, logMgr, 5, 5)
+
+	if err := logMgr.Truncate(lsn); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	fwd := seekFirst(t, logMgr)
+	for fwd.HasNext() {
+		rec, err := fwd.Next()
+		if err != nil {
+			t.Fatalf("Failed to read record: %v", err)
+		}
+		if bytes.Equal(rec, big) {
+			if fwd.LSN() != lsn {
+				t.Fatalf("Expected the split record at LSN %d, got %d", lsn, fwd.LSN())
+			}
+			return
+		}
+	}
+	t.Fatalf("Expected the split record to survive truncation")
+}
+
+// TestTruncateKeepsRecordStartingEarlier tests that truncation keeps the
+// segment holding the first fragment of a record that reaches into the first
+// block kept, so that the log can still be read from its first LSN.
+func TestTruncateKeepsRecordStartingEarlier(t *testing.T) {
+	blockSize := 64
+	fm := newTestFileMgr(t, file.NewMemStorage(), blockSize)
+	logMgr := newTestLogMgrWithOptions(t, fm, "logfile-truncate-earlier", Options{SegmentBlocks: 2})
+
+	// Fill the log up to the first record of block 3, in segment 1.
+	n := 0
+	for ; logMgr.LatestLSN()/blockSize < 3; n++ {
+		appendRecords(t, logMgr, n, 1)
+	}
+	// This record starts in block 3 and ends in segment 2.
+	big := spanningRecord(n, 100)
+	bigLSN, err := logMgr.Append(big)
+	if err != nil {
+		t.Fatalf("Failed to append log record: %v", err)
+	}
+	if bigLSN/blockSize/2 != 2 {
+		t.Fatalf("Expected the split record to end in segment 2, it ends in block %d", bigLSN/blockSize)
+	}
+	next, err := logMgr.Append([]byte("after"))
+	if err != nil {
+		t.Fatalf("Failed to append log record: %v", err)
+	}
+
+	if err := logMgr.Truncate(next); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	firstLSN, err := logMgr.FirstLSN()
+	if err != nil || firstLSN != 2*blockSize+1 {
+		t.Fatalf("Expected only segment 0 to be removed, the log starts at %d (err %v)", firstLSN, err)
+	}
+	fwd := seekFirst(t, logMgr)
+	var got [][]byte
+	for fwd.HasNext() {
+		rec, err := fwd.Next()
+		if err != nil {
+			t.Fatalf("Failed to read the log from its first LSN: %v", err)
+		}
+		got = append(got, rec)
+	}
+	if len(got) < 2 || !bytes.Equal(got[len(got)-2], big) || string(got[len(got)-1]) != "after" {
+		t.Fatalf("Expected the split record and the next one at the end of the log, got %q", got)
+	}
+}
+
+// TestSingleFileLogIsKept tests that a log written to a single file before
+// segments existed is still read, and is not truncated.
+func TestSingleFileLogIsKept(t *testing.T) {
+	blockSize := 64
+	fm := newTestFileMgr(t, file.NewMemStorage(), blockSize)
+
+	// Write a log of three blocks the way it was laid out without segments.
+	lf := singleLogFile(fm, "logfile-single")
+	page := file.NewPage(blockSize)
+	for blknum := 0; blknum < 3; blknum++ {
+		if err := appendNewBlock(lf, blknum, page); err != nil {
+			t.Fatalf("Failed to append log block: %v", err)
+		}
+		pos := blockSize - fragHeaderSize - len("record00")
+		writeLogRecord(page, pos, []byte(fmt.Sprintf("record%02d", blknum)))
+		page.SetInt(0, int32(pos))
+		if err := fm.Write(lf.block(blknum), page.Contents()); err != nil {
+			t.Fatalf("Failed to write log block: %v", err)
+		}
+	}
+
+	logMgr := newTestLogMgrWithOptions(t, fm, "logfile-single", Options{SegmentBlocks: 1})
+	expectRecordsFrom(t, logMgr, 0, 3)
+	if err := logMgr.Truncate(logMgr.LatestLSN()); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	expectRecordsFrom(t, logMgr, 0, 3)
+	if n, err := fm.Length("logfile-single"); err != nil || n != 3 {
+		t.Fatalf("Expected the single log file to keep 3 blocks, got %d (err %v)", n, err)
+	}
+}
@@ -0,0 +1,127 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+
+	"database_design_and_implementation/internal/file"
+)
+
+// A crash in the middle of a write can leave the tail of the log holding
+// records that were only partly written, or the first fragments of a record
+// whose end never reached the disk. When a log is opened its tail is checked
+// and cut back to the last complete record, so that recovery never reads a
+// torn record.
+//
+// Records are stored from the end of a block towards its boundary, so the
+// oldest records of the tail block are the ones that were already on disk
+// before the last write. The tail is cut at the lowest offset from which the
+// records of the block pass their CRC checks all the way to its end.
+
+// repairTail checks the tail of a log whose blocks run from first to
+// length-1 and cuts it back to the last complete record. It leaves the tail
+// block in p and returns its number with its new boundary and the number of
+// bytes that were discarded. A read-only log is checked but not changed on
+// disk.
+func repairTail(lf *logFile, first, length int, p *file.Page) (int, int, int, error) {
+	fm := lf.fm
+	blockSize := fm.BlockSize()
+	discarded := 0
+	rewrite := false
+
+	var blknum, boundary int
+	for blknum = length - 1; ; blknum-- {
+		blk := lf.block(blknum)
+		stored, torn, err := readTailBlock(fm, blk, p)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		rewrite = rewrite || torn
+		boundary = validSuffix(p, blk, stored)
+		discarded += boundary - stored
+
+		// Drop the fragments of a record whose end is missing. The first
+		// fragment of a record is the newest one in its block.
+		removedFirst := false
+		for boundary < blockSize && !removedFirst {
+			kind, data, err := readFragment(p, boundary, blk)
+			if err != nil {
+				return 0, 0, 0, err
+			}
+			if kind == fragFull || kind == fragLast {
+				break
+			}
+			boundary += fragHeaderSize + len(data)
+			discarded += fragHeaderSize + len(data)
+			removedFirst = kind == fragFirst
+		}
+
+		if boundary < blockSize || removedFirst || blknum == first {
+			break
+		}
+	}
+
+	if discarded == 0 && !rewrite && blknum == length-1 {
+		return blknum, boundary, 0, nil
+	}
+	if fm.ReadOnly() {
+		return blknum, boundary, discarded, nil
+	}
+
+	// Clear what was cut off, so that nothing past the boundary looks like a record.
+	blk := lf.block(blknum)
+	clear(p.Contents()[file.IntSize:boundary])
+	if err := p.SetInt(0, int32(boundary)); err != nil {
+		return 0, 0, 0, err
+	}
+	if err := fm.Write(blk, p.Contents()); err != nil {
+		return 0, 0, 0, fmt.Errorf("%w: write log block %s: %w", ErrWriteFailed, blk, err)
+	}
+	if err := lf.truncate(blknum + 1); err != nil {
+		return 0, 0, 0, err
+	}
+	if err := fm.Sync(blk.Filename); err != nil {
+		return 0, 0, 0, err
+	}
+	return blknum, boundary, discarded, nil
+}
+
+// readTailBlock reads a log block that may have been torn and returns its
+// boundary, or the lowest possible boundary if the stored one is invalid. A
+// block whose checksum does not match is still read, and reported as torn.
+func readTailBlock(fm *file.FileMgr, blk file.BlockId, p *file.Page) (int, bool, error) {
+	torn := false
+	if err := fm.Read(blk, p.Contents()); err != nil {
+		if !errors.Is(err, file.ErrChecksumMismatch) {
+			return 0, false, fmt.Errorf("%w: read log block %s: %w", ErrReadFailed, blk, err)
+		}
+		torn = true
+	}
+
+	boundary, err := blockBoundary(p, blk)
+	if err != nil {
+		// The boundary was torn, so every offset may hold a record.
+		return file.IntSize, true, nil
+	}
+	return boundary, torn, nil
+}
+
+// validSuffix returns the lowest offset at or above boundary from which the
+// records of a log block pass their CRC checks up to the end of the block.
+func validSuffix(p *file.Page, blk file.BlockId, boundary int) int {
+	blockSize := len(p.Contents())
+	for start := boundary; start < blockSize; start++ {
+		pos := start
+		for pos < blockSize {
+			_, data, err := readFragment(p, pos, blk)
+			if err != nil {
+				break
+			}
+			pos += fragHeaderSize + len(data)
+		}
+		if pos == blockSize {
+			return start
+		}
+	}
+	return blockSize
+}
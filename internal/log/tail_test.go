@@ -0,0 +1,303 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"database_design_and_implementation/internal/file"
+	"database_design_and_implementation/internal/file/faultfs"
+)
+
+// writeLog appends numbered records to a log, flushes it, and returns their LSNs.
+func writeLog(t *testing.T, fm *file.FileMgr, logfile string, n int) []int {
+	t.Helper()
+	logMgr := newTestLogMgr(t, fm, logfile)
+	lsns := make([]int, n)
+	for i := range lsns {
+		lsn, err := logMgr.Append([]byte(fmt.Sprintf("record%02d", i)))
+		if err != nil {
+			t.Fatalf("Failed to append log record: %v", err)
+		}
+		lsns[i] = lsn
+	}
+	if err := logMgr.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	return lsns
+}
+
+// overwrite changes bytes of a file behind the FileMgr's back.
+func overwrite(t *testing.T, st file.Storage, name string, off int, b []byte) {
+	t.Helper()
+	f, err := st.Open(name)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", name, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt(b, int64(off)); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+}
+
+// expectRecords checks that the log holds exactly records 0 to n-1, newest first.
+func expectRecords(t *testing.T, logMgr *LogMgr, n int) {
+	t.Helper()
+	iter, err := logMgr.Iterator()
+	if err != nil {
+		t.Fatalf("Failed to create LogIterator: %v", err)
+	}
+	for i := n - 1; i >= 0; i-- {
+		rec, err := iter.Next()
+		if err != nil {
+			t.Fatalf("Failed to read record %d: %v", i, err)
+		}
+		if want := fmt.Sprintf("record%02d", i); string(rec) != want {
+			t.Fatalf("Mismatch: expected %s, but got %s", want, rec)
+		}
+	}
+	if iter.HasNext() {
+		t.Fatalf("Expected no more records after record 0")
+	}
+}
+
+// TestTornTailIsDiscarded tests that records failing their CRC are cut from
+// the tail of the log when it is reopened.
+func TestTornTailIsDiscarded(t *testing.T) {
+	blockSize := 64
+	recSize := fragHeaderSize + len("record00")
+
+	tests := []struct {
+		name      string
+		checksums bool
+		// corrupt damages the tail block, which starts at off in file name.
+		corrupt   func(t *testing.T, st file.Storage, name string, off, boundary int)
+		discarded int
+		remaining int
+	}{
+		{
+			name: "Torn newest record",
+			corrupt: func(t *testing.T, st file.Storage, name string, off, boundary int) {
+				overwrite(t, st, name, off+boundary+fragHeaderSize+3, []byte{'X'})
+			},
+			discarded: recSize,
+			remaining: 10,
+		},
+		{
+			name: "Torn record under a newer one",
+			corrupt: func(t *testing.T, st file.Storage, name string, off, boundary int) {
+				overwrite(t, st, name, off+boundary+recSize+fragHeaderSize, []byte{'X'})
+			},
+			discarded: 2 * recSize,
+			remaining: 9,
+		},
+		{
+			name: "Invalid boundary",
+			corrupt: func(t *testing.T, st file.Storage, name string, off, boundary int) {
+				overwrite(t, st, name, off, []byte{0, 0, 0, 2})
+			},
+			discarded: blockSize - 2*recSize - file.IntSize,
+			remaining: 11,
+		},
+		{
+			name:      "Torn block with checksums",
+			checksums: true,
+			corrupt: func(t *testing.T, st file.Storage, name string, off, boundary int) {
+				overwrite(t, st, name, off+boundary+fragHeaderSize, []byte{'X'})
+			},
+			discarded: recSize,
+			remaining: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := file.NewMemStorage()
+			open := func() *file.FileMgr {
+				fm, err := file.NewFileMgrWithOptions("testdb", blockSize, file.Options{Storage: st, Checksums: tt.checksums})
+				if err != nil {
+					t.Fatalf("Failed to create FileMgr: %v", err)
+				}
+				return fm
+			}
+			fm := open()
+			lsns := writeLog(t, fm, "logfile-torn", 11)
+
+			tail, boundary, err := newTestLogMgr(t, fm, "logfile-torn").Locate(lsns[10])
+			if err != nil {
+				t.Fatalf("Locate failed: %v", err)
+			}
+			tt.corrupt(t, st, tail.Filename, tail.Blknum*blockSize, boundary)
+
+			logMgr := newTestLogMgr(t, open(), "logfile-torn")
+			if got := logMgr.DiscardedBytes(); got != tt.discarded {
+				t.Fatalf("Expected %d discarded bytes, got %d", tt.discarded, got)
+			}
+			expectRecords(t, logMgr, tt.remaining)
+			if tt.remaining > 0 && logMgr.LatestLSN() != lsns[tt.remaining-1] {
+				t.Fatalf("Expected latest LSN %d, got %d", lsns[tt.remaining-1], logMgr.LatestLSN())
+			}
+
+			// The log keeps working, and the repair is on disk.
+			if _, err := logMgr.Append([]byte("after")); err != nil {
+				t.Fatalf("Failed to append after repair: %v", err)
+			}
+			if err := logMgr.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+			if got := newTestLogMgr(t, open(), "logfile-torn").DiscardedBytes(); got != 0 {
+				t.Fatalf("Expected a repaired log to reopen cleanly, %d bytes were discarded", got)
+			}
+		})
+	}
+}
+
+// TestUnfinishedRecordIsDiscarded tests that a record split across blocks is
+// cut whole when the block holding its end was lost in a crash.
+func TestUnfinishedRecordIsDiscarded(t *testing.T) {
+	blockSize := 64
+	fs, err := faultfs.New(file.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create fault storage: %v", err)
+	}
+	fm, err := file.NewFileMgrWithOptions("testdb", blockSize, file.Options{Storage: fs})
+	if err != nil {
+		t.Fatalf("Failed to create FileMgr: %v", err)
+	}
+
+	logMgr := newTestLogMgr(t, fm, "logfile-unfinished")
+	for i := 0; i < 3; i++ {
+		if _, err := logMgr.Append([]byte(fmt.Sprintf("record%02d", i))); err != nil {
+			t.Fatalf("Failed to append log record: %v", err)
+		}
+	}
+	// Moving to a new block flushes the blocks holding the start of the
+	// record, but the block holding its end is never flushed.
+	big := bytes.Repeat([]byte("x"), 5*blockSize)
+	if _, err := logMgr.Append(big); err != nil {
+		t.Fatalf("Failed to append log record: %v", err)
+	}
+
+	st, err := fs.Crash()
+	if err != nil {
+		t.Fatalf("Crash failed: %v", err)
+	}
+	fm, err = file.NewFileMgrWithOptions("testdb", blockSize, file.Options{Storage: st})
+	if err != nil {
+		t.Fatalf("Failed to reopen FileMgr: %v", err)
+	}
+	logMgr = newTestLogMgr(t, fm, "logfile-unfinished")
+	if logMgr.DiscardedBytes() == 0 {
+		t.Fatalf("Expected the start of the unfinished record to be discarded")
+	}
+	expectRecords(t, logMgr, 3)
+
+	if _, err := logMgr.ForwardIterator(0); err != nil {
+		t.Fatalf("Failed to create ForwardLogIterator after repair: %v", err)
+	}
+	logsize, err := fm.Length(SegmentName("logfile-unfinished", 0))
+	if err != nil {
+		t.Fatalf("Failed to get log length: %v", err)
+	}
+	if logsize != 1 {
+		t.Fatalf("Expected the blocks of the unfinished record to be truncated, the log has %d blocks", logsize)
+	}
+}
+
+// TestReadOnlyLogIsNotRepaired tests that opening a read-only log reports
+// the torn tail without changing it, and reads the records before it.
+func TestReadOnlyLogIsNotRepaired(t *testing.T) {
+	blockSize := 64
+	st := file.NewMemStorage()
+	fm := newTestFileMgr(t, st, blockSize)
+	lsns := writeLog(t, fm, "logfile-readonly", 3)
+	blk, boundary, err := newTestLogMgr(t, fm, "logfile-readonly").Locate(lsns[2])
+	if err != nil {
+		t.Fatalf("Locate failed: %v", err)
+	}
+	overwrite(t, st, blk.Filename, blk.Blknum*blockSize+boundary+fragHeaderSize, []byte{'X'})
+
+	for i := 0; i < 2; i++ {
+		ro, err := file.NewFileMgrWithOptions("testdb", blockSize, file.Options{Storage: st, ReadOnly: true})
+		if err != nil {
+			t.Fatalf("Failed to open read-only FileMgr: %v", err)
+		}
+		logMgr := newTestLogMgr(t, ro, "logfile-readonly")
+		if got := logMgr.DiscardedBytes(); got == 0 {
+			t.Fatalf("Expected the torn record to be reported on open %d", i+1)
+		}
+		expectRecords(t, logMgr, 2)
+		if _, err := logMgr.Append([]byte("record02")); !errors.Is(err, file.ErrReadOnly) {
+			t.Fatalf("Expected ErrReadOnly from Append, got %v", err)
+		}
+
+		missing := newTestLogMgr(t, ro, "logfile-missing")
+		if iter, err := missing.Iterator(); err != nil || iter.HasNext() {
+			t.Fatalf("Expected a missing read-only log to be empty (err %v)", err)
+		}
+	}
+}
+
+// TestLegacyLogIsRefused tests that a log written before records had a CRC,
+// in a database without a superblock, is refused rather than cut back as a
+// torn tail.
+func TestLegacyLogIsRefused(t *testing.T) {
+	blockSize := 400
+	st := file.NewMemStorage()
+
+	// Lay out 50 records the way the log stored them before they were
+	// framed: [len][data], from the end of each block towards its boundary.
+	var image []byte
+	block := make([]byte, blockSize)
+	page := file.NewPageFromBytes(block)
+	boundary := blockSize
+	for i := 0; i < 50; i++ {
+		rec := []byte(fmt.Sprintf("record%02d", i))
+		if boundary-file.IntSize-len(rec) < file.IntSize {
+			image = append(image, block...)
+			block = make([]byte, blockSize)
+			page = file.NewPageFromBytes(block)
+			boundary = blockSize
+		}
+		boundary -= file.IntSize + len(rec)
+		if err := page.SetBytes(boundary, rec); err != nil {
+			t.Fatalf("Failed to lay out record: %v", err)
+		}
+		if err := page.SetInt(0, int32(boundary)); err != nil {
+			t.Fatalf("Failed to set boundary: %v", err)
+		}
+	}
+	image = append(image, block...)
+	f, err := st.Open("logfile-legacy")
+	if err != nil {
+		t.Fatalf("Failed to create log file: %v", err)
+	}
+	if _, err := f.WriteAt(image, 0); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+
+	for _, readOnly := range []bool{false, true} {
+		fm, err := file.NewFileMgrWithOptions("testdb", blockSize, file.Options{Storage: st, ReadOnly: readOnly})
+		if err != nil {
+			t.Fatalf("Failed to open the legacy database: %v", err)
+		}
+		if v := fm.Superblock().FormatVersion; v != file.LegacyFormatVersion {
+			t.Fatalf("Expected the legacy format version, got %d", v)
+		}
+		if _, err := NewLogMgr(fm, "logfile-legacy"); !errors.Is(err, file.ErrIncompatibleDatabase) {
+			t.Fatalf("Expected the legacy log to be refused, got %v", err)
+		}
+		if err := fm.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	}
+
+	got := make([]byte, len(image))
+	if n, err := f.ReadAt(got, 0); n != len(image) || !bytes.Equal(got, image) {
+		t.Fatalf("Expected the legacy log to be left as it was, read %d of %d bytes (err %v)", n, len(image), err)
+	}
+	if size, err := f.Size(); err != nil || size != int64(len(image)) {
+		t.Fatalf("Expected the legacy log to keep %d bytes, got %d (err %v)", len(image), size, err)
+	}
+}
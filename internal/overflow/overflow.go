@@ -0,0 +1,306 @@
+// Package overflow stores values that are too large for a block in chains of
+// linked overflow blocks.
+//
+// Every block of an overflow file holds a flag that is set while the block is
+// part of a chain, the number of the next block in the chain, or -1 at the
+// end, and a length-prefixed piece of the value:
+//
+//	[used int32][next int32][len int32][data]
+//
+// Free blocks are found through the free-space map of the file. The map is a
+// hint, so the used flag of a block is checked before the block is taken.
+// The page that owns the value stores a Pointer to its chain instead.
+package overflow
+
+import (
+	"errors"
+	"fmt"
+
+	"database_design_and_implementation/internal/buffer"
+	"database_design_and_implementation/internal/file"
+	"database_design_and_implementation/internal/log"
+	"database_design_and_implementation/internal/tx/recovery"
+)
+
+// PointerSize is the number of bytes a Pointer takes in a page.
+const PointerSize = 2 * file.IntSize
+
+// Offsets of the fields of an overflow block.
+const (
+	usedOffset = 0
+	nextOffset = file.IntSize
+	dataOffset = 2 * file.IntSize
+)
+
+// noBlock ends a chain.
+const noBlock = -1
+
+// ErrCorruptChain is returned when a chain does not match its Pointer.
+var ErrCorruptChain = errors.New("corrupt overflow chain")
+
+// Pointer locates a value stored in an overflow file.
+type Pointer struct {
+	// First is the first block of the chain, or -1 for an empty value.
+	First int
+	// Length is the length of the value in bytes.
+	Length int
+}
+
+// String returns a string representation of the Pointer.
+func (p Pointer) String() string {
+	return fmt.Sprintf("[overflow block %d, length %d]", p.First, p.Length)
+}
+
+// GetPointer reads a Pointer stored at an offset of a page.
+func GetPointer(p *file.Page, offset int) (Pointer, error) {
+	first, err := p.GetInt(offset)
+	if err != nil {
+		return Pointer{}, err
+	}
+	length, err := p.GetInt(offset + file.IntSize)
+	if err != nil {
+		return Pointer{}, err
+	}
+	return Pointer{First: int(first), Length: int(length)}, nil
+}
+
+// SetPointer stores a Pointer at an offset of a page. Logging the change is
+// left to the owner of the page.
+func SetPointer(p *file.Page, offset int, ptr Pointer) error {
+	if offset+PointerSize > len(p.Contents()) {
+		return fmt.Errorf("pointer at offset %d does not fit in the page", offset)
+	}
+	if err := p.SetInt(offset, int32(ptr.First)); err != nil {
+		return err
+	}
+	return p.SetInt(offset+file.IntSize, int32(ptr.Length))
+}
+
+// File is an overflow file. Its blocks are read and written through a buffer
+// manager on behalf of a transaction, given by its number. Setting and
+// clearing the used flag of a block is logged, so that undoing a transaction
+// frees the chains it wrote and restores the ones it freed; the rest of a
+// block only matters while the block is used, and is not logged.
+//
+// There must be only one File per overflow file, as for its free-space map.
+type File struct {
+	lm       *log.LogMgr
+	bm       *buffer.BufferMgr
+	fsm      *file.FreeSpaceMap
+	filename string
+	blksize  int
+}
+
+// NewFile returns the overflow file with the given name. The file is created
+// on the first Write.
+func NewFile(fm *file.FileMgr, lm *log.LogMgr, bm *buffer.BufferMgr, filename string) *File {
+	return &File{
+		lm:       lm,
+		bm:       bm,
+		fsm:      file.NewFreeSpaceMap(fm, filename),
+		filename: filename,
+		blksize:  fm.BlockSize(),
+	}
+}
+
+// Filename returns the name of the overflow file.
+func (f *File) Filename() string {
+	return f.filename
+}
+
+// Capacity returns the number of value bytes a block of the file holds.
+func (f *File) Capacity() int {
+	return f.blksize - dataOffset - file.IntSize
+}
+
+// Write stores a value in a new chain for transaction txnum and returns a
+// Pointer to it. Free blocks are used before the file grows.
+func (f *File) Write(txnum int, value []byte) (Pointer, error) {
+	capacity := f.Capacity()
+	if capacity <= 0 {
+		return Pointer{}, fmt.Errorf("block size %d is too small for overflow blocks", f.blksize)
+	}
+
+	n := (len(value) + capacity - 1) / capacity
+	blocks := make([]file.BlockId, n)
+	for i := range blocks {
+		blk, err := f.allocate()
+		if err != nil {
+			return Pointer{}, err
+		}
+		blocks[i] = blk
+	}
+
+	ptr := Pointer{First: noBlock, Length: len(value)}
+	for i, blk := range blocks {
+		next := noBlock
+		if i+1 < n {
+			next = blocks[i+1].Blknum
+		}
+		start := i * capacity
+		end := min(start+capacity, len(value))
+		if err := f.writeBlock(txnum, blk, next, value[start:end]); err != nil {
+			return Pointer{}, err
+		}
+	}
+	if n > 0 {
+		ptr.First = blocks[0].Blknum
+	}
+	return ptr, nil
+}
+
+// Read returns the value a Pointer refers to.
+func (f *File) Read(ptr Pointer) ([]byte, error) {
+	value := make([]byte, 0, ptr.Length)
+	err := f.walk(ptr, func(blk file.BlockId, p *file.Page) error {
+		data, err := p.GetBytes(dataOffset)
+		if err != nil {
+			return err
+		}
+		value = append(value, data...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(value) != ptr.Length {
+		return nil, fmt.Errorf("%w: %s holds %d bytes", ErrCorruptChain, ptr, len(value))
+	}
+	return value, nil
+}
+
+// Free releases the blocks of a chain for transaction txnum, so that later
+// writes can reuse them.
+func (f *File) Free(txnum int, ptr Pointer) error {
+	var blocks []file.BlockId
+	err := f.walk(ptr, func(blk file.BlockId, p *file.Page) error {
+		blocks = append(blocks, blk)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, blk := range blocks {
+		if err := f.setUsed(txnum, blk, false); err != nil {
+			return err
+		}
+		if err := f.fsm.Free(blk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walk calls fn with every block of a chain, in order, while it is pinned. It
+// stops with ErrCorruptChain if the chain is longer than the Pointer allows
+// or runs into a free block.
+func (f *File) walk(ptr Pointer, fn func(blk file.BlockId, p *file.Page) error) error {
+	if ptr.Length < 0 || (ptr.Length == 0) != (ptr.First == noBlock) {
+		return fmt.Errorf("%w: invalid pointer %s", ErrCorruptChain, ptr)
+	}
+	capacity := f.Capacity()
+	maxBlocks := (ptr.Length + capacity - 1) / capacity
+	blknum := ptr.First
+	for n := 0; blknum != noBlock; n++ {
+		if n == maxBlocks || blknum < 0 {
+			return fmt.Errorf("%w: %s runs past block %d", ErrCorruptChain, ptr, blknum)
+		}
+		blk := file.NewBlockId(f.filename, blknum)
+		next, err := f.withBlock(blk, func(p *file.Page) (int, error) {
+			used, err := p.GetInt(usedOffset)
+			if err != nil {
+				return 0, err
+			}
+			if used == 0 {
+				return 0, fmt.Errorf("%w: %s runs into free block %d", ErrCorruptChain, ptr, blknum)
+			}
+			if err := fn(blk, p); err != nil {
+				return 0, err
+			}
+			next, err := p.GetInt(nextOffset)
+			return int(next), err
+		})
+		if err != nil {
+			return err
+		}
+		blknum = next
+	}
+	return nil
+}
+
+// allocate takes a free block from the free-space map, or appends one if
+// there is none. A block the map wrongly records as free, such as one whose
+// Free was undone, is recorded as full and passed over.
+func (f *File) allocate() (file.BlockId, error) {
+	for {
+		blk, err := f.fsm.Allocate(f.blksize)
+		if err != nil {
+			return file.BlockId{}, err
+		}
+		used, err := f.withBlock(blk, func(p *file.Page) (int, error) {
+			used, err := p.GetInt(usedOffset)
+			return int(used), err
+		})
+		if err != nil || used == 0 {
+			return blk, err
+		}
+	}
+}
+
+// writeBlock marks a block used and writes its next pointer and its data.
+func (f *File) writeBlock(txnum int, blk file.BlockId, next int, data []byte) error {
+	if err := f.setUsed(txnum, blk, true); err != nil {
+		return err
+	}
+	buff, err := f.bm.Pin(&blk)
+	if err != nil {
+		return err
+	}
+	defer f.bm.Unpin(buff)
+	p := buff.Contents()
+	if err := p.SetInt(nextOffset, int32(next)); err != nil {
+		return err
+	}
+	if err := p.SetBytes(dataOffset, data); err != nil {
+		return err
+	}
+	buff.SetModified(txnum, -1)
+	return nil
+}
+
+// setUsed sets or clears the used flag of a block and logs the change.
+func (f *File) setUsed(txnum int, blk file.BlockId, used bool) error {
+	buff, err := f.bm.Pin(&blk)
+	if err != nil {
+		return err
+	}
+	defer f.bm.Unpin(buff)
+	p := buff.Contents()
+	old, err := p.GetInt(usedOffset)
+	if err != nil {
+		return err
+	}
+	val := 0
+	if used {
+		val = 1
+	}
+	lsn, err := recovery.WriteSetIntToLog(f.lm, txnum, blk, usedOffset, int(old), val)
+	if err != nil {
+		return err
+	}
+	if err := p.SetInt(usedOffset, int32(val)); err != nil {
+		return err
+	}
+	buff.SetModified(txnum, lsn)
+	return nil
+}
+
+// withBlock calls fn with the page of a block while the block is pinned.
+func (f *File) withBlock(blk file.BlockId, fn func(p *file.Page) (int, error)) (int, error) {
+	buff, err := f.bm.Pin(&blk)
+	if err != nil {
+		return 0, err
+	}
+	defer f.bm.Unpin(buff)
+	return fn(buff.Contents())
+}
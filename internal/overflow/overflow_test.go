@@ -0,0 +1,240 @@
+package overflow
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"database_design_and_implementation/internal/buffer"
+	"database_design_and_implementation/internal/file"
+	"database_design_and_implementation/internal/log"
+	"database_design_and_implementation/internal/tx/recovery"
+)
+
+// numBuffers is the size of the buffer pool of the tests.
+const numBuffers = 8
+
+// newTestFile creates an overflow file on a fresh in-memory database and
+// returns it with the managers it uses.
+func newTestFile(t *testing.T, blockSize int) (*File, *file.FileMgr, *log.LogMgr, *buffer.BufferMgr) {
+	t.Helper()
+	fm, err := file.NewFileMgrWithOptions("testdb", blockSize, file.Options{Storage: file.NewMemStorage()})
+	if err != nil {
+		t.Fatalf("Failed to create FileMgr: %v", err)
+	}
+	lm, err := log.NewLogMgr(fm, "logfile-overflow")
+	if err != nil {
+		t.Fatalf("Failed to create LogMgr: %v", err)
+	}
+	bm := buffer.NewBufferMgr(fm, lm, numBuffers)
+	return NewFile(fm, lm, bm, "blobs"), fm, lm, bm
+}
+
+// value returns n bytes of test data.
+func value(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}
+
+// TestOverflowRoundTrip tests writing and reading values of several sizes.
+func TestOverflowRoundTrip(t *testing.T) {
+	f, _, _, bm := newTestFile(t, 64)
+	capacity := f.Capacity()
+
+	for _, n := range []int{0, 1, capacity, capacity + 1, 10 * capacity, 1000} {
+		v := value(n)
+		ptr, err := f.Write(1, v)
+		if err != nil {
+			t.Fatalf("Write of %d bytes failed: %v", n, err)
+		}
+		if ptr.Length != n {
+			t.Fatalf("Expected a pointer to %d bytes, got %s", n, ptr)
+		}
+		got, err := f.Read(ptr)
+		if err != nil {
+			t.Fatalf("Read of %s failed: %v", ptr, err)
+		}
+		if !bytes.Equal(got, v) {
+			t.Fatalf("Value of %d bytes did not round trip", n)
+		}
+	}
+
+	if n := bm.Available(); n != numBuffers {
+		t.Errorf("Expected every buffer to be unpinned, %d of %d are available", n, numBuffers)
+	}
+}
+
+// TestOverflowPointer tests storing a pointer in a home page.
+func TestOverflowPointer(t *testing.T) {
+	f, _, _, _ := newTestFile(t, 64)
+	ptr, err := f.Write(1, value(200))
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	home := file.NewPage(64)
+	if err := SetPointer(home, 8, ptr); err != nil {
+		t.Fatalf("SetPointer failed: %v", err)
+	}
+	got, err := GetPointer(home, 8)
+	if err != nil || got != ptr {
+		t.Fatalf("Expected pointer %s, got %s (err %v)", ptr, got, err)
+	}
+	if err := SetPointer(home, 64-PointerSize+1, ptr); err == nil {
+		t.Fatalf("Expected an error for a pointer past the end of the page")
+	}
+}
+
+// TestOverflowFreeReusesBlocks tests that freed chains are reused before the
+// file grows.
+func TestOverflowFreeReusesBlocks(t *testing.T) {
+	f, fm, _, _ := newTestFile(t, 64)
+	capacity := f.Capacity()
+
+	first, err := f.Write(1, value(5*capacity))
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	kept, err := f.Write(1, value(2*capacity))
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	size, err := fm.Length(f.Filename())
+	if err != nil {
+		t.Fatalf("Length failed: %v", err)
+	}
+	if size != 5+2 {
+		t.Fatalf("Expected 7 chain blocks, got %d blocks", size)
+	}
+
+	if err := f.Free(1, first); err != nil {
+		t.Fatalf("Free failed: %v", err)
+	}
+	reused, err := f.Write(1, value(4*capacity))
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if after, _ := fm.Length(f.Filename()); after != size {
+		t.Fatalf("Expected freed blocks to be reused, but the file grew from %d to %d blocks", size, after)
+	}
+
+	for _, ptr := range []Pointer{kept, reused} {
+		got, err := f.Read(ptr)
+		if err != nil || !bytes.Equal(got, value(ptr.Length)) {
+			t.Fatalf("Value at %s was damaged (err %v)", ptr, err)
+		}
+	}
+
+	// One freed block is left, then the file grows again.
+	if _, err := f.Write(1, value(2*capacity)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if after, _ := fm.Length(f.Filename()); after != size+1 {
+		t.Fatalf("Expected the file to grow by one block, got %d blocks", after)
+	}
+}
+
+// TestOverflowSkipsUsedBlocks tests that a block the free-space map records
+// as free is not reused while a chain still holds it, as after a Free that
+// was undone.
+func TestOverflowSkipsUsedBlocks(t *testing.T) {
+	f, fm, _, _ := newTestFile(t, 64)
+	capacity := f.Capacity()
+
+	ptr, err := f.Write(1, value(3*capacity))
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := file.NewFreeSpaceMap(fm, f.Filename()).Free(file.NewBlockId(f.Filename(), ptr.First)); err != nil {
+		t.Fatalf("Failed to mark the block free: %v", err)
+	}
+	other, err := f.Write(1, value(capacity))
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if other.First == ptr.First {
+		t.Fatalf("Expected block %d of a chain not to be reused", ptr.First)
+	}
+	if got, err := f.Read(ptr); err != nil || !bytes.Equal(got, value(ptr.Length)) {
+		t.Fatalf("Value at %s was damaged (err %v)", ptr, err)
+	}
+}
+
+// TestOverflowLogsUsedFlags tests that taking and freeing blocks is logged by
+// the transaction that does it, so that it can be undone.
+func TestOverflowLogsUsedFlags(t *testing.T) {
+	f, _, lm, _ := newTestFile(t, 64)
+
+	ptr, err := f.Write(7, value(2*f.Capacity()))
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := f.Free(8, ptr); err != nil {
+		t.Fatalf("Free failed: %v", err)
+	}
+
+	iter, err := lm.Iterator()
+	if err != nil {
+		t.Fatalf("Failed to create LogIterator: %v", err)
+	}
+	// change is a change of a used flag, as logged.
+	type change struct{ txnum, oldval, newval int }
+	var changes []change
+	for iter.HasNext() {
+		rec, err := iter.Next()
+		if err != nil {
+			t.Fatalf("Failed to read log record: %v", err)
+		}
+		lr, err := recovery.CreateLogRecord(rec)
+		if err != nil {
+			t.Fatalf("Failed to decode log record: %v", err)
+		}
+		set, ok := lr.(*recovery.SetIntRecord)
+		if !ok || set.Block().Filename != f.Filename() || set.Offset() != usedOffset {
+			t.Fatalf("Unexpected log record %v", lr)
+		}
+		// The iterator reads the log backwards.
+		changes = append([]change{{set.TxNumber(), set.OldValue(), set.NewValue()}}, changes...)
+	}
+	want := []change{{7, 0, 1}, {7, 0, 1}, {8, 1, 0}, {8, 1, 0}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("Expected the used flag changes %v, got %v", want, changes)
+	}
+}
+
+// TestOverflowCorruptChain tests that a chain that does not match its pointer
+// is rejected.
+func TestOverflowCorruptChain(t *testing.T) {
+	f, _, _, _ := newTestFile(t, 64)
+	capacity := f.Capacity()
+
+	ptr, err := f.Write(1, value(3*capacity))
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	freed, err := f.Write(1, value(capacity))
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := f.Free(1, freed); err != nil {
+		t.Fatalf("Free failed: %v", err)
+	}
+
+	for _, bad := range []Pointer{
+		{First: ptr.First, Length: ptr.Length - capacity},
+		{First: ptr.First, Length: ptr.Length + 1},
+		{First: noBlock, Length: 10},
+		freed,
+	} {
+		if _, err := f.Read(bad); !errors.Is(err, ErrCorruptChain) {
+			t.Errorf("Expected ErrCorruptChain reading %s, got %v", bad, err)
+		}
+	}
+	if err := f.Free(1, Pointer{First: ptr.First, Length: 1}); !errors.Is(err, ErrCorruptChain) {
+		t.Errorf("Expected ErrCorruptChain freeing a chain with a short pointer, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"database_design_and_implementation/internal/buffer"
+	"database_design_and_implementation/internal/file"
+	"database_design_and_implementation/internal/log"
+)
+
+// Default configuration of a database.
+const (
+	BlockSize  = 400
+	BufferSize = 8
+	LogFile    = "simpledb.log"
+)
+
+// SimpleDB wires together the managers of a database and shuts them down in
+// the right order.
+type SimpleDB struct {
+	fm *file.FileMgr
+	lm *log.LogMgr
+	bm *buffer.BufferMgr
+}
+
+// NewSimpleDB opens the database in the given directory, creating it if needed.
+func NewSimpleDB(dirname string, blockSize, buffSize int) (*SimpleDB, error) {
+	return NewSimpleDBWithOptions(dirname, blockSize, buffSize, file.Options{})
+}
+
+// NewSimpleDBWithOptions opens the database in the given directory with the
+// given file manager options.
+func NewSimpleDBWithOptions(dirname string, blockSize, buffSize int, opts file.Options) (*SimpleDB, error) {
+	fm, err := file.NewFileMgrWithOptions(dirname, blockSize, opts)
+	if err != nil {
+		return nil, err
+	}
+	lm, err := log.NewLogMgr(fm, LogFile)
+	if err != nil {
+		return nil, errors.Join(err, fm.Close())
+	}
+	bm := buffer.NewBufferMgr(fm, lm, buffSize)
+	return &SimpleDB{fm: fm, lm: lm, bm: bm}, nil
+}
+
+// FileMgr returns the file manager of the database.
+func (db *SimpleDB) FileMgr() *file.FileMgr {
+	return db.fm
+}
+
+// LogMgr returns the log manager of the database.
+func (db *SimpleDB) LogMgr() *log.LogMgr {
+	return db.lm
+}
+
+// BufferMgr returns the buffer manager of the database.
+func (db *SimpleDB) BufferMgr() *buffer.BufferMgr {
+	return db.bm
+}
+
+// Close shuts the database down. The log is flushed first, then the dirty
+// buffers, and finally the files are closed. If the log or the buffers cannot
+// be flushed, Close stops there and leaves the files open and the database
+// locked, so that it can be retried; a manager closed by an earlier attempt
+// is not closed again.
+func (db *SimpleDB) Close() error {
+	if err := db.lm.Close(); err != nil && !errors.Is(err, log.ErrClosed) {
+		return fmt.Errorf("close database: %w", err)
+	}
+	if err := db.bm.Close(); err != nil && !errors.Is(err, buffer.ErrClosed) {
+		return fmt.Errorf("close database: %w", err)
+	}
+	return db.fm.Close()
+}
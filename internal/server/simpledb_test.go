@@ -0,0 +1,123 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"database_design_and_implementation/internal/buffer"
+	"database_design_and_implementation/internal/file"
+	"database_design_and_implementation/internal/file/faultfs"
+	"database_design_and_implementation/internal/log"
+)
+
+// TestSimpleDBClose tests that Close flushes the log and dirty buffers before closing the files.
+func TestSimpleDBClose(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewSimpleDB(dir, BlockSize, BufferSize)
+	if err != nil {
+		t.Fatalf("Failed to create SimpleDB: %v", err)
+	}
+
+	lsn, err := db.LogMgr().Append([]byte("update"))
+	if err != nil {
+		t.Fatalf("Failed to append log record: %v", err)
+	}
+
+	blk, err := db.FileMgr().Append("datafile")
+	if err != nil {
+		t.Fatalf("Failed to append block: %v", err)
+	}
+	buff, err := db.BufferMgr().Pin(&blk)
+	if err != nil {
+		t.Fatalf("Failed to pin block: %v", err)
+	}
+	if err := buff.Contents().SetInt(0, 42); err != nil {
+		t.Fatalf("Failed to write data to page: %v", err)
+	}
+	buff.SetModified(1, lsn)
+	db.BufferMgr().Unpin(buff)
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if _, err := db.LogMgr().Append([]byte("too late")); !errors.Is(err, log.ErrClosed) {
+		t.Fatalf("Expected log.ErrClosed, got %v", err)
+	}
+	if _, err := db.BufferMgr().Pin(&blk); !errors.Is(err, buffer.ErrClosed) {
+		t.Fatalf("Expected buffer.ErrClosed, got %v", err)
+	}
+	if _, err := db.FileMgr().Length("datafile"); !errors.Is(err, file.ErrClosed) {
+		t.Fatalf("Expected file.ErrClosed, got %v", err)
+	}
+	if err := db.Close(); err == nil {
+		t.Fatalf("Expected an error from a second Close")
+	}
+
+	reopened, err := NewSimpleDB(dir, BlockSize, BufferSize)
+	if err != nil {
+		t.Fatalf("Failed to reopen SimpleDB: %v", err)
+	}
+	defer reopened.Close()
+
+	page := file.NewPage(BlockSize)
+	if err := reopened.FileMgr().Read(blk, page.Contents()); err != nil {
+		t.Fatalf("Failed to read from disk: %v", err)
+	}
+	if val, _ := page.GetInt(0); val != 42 {
+		t.Fatalf("Expected flushed value 42, got %d", val)
+	}
+
+	iter, err := reopened.LogMgr().Iterator()
+	if err != nil {
+		t.Fatalf("Failed to create LogIterator: %v", err)
+	}
+	rec, err := iter.Next()
+	if err != nil || string(rec) != "update" {
+		t.Fatalf("Expected log record %q, got %q (err %v)", "update", rec, err)
+	}
+}
+
+// TestSimpleDBCloseFlushError tests that Close leaves the files open when the
+// dirty buffers cannot be flushed, and that it can then be retried.
+func TestSimpleDBCloseFlushError(t *testing.T) {
+	st, err := faultfs.New(file.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create fault storage: %v", err)
+	}
+	db, err := NewSimpleDBWithOptions("faultdb", BlockSize, BufferSize, file.Options{Storage: st})
+	if err != nil {
+		t.Fatalf("Failed to create SimpleDB: %v", err)
+	}
+
+	lsn, err := db.LogMgr().Append([]byte("update"))
+	if err != nil {
+		t.Fatalf("Failed to append log record: %v", err)
+	}
+	blk, err := db.FileMgr().Append("datafile")
+	if err != nil {
+		t.Fatalf("Failed to append block: %v", err)
+	}
+	buff, err := db.BufferMgr().Pin(&blk)
+	if err != nil {
+		t.Fatalf("Failed to pin block: %v", err)
+	}
+	buff.SetModified(1, lsn)
+	db.BufferMgr().Unpin(buff)
+
+	// The first write flushes the log, the second the dirty buffer.
+	st.FailWrite(2)
+	if err := db.Close(); !errors.Is(err, buffer.ErrFlushFailed) {
+		t.Fatalf("Expected buffer.ErrFlushFailed, got %v", err)
+	}
+	if _, err := db.FileMgr().Length("datafile"); err != nil {
+		t.Fatalf("Expected the files to stay open after a failed Close, got %v", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Retrying Close failed: %v", err)
+	}
+	if _, err := db.FileMgr().Length("datafile"); !errors.Is(err, file.ErrClosed) {
+		t.Fatalf("Expected file.ErrClosed, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package concurrency
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrQuiesceAbort = errors.New("quiesce aborted due to timeout")
+
+// TxGate keeps count of the active transactions, so that a quiescent
+// checkpoint can hold off new transactions and wait for the active ones to
+// finish.
+type TxGate struct {
+	mu        sync.Mutex
+	active    int
+	quiescing bool
+	maxTime   time.Duration
+}
+
+// NewTxGate creates a new TxGate whose Begin and Quiesce wait at most maxTime.
+func NewTxGate(maxTime time.Duration) *TxGate {
+	return &TxGate{maxTime: maxTime}
+}
+
+// Begin registers a new transaction with busy-wait + timeout, waiting while
+// the gate is quiesced.
+func (g *TxGate) Begin() error {
+	start := time.Now()
+	for {
+		g.mu.Lock()
+		if !g.quiescing {
+			g.active++
+			g.mu.Unlock()
+			return nil
+		}
+		g.mu.Unlock()
+
+		if time.Since(start) >= g.maxTime {
+			return ErrQuiesceAbort
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// End unregisters a transaction started by Begin.
+func (g *TxGate) End() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.active > 0 {
+		g.active--
+	}
+}
+
+// Active returns the number of active transactions.
+func (g *TxGate) Active() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.active
+}
+
+// Quiesce holds off new transactions and waits for the active ones to end,
+// with busy-wait + timeout. On success it returns a function that lets new
+// transactions in again; on timeout the gate is left open.
+func (g *TxGate) Quiesce() (func(), error) {
+	start := time.Now()
+	g.mu.Lock()
+	for g.quiescing {
+		g.mu.Unlock()
+		if time.Since(start) >= g.maxTime {
+			return nil, ErrQuiesceAbort
+		}
+		time.Sleep(10 * time.Millisecond)
+		g.mu.Lock()
+	}
+	g.quiescing = true
+	g.mu.Unlock()
+
+	for {
+		g.mu.Lock()
+		if g.active == 0 {
+			g.mu.Unlock()
+			return g.resume, nil
+		}
+		g.mu.Unlock()
+
+		if time.Since(start) >= g.maxTime {
+			g.resume()
+			return nil, ErrQuiesceAbort
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// resume lets new transactions in again after Quiesce.
+func (g *TxGate) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.quiescing = false
+}
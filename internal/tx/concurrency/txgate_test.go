@@ -0,0 +1,65 @@
+package concurrency
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestQuiesceWaitsForActiveTxs tests that Quiesce waits for the active
+// transactions to end and holds off new ones until it is resumed.
+func TestQuiesceWaitsForActiveTxs(t *testing.T) {
+	g := NewTxGate(MaxLockTime)
+	if err := g.Begin(); err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		g.End()
+	}()
+
+	start := time.Now()
+	resume, err := g.Quiesce()
+	if err != nil {
+		t.Fatalf("Quiesce failed: %v", err)
+	}
+	if time.Since(start) < 200*time.Millisecond {
+		t.Fatalf("Quiesce returned before the active transaction ended")
+	}
+	if n := g.Active(); n != 0 {
+		t.Fatalf("%d transactions active after Quiesce", n)
+	}
+
+	began := make(chan error, 1)
+	go func() { began <- g.Begin() }()
+	select {
+	case err := <-began:
+		t.Fatalf("Begin returned while quiesced: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	resume()
+	if err := <-began; err != nil {
+		t.Fatalf("Begin failed after resume: %v", err)
+	}
+	if n := g.Active(); n != 1 {
+		t.Fatalf("%d transactions active, want 1", n)
+	}
+}
+
+// TestQuiesceTimeout tests that Quiesce gives up on a transaction that does
+// not end and lets new transactions in again.
+func TestQuiesceTimeout(t *testing.T) {
+	g := NewTxGate(100 * time.Millisecond)
+	if err := g.Begin(); err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+
+	if _, err := g.Quiesce(); !errors.Is(err, ErrQuiesceAbort) {
+		t.Fatalf("Quiesce returned %v, want %v", err, ErrQuiesceAbort)
+	}
+	if err := g.Begin(); err != nil {
+		t.Fatalf("Begin failed after an aborted Quiesce: %v", err)
+	}
+}
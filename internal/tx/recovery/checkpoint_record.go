@@ -2,20 +2,50 @@
 package recovery
 
 import (
+	"errors"
+	"fmt"
+
 	"database_design_and_implementation/internal/file"
 	"database_design_and_implementation/internal/log"
+	"database_design_and_implementation/internal/tx/concurrency"
 )
 
+// ErrNotQuiescent is returned by Checkpoint while transactions are active.
+var ErrNotQuiescent = errors.New("checkpoint requires no active transactions")
+
 // CheckpointRecord struct
 type CheckpointRecord struct{}
 
 // LogManager is an interface to abstract the log manager
 type LogManager interface {
-	Append([]byte) int
+	Append([]byte) (int, error)
+}
+
+// TruncatingLogManager is a log manager that can remove old log records
+type TruncatingLogManager interface {
+	LogManager
+	Flush(lsn int) error
+	Truncate(beforeLSN int) error
+}
+
+// BufferFlusher is a buffer manager that can write every modified buffer to disk
+type BufferFlusher interface {
+	FlushDirty() error
 }
 
-// Ensure LogMgr implements LogManager
-var _ LogManager = (*log.LogMgr)(nil)
+// Quiescer holds off new transactions and waits for the active ones to end,
+// returning a function that lets new transactions in again
+type Quiescer interface {
+	Quiesce() (func(), error)
+}
+
+// Ensure LogMgr implements LogManager and TruncatingLogManager, and TxGate
+// implements Quiescer
+var (
+	_ LogManager           = (*log.LogMgr)(nil)
+	_ TruncatingLogManager = (*log.LogMgr)(nil)
+	_ Quiescer             = (*concurrency.TxGate)(nil)
+)
 
 // NewCheckpointRecord creates a new CheckpointRecord
 func NewCheckpointRecord() *CheckpointRecord {
@@ -47,5 +77,38 @@ func WriteCheckpointToLog(lm LogManager) (int, error) {
 	rec := make([]byte, 4) // int32 size
 	page := file.NewPage(len(rec))
 	page.SetInt(0, CHECKPOINT)
-	return lm.Append(page.Contents()), nil
+	return lm.Append(page.Contents())
+}
+
+// Checkpoint writes a quiescent checkpoint: it flushes every modified buffer,
+// writes a CHECKPOINT record to the log, flushes it, and truncates the log
+// before it. Recovery stops at a quiescent checkpoint, so the records before
+// it are no longer needed. It returns the LSN of the checkpoint.
+//
+// Checkpoint quiesces q for as long as it runs: the records of an active
+// transaction are needed to undo it. If the active transactions do not end in
+// time, Checkpoint fails with ErrNotQuiescent.
+func Checkpoint(lm TruncatingLogManager, bm BufferFlusher, q Quiescer) (int, error) {
+	resume, err := q.Quiesce()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrNotQuiescent, err)
+	}
+	defer resume()
+
+	// The changes of the committed transactions must be on disk before the
+	// records that could redo them are removed.
+	if err := bm.FlushDirty(); err != nil {
+		return 0, err
+	}
+	lsn, err := WriteCheckpointToLog(lm)
+	if err != nil {
+		return 0, err
+	}
+	if err := lm.Flush(lsn); err != nil {
+		return 0, err
+	}
+	if err := lm.Truncate(lsn); err != nil {
+		return 0, err
+	}
+	return lsn, nil
 }
@@ -3,9 +3,13 @@ package recovery
 
 import (
 	"encoding/binary"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"database_design_and_implementation/internal/tx/concurrency"
 )
 
 // TestCheckpointRecord tests the CheckpointRecord functionality
@@ -28,32 +32,107 @@ func TestWriteCheckpointToLog(t *testing.T) {
 
 	assert.Nil(t, err, "WriteCheckpointToLog should not return an error")
 	assert.Equal(t, 1, lsn, "LSN should be 1 since mock increments by 1")
-	assert.Equal(t, CHECKPOINT, int(binary.LittleEndian.Uint32(mockLogMgr.lastRecord)), "Last log record should be CHECKPOINT")
+	assert.Equal(t, CHECKPOINT, int(binary.BigEndian.Uint32(mockLogMgr.lastRecord)), "Last log record should be CHECKPOINT")
+}
+
+// TestCheckpoint tests that Checkpoint flushes the buffers and the log and
+// truncates it before the CHECKPOINT record
+func TestCheckpoint(t *testing.T) {
+	mockLogMgr := &MockLogMgr{nextLSN: 41}
+	mockBufferMgr := &MockBufferMgr{}
+	gate := concurrency.NewTxGate(time.Second)
+	lsn, err := Checkpoint(mockLogMgr, mockBufferMgr, gate)
+
+	assert.Nil(t, err, "Checkpoint should not return an error")
+	assert.True(t, mockBufferMgr.flushed, "The modified buffers should be flushed")
+	assert.Equal(t, 42, lsn, "Checkpoint should return the LSN of the CHECKPOINT record")
+	assert.Equal(t, CHECKPOINT, int(binary.BigEndian.Uint32(mockLogMgr.lastRecord)), "Last log record should be CHECKPOINT")
+	assert.Equal(t, 42, mockLogMgr.flushedLSN, "The CHECKPOINT record should be flushed")
+	assert.Equal(t, 42, mockLogMgr.truncatedBefore, "The log should be truncated before the CHECKPOINT record")
+	assert.Nil(t, gate.Begin(), "New transactions should be let in after the checkpoint")
 }
 
-// MockTransaction is a mock implementation of Transaction interface
-type MockTransaction struct{}
+// TestCheckpointNotQuiescent tests that Checkpoint refuses to run while
+// transactions are active
+func TestCheckpointNotQuiescent(t *testing.T) {
+	mockLogMgr := &MockLogMgr{nextLSN: 41}
+	mockBufferMgr := &MockBufferMgr{}
+	gate := concurrency.NewTxGate(100 * time.Millisecond)
+	assert.Nil(t, gate.Begin(), "Begin should not return an error")
+	_, err := Checkpoint(mockLogMgr, mockBufferMgr, gate)
+
+	assert.ErrorIs(t, err, ErrNotQuiescent, "Checkpoint should fail with active transactions")
+	assert.ErrorIs(t, err, concurrency.ErrQuiesceAbort, "Checkpoint should report why it could not quiesce")
+	assert.False(t, mockBufferMgr.flushed, "The modified buffers should not be flushed")
+	assert.Nil(t, mockLogMgr.lastRecord, "No CHECKPOINT record should be written")
+	assert.Equal(t, 0, mockLogMgr.truncatedBefore, "The log should not be truncated")
+}
+
+// TestCheckpointFlushError tests that Checkpoint does not truncate the log if
+// the buffers cannot be flushed
+func TestCheckpointFlushError(t *testing.T) {
+	mockLogMgr := &MockLogMgr{nextLSN: 41}
+	flushErr := errors.New("flush failed")
+	_, err := Checkpoint(mockLogMgr, &MockBufferMgr{err: flushErr}, concurrency.NewTxGate(time.Second))
+
+	assert.ErrorIs(t, err, flushErr, "Checkpoint should return the flush error")
+	assert.Equal(t, 0, mockLogMgr.truncatedBefore, "The log should not be truncated")
+}
+
+// MockBufferMgr is a mock implementation of BufferFlusher that remembers
+// whether it was flushed
+type MockBufferMgr struct {
+	flushed bool
+	err     error
+}
+
+func (m *MockBufferMgr) FlushDirty() error {
+	m.flushed = true
+	return m.err
+}
+
+// MockTransaction is a mock implementation of Transaction interface that
+// remembers the last undo it was asked to do
+type MockTransaction struct {
+	undoTxID   int
+	undoOffset int
+	undoValue  any
+}
 
 func (m *MockTransaction) UndoSetInt(txID, offset, oldValue int) error {
+	m.undoTxID, m.undoOffset, m.undoValue = txID, offset, oldValue
 	return nil
 }
 
 func (m *MockTransaction) UndoSetString(txID, offset int, oldValue string) error {
+	m.undoTxID, m.undoOffset, m.undoValue = txID, offset, oldValue
 	return nil
 }
 
 // MockLogMgr is a mock implementation of LogMgr for testing purposes
 type MockLogMgr struct {
-	lastRecord []byte
-	nextLSN    int
+	lastRecord      []byte
+	nextLSN         int
+	flushedLSN      int
+	truncatedBefore int
 }
 
-// Ensure MockLogMgr implements LogManager
-var _ LogManager = (*MockLogMgr)(nil)
+// Ensure MockLogMgr implements TruncatingLogManager
+var _ TruncatingLogManager = (*MockLogMgr)(nil)
 
-func (m *MockLogMgr) Append(logrec []byte) int {
+func (m *MockLogMgr) Append(logrec []byte) (int, error) {
 	m.lastRecord = make([]byte, len(logrec))
 	copy(m.lastRecord, logrec)
 	m.nextLSN++
-	return m.nextLSN
+	return m.nextLSN, nil
+}
+
+func (m *MockLogMgr) Flush(lsn int) error {
+	m.flushedLSN = lsn
+	return nil
+}
+
+func (m *MockLogMgr) Truncate(beforeLSN int) error {
+	m.truncatedBefore = beforeLSN
+	return nil
 }
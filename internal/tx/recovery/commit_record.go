@@ -0,0 +1,52 @@
+// commit_record.go
+package recovery
+
+import (
+	"fmt"
+
+	"database_design_and_implementation/internal/file"
+)
+
+// CommitRecord records that a transaction committed. It is stored as
+//
+//	[COMMIT][txnum]
+type CommitRecord struct {
+	txnum int
+}
+
+// NewCommitRecord decodes a COMMIT record from a page holding it
+func NewCommitRecord(p *file.Page) (*CommitRecord, error) {
+	txnum, err := p.GetInt(file.IntSize)
+	if err != nil {
+		return nil, fmt.Errorf("decode COMMIT record: %w", err)
+	}
+	return &CommitRecord{txnum: int(txnum)}, nil
+}
+
+// Op returns the COMMIT constant
+func (c *CommitRecord) Op() int {
+	return COMMIT
+}
+
+// TxNumber returns the transaction the record belongs to
+func (c *CommitRecord) TxNumber() int {
+	return c.txnum
+}
+
+// Undo does nothing as COMMIT doesn't change any data
+func (c *CommitRecord) Undo(tx Transaction) error {
+	return nil
+}
+
+// String representation of CommitRecord
+func (c *CommitRecord) String() string {
+	return fmt.Sprintf("<COMMIT %d>", c.txnum)
+}
+
+// WriteCommitToLog writes a COMMIT record for the transaction to the log
+func WriteCommitToLog(lm LogManager, txnum int) (int, error) {
+	page := file.NewPage(2 * file.IntSize)
+	page.SetInt(0, COMMIT)
+	page.SetInt(file.IntSize, int32(txnum))
+	return lm.Append(page.Contents())
+}
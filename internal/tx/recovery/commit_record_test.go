@@ -0,0 +1,26 @@
+package recovery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCommitRecord tests that a COMMIT record read back from the log is intact
+func TestCommitRecord(t *testing.T) {
+	mockLogMgr := &MockLogMgr{}
+	lsn, err := WriteCommitToLog(mockLogMgr, 7)
+	assert.Nil(t, err, "WriteCommitToLog should not return an error")
+	assert.Equal(t, 1, lsn, "LSN should be 1 since mock increments by 1")
+
+	rec, err := CreateLogRecord(mockLogMgr.lastRecord)
+	assert.Nil(t, err, "CreateLogRecord should decode a COMMIT record")
+	assert.IsType(t, &CommitRecord{}, rec)
+	assert.Equal(t, COMMIT, rec.Op(), "Op should return COMMIT")
+	assert.Equal(t, 7, rec.TxNumber(), "TxNumber should return the transaction")
+	assert.Equal(t, "<COMMIT 7>", rec.(*CommitRecord).String())
+
+	tx := new(MockTransaction)
+	assert.Nil(t, rec.Undo(tx), "Undo should do nothing and return nil")
+	assert.Nil(t, tx.undoValue, "Undo should not change any data")
+}
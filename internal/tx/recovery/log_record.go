@@ -1,9 +1,10 @@
 package recovery
 
 import (
-	"bytes"
-	"encoding/binary"
 	"errors"
+	"fmt"
+
+	"database_design_and_implementation/internal/file"
 )
 
 // The operation types
@@ -30,20 +31,44 @@ type Transaction interface {
 }
 
 // CreateLogRecord creates a new LogRecord instance from the given data.
+// Records are encoded with a file.Page, so the operation type comes first.
 func CreateLogRecord(data []byte) (LogRecord, error) {
 	if len(data) < 4 {
 		return nil, errors.New("invalid log record data")
 	}
 
-	buf := bytes.NewReader(data)
-	var opType int32
-	if err := binary.Read(buf, binary.LittleEndian, &opType); err != nil {
+	p := file.NewPageFromBytes(data)
+	opType, err := p.GetInt(0)
+	if err != nil {
 		return nil, err
 	}
 
 	switch opType {
 	case CHECKPOINT:
 		return NewCheckpointRecord(), nil
+	case START:
+		return NewStartRecord(p)
+	case COMMIT:
+		return NewCommitRecord(p)
+	case ROLLBACK:
+		return NewRollbackRecord(p)
+	case SETINT:
+		return NewSetIntRecord(p)
+	case SETSTRING:
+		return NewSetStringRecord(p)
 	}
 	return nil, errors.New("unknown log record type")
 }
+
+// getInts reads the integers at the given offsets of a page.
+func getInts(p *file.Page, offsets ...int) ([]int, error) {
+	ints := make([]int, len(offsets))
+	for i, offset := range offsets {
+		n, err := p.GetInt(offset)
+		if err != nil {
+			return nil, fmt.Errorf("read int at offset %d: %w", offset, err)
+		}
+		ints[i] = int(n)
+	}
+	return ints, nil
+}
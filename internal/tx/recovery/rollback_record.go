@@ -0,0 +1,52 @@
+// rollback_record.go
+package recovery
+
+import (
+	"fmt"
+
+	"database_design_and_implementation/internal/file"
+)
+
+// RollbackRecord records that a transaction rolled back. It is stored as
+//
+//	[ROLLBACK][txnum]
+type RollbackRecord struct {
+	txnum int
+}
+
+// NewRollbackRecord decodes a ROLLBACK record from a page holding it
+func NewRollbackRecord(p *file.Page) (*RollbackRecord, error) {
+	txnum, err := p.GetInt(file.IntSize)
+	if err != nil {
+		return nil, fmt.Errorf("decode ROLLBACK record: %w", err)
+	}
+	return &RollbackRecord{txnum: int(txnum)}, nil
+}
+
+// Op returns the ROLLBACK constant
+func (r *RollbackRecord) Op() int {
+	return ROLLBACK
+}
+
+// TxNumber returns the transaction the record belongs to
+func (r *RollbackRecord) TxNumber() int {
+	return r.txnum
+}
+
+// Undo does nothing as ROLLBACK doesn't change any data
+func (r *RollbackRecord) Undo(tx Transaction) error {
+	return nil
+}
+
+// String representation of RollbackRecord
+func (r *RollbackRecord) String() string {
+	return fmt.Sprintf("<ROLLBACK %d>", r.txnum)
+}
+
+// WriteRollbackToLog writes a ROLLBACK record for the transaction to the log
+func WriteRollbackToLog(lm LogManager, txnum int) (int, error) {
+	page := file.NewPage(2 * file.IntSize)
+	page.SetInt(0, ROLLBACK)
+	page.SetInt(file.IntSize, int32(txnum))
+	return lm.Append(page.Contents())
+}
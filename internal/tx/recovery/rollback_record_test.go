@@ -0,0 +1,26 @@
+package recovery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRollbackRecord tests that a ROLLBACK record read back from the log is intact
+func TestRollbackRecord(t *testing.T) {
+	mockLogMgr := &MockLogMgr{}
+	lsn, err := WriteRollbackToLog(mockLogMgr, 7)
+	assert.Nil(t, err, "WriteRollbackToLog should not return an error")
+	assert.Equal(t, 1, lsn, "LSN should be 1 since mock increments by 1")
+
+	rec, err := CreateLogRecord(mockLogMgr.lastRecord)
+	assert.Nil(t, err, "CreateLogRecord should decode a ROLLBACK record")
+	assert.IsType(t, &RollbackRecord{}, rec)
+	assert.Equal(t, ROLLBACK, rec.Op(), "Op should return ROLLBACK")
+	assert.Equal(t, 7, rec.TxNumber(), "TxNumber should return the transaction")
+	assert.Equal(t, "<ROLLBACK 7>", rec.(*RollbackRecord).String())
+
+	tx := new(MockTransaction)
+	assert.Nil(t, rec.Undo(tx), "Undo should do nothing and return nil")
+	assert.Nil(t, tx.undoValue, "Undo should not change any data")
+}
@@ -0,0 +1,106 @@
+// setint_record.go
+package recovery
+
+import (
+	"fmt"
+
+	"database_design_and_implementation/internal/file"
+)
+
+// SetIntRecord records that a transaction changed an integer in a block. It
+// keeps the old value for undo and the new value for readers of the log such
+// as change data capture. It is stored as
+//
+//	[SETINT][txnum][filename][blknum][offset][oldval][newval]
+type SetIntRecord struct {
+	txnum  int
+	blk    file.BlockId
+	offset int
+	oldval int
+	newval int
+}
+
+// NewSetIntRecord decodes a SETINT record from a page holding it
+func NewSetIntRecord(p *file.Page) (*SetIntRecord, error) {
+	tpos := file.IntSize
+	fpos := tpos + file.IntSize
+	filename, err := p.GetString(fpos)
+	if err != nil {
+		return nil, fmt.Errorf("decode SETINT record: %w", err)
+	}
+	bpos := fpos + file.IntSize + len(filename)
+	ints, err := getInts(p, tpos, bpos, bpos+file.IntSize, bpos+2*file.IntSize, bpos+3*file.IntSize)
+	if err != nil {
+		return nil, fmt.Errorf("decode SETINT record: %w", err)
+	}
+	return &SetIntRecord{
+		txnum:  ints[0],
+		blk:    file.NewBlockId(filename, ints[1]),
+		offset: ints[2],
+		oldval: ints[3],
+		newval: ints[4],
+	}, nil
+}
+
+// Op returns the SETINT constant
+func (s *SetIntRecord) Op() int {
+	return SETINT
+}
+
+// TxNumber returns the transaction that made the change
+func (s *SetIntRecord) TxNumber() int {
+	return s.txnum
+}
+
+// Block returns the block that was changed
+func (s *SetIntRecord) Block() file.BlockId {
+	return s.blk
+}
+
+// Offset returns the offset of the changed integer within its block
+func (s *SetIntRecord) Offset() int {
+	return s.offset
+}
+
+// OldValue returns the integer before the change
+func (s *SetIntRecord) OldValue() int {
+	return s.oldval
+}
+
+// NewValue returns the integer after the change
+func (s *SetIntRecord) NewValue() int {
+	return s.newval
+}
+
+// Undo restores the old value of the integer
+func (s *SetIntRecord) Undo(tx Transaction) error {
+	return tx.UndoSetInt(s.txnum, s.offset, s.oldval)
+}
+
+// String representation of SetIntRecord
+func (s *SetIntRecord) String() string {
+	return fmt.Sprintf("<SETINT %d %s %d %d %d>", s.txnum, s.blk, s.offset, s.oldval, s.newval)
+}
+
+// WriteSetIntToLog writes a SETINT record for a change of the integer at the
+// given offset of blk from oldval to newval
+func WriteSetIntToLog(lm LogManager, txnum int, blk file.BlockId, offset, oldval, newval int) (int, error) {
+	tpos := file.IntSize
+	fpos := tpos + file.IntSize
+	bpos := fpos + file.IntSize + len(blk.Filename)
+	opos := bpos + file.IntSize
+	vpos := opos + file.IntSize
+	npos := vpos + file.IntSize
+
+	page := file.NewPage(npos + file.IntSize)
+	page.SetInt(0, SETINT)
+	page.SetInt(tpos, int32(txnum))
+	if err := page.SetString(fpos, blk.Filename); err != nil {
+		return 0, err
+	}
+	page.SetInt(bpos, int32(blk.Blknum))
+	page.SetInt(opos, int32(offset))
+	page.SetInt(vpos, int32(oldval))
+	page.SetInt(npos, int32(newval))
+	return lm.Append(page.Contents())
+}
@@ -0,0 +1,39 @@
+package recovery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"database_design_and_implementation/internal/file"
+)
+
+// TestSetIntRecord tests that a SETINT record read back from the log is intact
+// and that undoing it restores the old value
+func TestSetIntRecord(t *testing.T) {
+	mockLogMgr := &MockLogMgr{}
+	blk := file.NewBlockId("accounts.tbl", 3)
+	_, err := WriteSetIntToLog(mockLogMgr, 7, blk, 80, -5, 1200)
+	assert.Nil(t, err, "WriteSetIntToLog should not return an error")
+	// [SETINT][txnum][len]accounts.tbl[blknum][offset][oldval][newval]
+	assert.Equal(t, 7*file.IntSize+len("accounts.tbl"), len(mockLogMgr.lastRecord),
+		"The record should be sized by the bytes of the filename")
+
+	rec, err := CreateLogRecord(mockLogMgr.lastRecord)
+	assert.Nil(t, err, "CreateLogRecord should decode a SETINT record")
+	setInt, ok := rec.(*SetIntRecord)
+	assert.True(t, ok, "CreateLogRecord should return a SetIntRecord")
+	assert.Equal(t, SETINT, setInt.Op(), "Op should return SETINT")
+	assert.Equal(t, 7, setInt.TxNumber())
+	assert.Equal(t, blk, setInt.Block())
+	assert.Equal(t, 80, setInt.Offset())
+	assert.Equal(t, -5, setInt.OldValue())
+	assert.Equal(t, 1200, setInt.NewValue())
+	assert.Equal(t, "<SETINT 7 [file accounts.tbl, block 3] 80 -5 1200>", setInt.String())
+
+	tx := new(MockTransaction)
+	assert.Nil(t, setInt.Undo(tx))
+	assert.Equal(t, 7, tx.undoTxID)
+	assert.Equal(t, 80, tx.undoOffset)
+	assert.Equal(t, -5, tx.undoValue, "Undo should restore the old value")
+}
@@ -0,0 +1,121 @@
+// setstring_record.go
+package recovery
+
+import (
+	"fmt"
+	"strconv"
+
+	"database_design_and_implementation/internal/file"
+)
+
+// SetStringRecord records that a transaction changed a string in a block. It
+// keeps the old value for undo and the new value for readers of the log such
+// as change data capture. It is stored as
+//
+//	[SETSTRING][txnum][filename][blknum][offset][oldval][newval]
+type SetStringRecord struct {
+	txnum  int
+	blk    file.BlockId
+	offset int
+	oldval string
+	newval string
+}
+
+// NewSetStringRecord decodes a SETSTRING record from a page holding it
+func NewSetStringRecord(p *file.Page) (*SetStringRecord, error) {
+	tpos := file.IntSize
+	fpos := tpos + file.IntSize
+	filename, err := p.GetString(fpos)
+	if err != nil {
+		return nil, fmt.Errorf("decode SETSTRING record: %w", err)
+	}
+	bpos := fpos + file.IntSize + len(filename)
+	opos := bpos + file.IntSize
+	ints, err := getInts(p, tpos, bpos, opos)
+	if err != nil {
+		return nil, fmt.Errorf("decode SETSTRING record: %w", err)
+	}
+	vpos := opos + file.IntSize
+	oldval, err := p.GetString(vpos)
+	if err != nil {
+		return nil, fmt.Errorf("decode SETSTRING record: %w", err)
+	}
+	newval, err := p.GetString(vpos + file.IntSize + len(oldval))
+	if err != nil {
+		return nil, fmt.Errorf("decode SETSTRING record: %w", err)
+	}
+	return &SetStringRecord{
+		txnum:  ints[0],
+		blk:    file.NewBlockId(filename, ints[1]),
+		offset: ints[2],
+		oldval: oldval,
+		newval: newval,
+	}, nil
+}
+
+// Op returns the SETSTRING constant
+func (s *SetStringRecord) Op() int {
+	return SETSTRING
+}
+
+// TxNumber returns the transaction that made the change
+func (s *SetStringRecord) TxNumber() int {
+	return s.txnum
+}
+
+// Block returns the block that was changed
+func (s *SetStringRecord) Block() file.BlockId {
+	return s.blk
+}
+
+// Offset returns the offset of the changed string within its block
+func (s *SetStringRecord) Offset() int {
+	return s.offset
+}
+
+// OldValue returns the string before the change
+func (s *SetStringRecord) OldValue() string {
+	return s.oldval
+}
+
+// NewValue returns the string after the change
+func (s *SetStringRecord) NewValue() string {
+	return s.newval
+}
+
+// Undo restores the old value of the string
+func (s *SetStringRecord) Undo(tx Transaction) error {
+	return tx.UndoSetString(s.txnum, s.offset, s.oldval)
+}
+
+// String representation of SetStringRecord
+func (s *SetStringRecord) String() string {
+	return fmt.Sprintf("<SETSTRING %d %s %d %s %s>", s.txnum, s.blk, s.offset, strconv.Quote(s.oldval), strconv.Quote(s.newval))
+}
+
+// WriteSetStringToLog writes a SETSTRING record for a change of the string at
+// the given offset of blk from oldval to newval
+func WriteSetStringToLog(lm LogManager, txnum int, blk file.BlockId, offset int, oldval, newval string) (int, error) {
+	tpos := file.IntSize
+	fpos := tpos + file.IntSize
+	bpos := fpos + file.IntSize + len(blk.Filename)
+	opos := bpos + file.IntSize
+	vpos := opos + file.IntSize
+	npos := vpos + file.IntSize + len(oldval)
+
+	page := file.NewPage(npos + file.IntSize + len(newval))
+	page.SetInt(0, SETSTRING)
+	page.SetInt(tpos, int32(txnum))
+	if err := page.SetString(fpos, blk.Filename); err != nil {
+		return 0, err
+	}
+	page.SetInt(bpos, int32(blk.Blknum))
+	page.SetInt(opos, int32(offset))
+	if err := page.SetString(vpos, oldval); err != nil {
+		return 0, err
+	}
+	if err := page.SetString(npos, newval); err != nil {
+		return 0, err
+	}
+	return lm.Append(page.Contents())
+}
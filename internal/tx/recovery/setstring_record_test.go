@@ -0,0 +1,40 @@
+package recovery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"database_design_and_implementation/internal/file"
+)
+
+// TestSetStringRecord tests that a SETSTRING record read back from the log is
+// intact and that undoing it restores the old value
+func TestSetStringRecord(t *testing.T) {
+	mockLogMgr := &MockLogMgr{}
+	blk := file.NewBlockId("students.tbl", 0)
+	_, err := WriteSetStringToLog(mockLogMgr, 2, blk, 14, "", "Ünïcode name")
+	assert.Nil(t, err, "WriteSetStringToLog should not return an error")
+	// [SETSTRING][txnum][len]students.tbl[blknum][offset][len][len]Ünïcode name
+	assert.Equal(t, 7*file.IntSize+len("students.tbl")+len("Ünïcode name"), len(mockLogMgr.lastRecord),
+		"The record should be sized by the bytes of its strings")
+
+	rec, err := CreateLogRecord(mockLogMgr.lastRecord)
+	assert.Nil(t, err, "CreateLogRecord should decode a SETSTRING record")
+	setString, ok := rec.(*SetStringRecord)
+	assert.True(t, ok, "CreateLogRecord should return a SetStringRecord")
+	assert.Equal(t, SETSTRING, setString.Op(), "Op should return SETSTRING")
+	assert.Equal(t, 2, setString.TxNumber())
+	assert.Equal(t, blk, setString.Block())
+	assert.Equal(t, 14, setString.Offset())
+	assert.Equal(t, "", setString.OldValue())
+	assert.Equal(t, "Ünïcode name", setString.NewValue())
+	assert.Equal(t, `<SETSTRING 2 [file students.tbl, block 0] 14 "" "Ünïcode name">`, setString.String())
+
+	tx := new(MockTransaction)
+	assert.Nil(t, setString.Undo(tx))
+	assert.Equal(t, "", tx.undoValue, "Undo should restore the old value")
+
+	_, err = CreateLogRecord(mockLogMgr.lastRecord[:20])
+	assert.NotNil(t, err, "A truncated SETSTRING record should not decode")
+}
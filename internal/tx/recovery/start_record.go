@@ -0,0 +1,52 @@
+// start_record.go
+package recovery
+
+import (
+	"fmt"
+
+	"database_design_and_implementation/internal/file"
+)
+
+// StartRecord records that a transaction began. It is stored as
+//
+//	[START][txnum]
+type StartRecord struct {
+	txnum int
+}
+
+// NewStartRecord decodes a START record from a page holding it
+func NewStartRecord(p *file.Page) (*StartRecord, error) {
+	txnum, err := p.GetInt(file.IntSize)
+	if err != nil {
+		return nil, fmt.Errorf("decode START record: %w", err)
+	}
+	return &StartRecord{txnum: int(txnum)}, nil
+}
+
+// Op returns the START constant
+func (s *StartRecord) Op() int {
+	return START
+}
+
+// TxNumber returns the transaction the record belongs to
+func (s *StartRecord) TxNumber() int {
+	return s.txnum
+}
+
+// Undo does nothing as START doesn't change any data
+func (s *StartRecord) Undo(tx Transaction) error {
+	return nil
+}
+
+// String representation of StartRecord
+func (s *StartRecord) String() string {
+	return fmt.Sprintf("<START %d>", s.txnum)
+}
+
+// WriteStartToLog writes a START record for the transaction to the log
+func WriteStartToLog(lm LogManager, txnum int) (int, error) {
+	page := file.NewPage(2 * file.IntSize)
+	page.SetInt(0, START)
+	page.SetInt(file.IntSize, int32(txnum))
+	return lm.Append(page.Contents())
+}
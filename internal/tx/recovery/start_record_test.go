@@ -0,0 +1,26 @@
+package recovery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestStartRecord tests that a START record read back from the log is intact
+func TestStartRecord(t *testing.T) {
+	mockLogMgr := &MockLogMgr{}
+	lsn, err := WriteStartToLog(mockLogMgr, 7)
+	assert.Nil(t, err, "WriteStartToLog should not return an error")
+	assert.Equal(t, 1, lsn, "LSN should be 1 since mock increments by 1")
+
+	rec, err := CreateLogRecord(mockLogMgr.lastRecord)
+	assert.Nil(t, err, "CreateLogRecord should decode a START record")
+	assert.IsType(t, &StartRecord{}, rec)
+	assert.Equal(t, START, rec.Op(), "Op should return START")
+	assert.Equal(t, 7, rec.TxNumber(), "TxNumber should return the transaction")
+	assert.Equal(t, "<START 7>", rec.(*StartRecord).String())
+
+	tx := new(MockTransaction)
+	assert.Nil(t, rec.Undo(tx), "Undo should do nothing and return nil")
+	assert.Nil(t, tx.undoValue, "Undo should not change any data")
+}